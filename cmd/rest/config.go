@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"github.com/sy-software/minerva-spear-users/internal/repositories"
+)
+
+// loadConfig loads the configuration, applies the development mode when dev is not nil and validates it.
+// The returned repository is used to reload the configuration
+func loadConfig(dev *devMode, flags repositories.ConfigOverrides) (*repositories.ConfigRepo, domain.Config, error) {
+	configRepo := repositories.NewConfigRepo()
+	configRepo.Flags = flags
+
+	config, err := configRepo.Get()
+	if err != nil {
+		return configRepo, config, err
+	}
+
+	if dev != nil {
+		if err := dev.apply(&config); err != nil {
+			return configRepo, config, err
+		}
+	}
+
+	return configRepo, config, config.Validate()
+}
+
+// printConfig writes the configuration without secrets, validation problems are written to stderr
+func printConfig(config domain.Config, err error) int {
+	var invalid *domain.ConfigError
+	if err != nil && !errors.As(err, &invalid) {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(config.Redacted()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if invalid != nil {
+		fmt.Fprintln(os.Stderr, invalid)
+		return 1
+	}
+
+	return 0
+}
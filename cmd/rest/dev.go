@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+// Development keys are only used to sign tokens while the process runs
+const DEV_KEY_BITS = 2048
+
+// devMode runs without external services, users and passkeys are kept in memory
+// and tokens are signed with a key generated on startup
+type devMode struct {
+	privateKey string
+	publicKey  string
+}
+
+// newDevMode generates the signing key, it's kept for every configuration reload
+func newDevMode() (*devMode, error) {
+	log.Warn().Msg("Running in development mode, users are not persisted and tokens are invalid after restart")
+
+	key, err := rsa.GenerateKey(rand.Reader, DEV_KEY_BITS)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &devMode{
+		privateKey: string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		publicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})),
+	}, nil
+}
+
+// apply changes the configuration to use the development key and storage
+func (dev *devMode) apply(config *domain.Config) error {
+	config.Token.PrivateKey = dev.privateKey
+	config.Token.PublicKey = dev.publicKey
+	config.UserRepo.Driver = domain.UserRepoMemory
+	// Memory lookups are as fast as the cache
+	config.UserRepo.Cache.Size = 0
+	// There is no load balancer to drain
+	config.Server.DrainPeriod = 0
+
+	return nil
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,64 +15,206 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 	minervaLog "github.com/sy-software/minerva-go-utils/log"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
 	"github.com/sy-software/minerva-spear-users/internal/core/service"
 	"github.com/sy-software/minerva-spear-users/internal/handlers"
+	"github.com/sy-software/minerva-spear-users/internal/metrics"
 	"github.com/sy-software/minerva-spear-users/internal/repositories"
 )
 
 func main() {
+	dev := flag.Bool("dev", false, "Run with in memory storage and an ephemeral signing key")
+	checkConfig := flag.Bool("check-config", false, "Validate the configuration and exit")
+	printConfigFlag := flag.Bool("print-config", false, "Print the configuration without secrets and exit")
+	overrides := repositories.RegisterConfigFlags(flag.CommandLine)
+	flag.Parse()
+
 	minervaLog.ConfigureLogger(minervaLog.LogLevel(os.Getenv("LOG_LEVEL")), os.Getenv("CONSOLE_OUTPUT") != "")
 	log.Info().Msg("Starting server")
 
-	configRepo := repositories.ConfigRepo{}
-	config := configRepo.Get()
+	var devSettings *devMode
+	if *dev {
+		var err error
+		devSettings, err = newDevMode()
+		if err != nil {
+			log.Fatal().Err(err).Msg("Can't start development mode")
+		}
+	}
 
-	repo := repositories.NewUserRepo(&config)
+	configRepo, config, err := loadConfig(devSettings, overrides)
+	if *printConfigFlag {
+		os.Exit(printConfig(config, err))
+	}
 
-	authService := service.NewAuthService(repo, config)
+	if *checkConfig {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 
-	handler := handlers.NewAuthRESTHandler(&config, authService)
+		fmt.Println("Configuration is valid")
+		return
+	}
 
-	router := gin.Default()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		log.Fatal().Err(err).Msg("Can't load configuration")
+	}
 
+	// kill (no param) default send syscall.SIGTERM
+	// kill -2 is syscall.SIGINT
+	// kill -9 is syscall.SIGKILL but can't be catch, so don't need add it
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	err = run(ctx, configRepo, config, devSettings)
+	stop()
+
+	if err != nil {
+		log.Fatal().Err(err).Msg("Server stopped")
+	}
+
+	log.Info().Msg("Server exiting")
+}
+
+// run serves the API until ctx is done, then the readiness probe fails for the drain period
+// and the requests in progress are finished. Startup errors are returned before serving
+func run(ctx context.Context, configRepo *repositories.ConfigRepo, config domain.Config, dev *devMode) error {
+	repo, err := repositories.OpenUserRepo(&config)
+	if err != nil {
+		return fmt.Errorf("can't create user repository: %w", err)
+	}
+
+	credentialRepo, err := repositories.OpenCredentialRepo(&config, repo)
+	if err != nil {
+		return fmt.Errorf("can't create credential repository: %w", err)
+	}
+
+	challengeRepo, err := repositories.OpenChallengeRepo(&config, repo)
+	if err != nil {
+		return fmt.Errorf("can't create challenge repository: %w", err)
+	}
+
+	snapshot := domain.NewConfigSnapshot(config)
+	appMetrics := metrics.New(snapshot)
+
+	// Measured before the cache so the latency is the storage latency
+	repo = repositories.NewInstrumentedUserRepo(repo, appMetrics.UserRepoLatency)
+	if config.UserRepo.Cache.Size > 0 {
+		cached := repositories.NewCachedUserRepo(repo, config.UserRepo.Cache)
+		appMetrics.Registry.MustRegister(cached.Collector())
+		repo = cached
+	}
+
+	watcher := repositories.NewConfigWatcher(configRepo, snapshot)
+	if dev != nil {
+		watcher.Prepare = dev.apply
+	}
+
+	signer := metrics.NewInstrumentedTokenSigner(service.NewRS256Signer(), appMetrics.SigningDuration)
+	authService := service.NewAuthService(repo, credentialRepo, signer, snapshot)
+	webAuthnService := service.NewWebAuthnService(repo, credentialRepo, challengeRepo, signer, snapshot)
+
+	handler := handlers.NewInstrumentedAuthRESTHandler(handlers.NewAuthRESTHandler(snapshot, authService), appMetrics)
+	webAuthnHandler := handlers.NewInstrumentedWebAuthnRESTHandler(handlers.NewWebAuthnRESTHandler(snapshot, webAuthnService), appMetrics)
+	healthHandler := handlers.NewHealthRESTHandler(
+		handlers.ConfigHealthCheck(snapshot),
+		handlers.SigningKeysHealthCheck(snapshot),
+		handlers.UserRepoHealthCheck(repo),
+	)
+
+	router := gin.New()
+	// Probes and scrapes are requested every few seconds, logging them hides the API requests
+	router.Use(gin.LoggerWithConfig(gin.LoggerConfig{SkipPaths: []string{"/healthz", "/readyz", "/metrics"}}), gin.Recovery())
+	router.GET("/metrics", gin.WrapH(appMetrics.Handler()))
+
+	healthHandler.CreateRoutes(router)
 	handler.CreateRoutes(router)
+	webAuthnHandler.CreateRoutes(router)
+
+	tlsConfig, err := newTLSConfig(config.TLS)
+	if err != nil {
+		return fmt.Errorf("can't configure TLS: %w", err)
+	}
+
+	srv := newServer(config, router)
+	srv.TLSConfig = tlsConfig
+	configureHTTP2(srv)
 
-	address := fmt.Sprintf("%s:%s", config.Host, config.Port)
-	srv := &http.Server{
-		Addr:    address,
-		Handler: router,
+	servers := []*http.Server{srv}
+	if config.TLS.RedirectPort != "" {
+		redirect := newServer(config, redirectHandler(config.Port))
+		redirect.Addr = net.JoinHostPort(config.Host, config.TLS.RedirectPort)
+		servers = append(servers, redirect)
 	}
 
-	// Initializing the server in a goroutine so that
-	// it won't block the graceful shutdown handling below
-	go func() {
-		err := srv.ListenAndServe()
+	// Listen before serving so address errors are returned
+	listeners := make([]net.Listener, 0, len(servers))
+	for _, server := range servers {
+		listener, err := net.Listen("tcp", server.Addr)
 		if err != nil {
-			log.Info().Msgf("listen: %s", address)
-		} else {
-			log.Panic().Err(err).Msg("Can't start server")
-			os.Exit(1)
+			for _, opened := range listeners {
+				opened.Close()
+			}
+
+			return fmt.Errorf("can't listen on %s: %w", server.Addr, err)
 		}
-	}()
 
-	// Wait for interrupt signal to gracefully shutdown the server with
-	// a timeout of 5 seconds.
-	quit := make(chan os.Signal)
-	// kill (no param) default send syscall.SIGTERM
-	// kill -2 is syscall.SIGINT
-	// kill -9 is syscall.SIGKILL but can't be catch, so don't need add it
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	log.Info().Msg("Shutting down server...")
+		listeners = append(listeners, listener)
+	}
 
-	// The context is used to inform the server it has 5 seconds to finish
-	// the request it is currently handling
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	go watcher.Run(watchCtx)
 
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Error().Stack().Err(err).Msg("Server forced to shutdown")
+	failed := make(chan error, len(servers))
+	for i, server := range servers {
+		server, listener := server, listeners[i]
+		go func() {
+			if err := serve(server, listener); !errors.Is(err, http.ErrServerClosed) {
+				failed <- err
+			}
+		}()
+
+		log.Info().Msgf("listen: %s", listener.Addr())
 	}
 
-	log.Info().Msg("Server exiting")
+	select {
+	case <-ctx.Done():
+		err = nil
+	case err = <-failed:
+		log.Error().Err(err).Msg("Server failed")
+	}
+
+	shutdown(servers, healthHandler, snapshot.Get().Server)
+	return err
+}
+
+// newServer creates an HTTP server with the address and limits of the configuration
+func newServer(config domain.Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              net.JoinHostPort(config.Host, config.Port),
+		Handler:           handler,
+		ReadTimeout:       time.Duration(config.Server.ReadTimeout) * time.Millisecond,
+		ReadHeaderTimeout: time.Duration(config.Server.ReadHeaderTimeout) * time.Millisecond,
+		WriteTimeout:      time.Duration(config.Server.WriteTimeout) * time.Millisecond,
+		IdleTimeout:       time.Duration(config.Server.IdleTimeout) * time.Millisecond,
+		MaxHeaderBytes:    config.Server.MaxHeaderBytes,
+	}
+}
+
+// shutdown fails the readiness probe, keeps serving for the drain period
+// so load balancers remove this instance and then finishes the requests in progress
+func shutdown(servers []*http.Server, health *handlers.HealthRESTHandler, config domain.ServerConfig) {
+	health.Drain()
+	drain := time.Duration(config.DrainPeriod) * time.Millisecond
+	log.Info().Dur("drainPeriod", drain).Msg("Shutting down server...")
+	time.Sleep(drain)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.ShutdownTimeout)*time.Millisecond)
+	defer cancel()
+
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			log.Error().Stack().Err(err).Msg("Server forced to shutdown")
+		}
+	}
 }
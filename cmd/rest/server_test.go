@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"github.com/sy-software/minerva-spear-users/internal/repositories"
+)
+
+func TestRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	dev, err := newDevMode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "config.json")
+	ioutil.WriteFile(file, []byte(`{}`), 0600)
+	configRepo := &repositories.ConfigRepo{File: file}
+
+	newConfig := func(port int) domain.Config {
+		config := domain.DefaultConfig()
+		dev.apply(&config)
+		config.Host = "127.0.0.1"
+		config.Port = strconv.Itoa(port)
+		config.Server.DrainPeriod = 500
+		if err := config.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		return config
+	}
+
+	t.Run("Test boot and shutdown", func(t *testing.T) {
+		config := newConfig(freePort(t))
+		url := "http://" + net.JoinHostPort(config.Host, config.Port) + "/readyz"
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		done := make(chan error, 1)
+		go func() { done <- run(ctx, configRepo, config, dev) }()
+
+		if status := waitForStatus(t, url, http.StatusOK); status != http.StatusOK {
+			t.Fatalf("Expected the server to be ready got: %d", status)
+		}
+
+		metricsUrl := "http://" + net.JoinHostPort(config.Host, config.Port) + "/metrics"
+		if status := waitForStatus(t, metricsUrl, http.StatusOK); status != http.StatusOK {
+			t.Errorf("Expected metrics to be served got: %d", status)
+		}
+
+		cancel()
+
+		if status := waitForStatus(t, url, http.StatusServiceUnavailable); status != http.StatusServiceUnavailable {
+			t.Errorf("Expected readiness to fail while draining got: %d", status)
+		}
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Expected shutdown without error got: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected run to return after the drain period")
+		}
+
+		if _, err := http.Get(url); err == nil {
+			t.Error("Expected the server to be closed")
+		}
+	})
+
+	t.Run("Test address in use", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+
+		config := newConfig(listener.Addr().(*net.TCPAddr).Port)
+
+		done := make(chan error, 1)
+		go func() { done <- run(context.Background(), configRepo, config, dev) }()
+
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Error("Expected a startup error")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected run to return the startup error")
+		}
+	})
+}
+
+// freePort returns a port that was free when it was checked
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// waitForStatus polls url until it answers the expected status or a second passes, returns the last status
+func waitForStatus(t *testing.T, url string, expected int) int {
+	status := 0
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		response, err := http.Get(url)
+		if err != nil {
+			continue
+		}
+
+		response.Body.Close()
+		status = response.StatusCode
+		if status == expected {
+			break
+		}
+	}
+
+	return status
+}
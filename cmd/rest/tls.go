@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+// How often the certificate files are checked for changes
+const CERT_RELOAD_INTERVAL = 10 * time.Second
+
+var tlsVersions = map[string]uint16{
+	"":    tls.VersionTLS12,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":                        tls.NoClientCert,
+	domain.ClientAuthNone:     tls.NoClientCert,
+	domain.ClientAuthOptional: tls.VerifyClientCertIfGiven,
+	domain.ClientAuthRequire:  tls.RequireAndVerifyClientCert,
+}
+
+// newTLSConfig creates the server TLS configuration, it's nil when TLS is disabled
+func newTLSConfig(config domain.TLSConfig) (*tls.Config, error) {
+	if !config.Enabled() {
+		return nil, nil
+	}
+
+	certificates, err := newCertReloader(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	version, ok := tlsVersions[config.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unknown tls.minVersion: %q", config.MinVersion)
+	}
+
+	clientAuth, ok := clientAuthTypes[config.ClientAuth]
+	if !ok {
+		return nil, fmt.Errorf("unknown tls.clientAuth: %q", config.ClientAuth)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     version,
+		ClientAuth:     clientAuth,
+		GetCertificate: certificates.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+
+	if config.DisableHTTP2 {
+		tlsConfig.NextProtos = []string{"http/1.1"}
+	}
+
+	for _, name := range config.CipherSuites {
+		id, ok := domain.CipherSuite(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown tls.cipherSuites value: %q", name)
+		}
+
+		tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+	}
+
+	if config.ClientCAFile != "" {
+		bundle, err := ioutil.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't load client CA bundle: %w", err)
+		}
+
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("no certificates found in client CA bundle: %s", config.ClientCAFile)
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// configureHTTP2 disables HTTP/2 in the server when the TLS configuration doesn't offer it,
+// the server enables it by default
+func configureHTTP2(srv *http.Server) {
+	if srv.TLSConfig == nil {
+		return
+	}
+
+	for _, proto := range srv.TLSConfig.NextProtos {
+		if proto == "h2" {
+			return
+		}
+	}
+
+	srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+}
+
+// certReloader serves the certificate and loads it again when the files change,
+// the current certificate is kept when the new files can't be loaded
+type certReloader struct {
+	certFile string
+	keyFile  string
+	now      func() time.Time
+
+	lock        sync.Mutex
+	certificate *tls.Certificate
+	modified    time.Time
+	checked     time.Time
+}
+
+func newCertReloader(certFile string, keyFile string) (*certReloader, error) {
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile, now: time.Now}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+func (reloader *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	reloader.lock.Lock()
+	defer reloader.lock.Unlock()
+
+	now := reloader.now()
+	if now.Sub(reloader.checked) >= CERT_RELOAD_INTERVAL {
+		reloader.checked = now
+		if modified, err := reloader.lastModified(); err == nil && !modified.Equal(reloader.modified) {
+			if err := reloader.load(); err != nil {
+				log.Error().Err(err).Msg("Can't reload TLS certificate, the current certificate is kept")
+			} else {
+				log.Info().Str("file", reloader.certFile).Msg("TLS certificate reloaded")
+			}
+		}
+	}
+
+	return reloader.certificate, nil
+}
+
+func (reloader *certReloader) load() error {
+	modified, err := reloader.lastModified()
+	if err != nil {
+		return fmt.Errorf("can't load TLS certificate: %w", err)
+	}
+
+	certificate, err := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+	if err != nil {
+		return fmt.Errorf("can't load TLS certificate: %w", err)
+	}
+
+	reloader.certificate = &certificate
+	reloader.modified = modified
+	reloader.checked = reloader.now()
+	return nil
+}
+
+// lastModified is the latest modification time of the certificate and key files
+func (reloader *certReloader) lastModified() (time.Time, error) {
+	latest := time.Time{}
+	for _, file := range []string{reloader.certFile, reloader.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// redirectHandler sends HTTP requests to the HTTPS port keeping the method and body
+func redirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.Trim(r.Host, "[]")
+		}
+
+		if host == "" {
+			http.Error(w, "missing host", http.StatusBadRequest)
+			return
+		}
+
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// serve accepts connections with TLS when it's configured
+func serve(srv *http.Server, listener net.Listener) error {
+	if srv.TLSConfig == nil {
+		return srv.Serve(listener)
+	}
+
+	// The certificate comes from TLSConfig.GetCertificate
+	return srv.ServeTLS(listener, "", "")
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+func TestTLSServer(t *testing.T) {
+	dir := t.TempDir()
+	serverCert := selfSignedCert(t, dir, "server")
+	selfSignedCert(t, dir, "client")
+
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCert)
+
+	clientCertificate, err := tls.LoadX509KeyPair(filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := domain.TLSConfig{
+		CertFile:   filepath.Join(dir, "server.pem"),
+		KeyFile:    filepath.Join(dir, "server-key.pem"),
+		MinVersion: "1.2",
+	}
+
+	t.Run("Test HTTP/2", func(t *testing.T) {
+		url := startTLSServer(t, settings)
+		response, err := tlsClient(roots, nil, 0).Get(url)
+
+		if err != nil {
+			t.Fatalf("Expected response without error got: %v", err)
+		}
+
+		if response.ProtoMajor != 2 {
+			t.Errorf("Expected HTTP/2 got: %s", response.Proto)
+		}
+	})
+
+	t.Run("Test HTTP/2 disabled", func(t *testing.T) {
+		http1 := settings
+		http1.DisableHTTP2 = true
+		url := startTLSServer(t, http1)
+		response, err := tlsClient(roots, nil, 0).Get(url)
+
+		if err != nil || response.ProtoMajor != 1 {
+			t.Errorf("Expected HTTP/1.1 response got: %+v %v", response, err)
+		}
+	})
+
+	t.Run("Test minimum version", func(t *testing.T) {
+		tls13 := settings
+		tls13.MinVersion = "1.3"
+		url := startTLSServer(t, tls13)
+		_, err := tlsClient(roots, nil, tls.VersionTLS12).Get(url)
+
+		if err == nil {
+			t.Error("Expected TLS 1.2 clients to be rejected")
+		}
+	})
+
+	t.Run("Test client certificates", func(t *testing.T) {
+		mtls := settings
+		mtls.ClientAuth = domain.ClientAuthRequire
+		mtls.ClientCAFile = filepath.Join(dir, "client.pem")
+		url := startTLSServer(t, mtls)
+
+		if _, err := tlsClient(roots, nil, 0).Get(url); err == nil {
+			t.Error("Expected clients without certificate to be rejected")
+		}
+
+		if _, err := tlsClient(roots, &clientCertificate, 0).Get(url); err != nil {
+			t.Errorf("Expected response without error got: %v", err)
+		}
+	})
+
+	t.Run("Test invalid settings", func(t *testing.T) {
+		cases := []domain.TLSConfig{
+			{CertFile: filepath.Join(dir, "missing.pem"), KeyFile: settings.KeyFile},
+			{CertFile: settings.CertFile, KeyFile: settings.KeyFile, ClientCAFile: filepath.Join(dir, "server-key.pem")},
+			{CertFile: settings.CertFile, KeyFile: settings.KeyFile, CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		}
+
+		for _, invalid := range cases {
+			if _, err := newTLSConfig(invalid); err == nil {
+				t.Errorf("Expected an error for: %+v", invalid)
+			}
+		}
+	})
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	first := selfSignedCert(t, dir, "server")
+
+	reloader, err := newCertReloader(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem"))
+	if err != nil {
+		t.Fatalf("Expected reloader without error got: %v", err)
+	}
+
+	now := time.Now()
+	reloader.now = func() time.Time { return now }
+
+	// Rotate the files, the modification time is moved forward
+	// because the file system could keep the same time
+	second := selfSignedCert(t, dir, "server")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "server.pem"), later, later)
+
+	current := func() *x509.Certificate {
+		certificate, _ := reloader.GetCertificate(nil)
+		parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return parsed
+	}
+
+	if !current().Equal(first) {
+		t.Error("Expected the files to be checked after the reload interval")
+	}
+
+	now = now.Add(CERT_RELOAD_INTERVAL)
+	if !current().Equal(second) {
+		t.Error("Expected the rotated certificate")
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "server.pem"), []byte("broken"), 0600)
+	later = later.Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "server.pem"), later, later)
+	now = now.Add(CERT_RELOAD_INTERVAL)
+
+	if !current().Equal(second) {
+		t.Error("Expected the current certificate to be kept when the files are invalid")
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	cases := []struct {
+		name     string
+		host     string
+		port     string
+		expected string
+	}{
+		{name: "Test custom port", host: "minerva.com:8081", port: "8443", expected: "https://minerva.com:8443/auth/me?locale=es"},
+		{name: "Test default port", host: "minerva.com", port: "443", expected: "https://minerva.com/auth/me?locale=es"},
+		{name: "Test IPv6", host: "[::1]:8081", port: "443", expected: "https://[::1]/auth/me?locale=es"},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "http://"+testCase.host+"/auth/me?locale=es", nil)
+			recorder := httptest.NewRecorder()
+
+			redirectHandler(testCase.port).ServeHTTP(recorder, request)
+
+			if recorder.Code != http.StatusPermanentRedirect {
+				t.Errorf("Expected status: %d got: %d", http.StatusPermanentRedirect, recorder.Code)
+			}
+
+			if location := recorder.Header().Get("Location"); location != testCase.expected {
+				t.Errorf("Expected location: %q got: %q", testCase.expected, location)
+			}
+		})
+	}
+}
+
+// startTLSServer serves an empty response with the TLS settings and returns its URL
+func startTLSServer(t *testing.T, settings domain.TLSConfig) string {
+	tlsConfig, err := newTLSConfig(settings)
+	if err != nil {
+		t.Fatalf("Expected TLS config without error got: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &http.Server{
+		Handler:   http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		TLSConfig: tlsConfig,
+	}
+	configureHTTP2(srv)
+
+	go srv.ServeTLS(listener, "", "")
+	t.Cleanup(func() { srv.Close() })
+
+	return "https://" + listener.Addr().String()
+}
+
+func tlsClient(roots *x509.CertPool, certificate *tls.Certificate, maxVersion uint16) *http.Client {
+	tlsConfig := &tls.Config{RootCAs: roots, MaxVersion: maxVersion}
+	if certificate != nil {
+		tlsConfig.Certificates = []tls.Certificate{*certificate}
+	}
+
+	return &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig, ForceAttemptHTTP2: true},
+	}
+}
+
+// selfSignedCert writes a certificate and its key to {name}.pem and {name}-key.pem
+func selfSignedCert(t *testing.T, dir string, name string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: raw}), 0600)
+	ioutil.WriteFile(filepath.Join(dir, name+"-key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600)
+
+	certificate, err := x509.ParseCertificate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return certificate
+}
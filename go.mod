@@ -3,12 +3,17 @@ module github.com/sy-software/minerva-spear-users
 go 1.16
 
 require (
+	github.com/fxamacker/cbor/v2 v2.3.0
 	github.com/gin-gonic/gin v1.7.3
 	github.com/google/go-cmp v0.5.6
 	github.com/lestrrat-go/jwx v1.2.4
-	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
-	github.com/modern-go/reflect2 v1.0.1 // indirect
+	github.com/lib/pq v1.10.2
+	github.com/prometheus/client_golang v1.11.1
 	github.com/rs/zerolog v1.23.0
 	github.com/shurcooL/graphql v0.0.0-20200928012149-18c5c3165e3a
 	github.com/sy-software/minerva-go-utils v0.0.0-20210818225928-36f6fc1f86fb
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
+	golang.org/x/text v0.3.6
+	gopkg.in/yaml.v2 v2.3.0
+	modernc.org/sqlite v1.17.3
 )
@@ -3,16 +3,15 @@ package domain
 import (
 	"crypto/rsa"
 	"crypto/x509"
-	"encoding/json"
 	"encoding/pem"
 	"errors"
-	"os"
-
-	"github.com/rs/zerolog/log"
+	"net/url"
+	"regexp"
 )
 
 type Token struct {
-	// Token duration in seconds, default: 7 days
+	// Token duration in seconds, default: 7 days.
+	// Access tokens are validated by the gateway, they are valid after a revocation until they expire
 	Duration int64 `json:"duration,omitempty"`
 	// Refresh Token in seconds, default: 30 days
 	RefreshDuration int64 `json:"refreshDuration,omitempty"`
@@ -32,6 +31,10 @@ func (t *Token) KeyPair() (*rsa.PrivateKey, error) {
 
 	privPem, _ := pem.Decode([]byte(t.PrivateKey))
 
+	if privPem == nil {
+		return nil, errors.New("RSA private key is not PEM encoded")
+	}
+
 	if privPem.Type != "RSA PRIVATE KEY" {
 		return nil, errors.New("RSA private key is of the wrong type")
 	}
@@ -45,6 +48,10 @@ func (t *Token) KeyPair() (*rsa.PrivateKey, error) {
 
 	pubPem, _ := pem.Decode([]byte(t.PublicKey))
 
+	if pubPem == nil {
+		return nil, errors.New("public key is not PEM encoded")
+	}
+
 	if pubPem.Type != "PUBLIC KEY" {
 		return nil, errors.New("public key is of the wrong type")
 	}
@@ -61,25 +68,206 @@ func (t *Token) KeyPair() (*rsa.PrivateKey, error) {
 		return nil, errors.New("invalid public key")
 	}
 
-	privateKey.PublicKey = *pubKey
+	if privateKey.PublicKey.N.Cmp(pubKey.N) != 0 || privateKey.PublicKey.E != pubKey.E {
+		return nil, errors.New("public key doesn't match the private key")
+	}
 
 	t.rsaKey = privateKey
 	return privateKey, nil
 }
 
+// User storage drivers set in UserRepoConfig.Driver
+const (
+	UserRepoGraphQL  = "graphql"
+	UserRepoSQLite   = "sqlite"
+	UserRepoPostgres = "postgres"
+	// Users are kept in memory and lost on restart, only meant for development
+	UserRepoMemory = "memory"
+)
+
 // UserRepoConfig contains options to connect to the user graphQL repo
 type UserRepoConfig struct {
+	// Storage backend of users and passkeys: graphql, sqlite, postgres or memory, default: graphql
+	Driver string `json:"driver,omitempty"`
 	// The user graphQL server URL
 	Url string `json:"url"`
+	// Database connection string for the sql drivers I.E.: file:users.db
+	DSN string `json:"dsn,omitempty"`
+	// Max time for each call in milliseconds, default: 5000
+	Timeout int `json:"timeout,omitempty"`
+	// Retries of read only queries after an outage or timeout, 0 disables them, default: 2
+	Retries int `json:"retries"`
+	// Delay before the first retry in milliseconds, doubled on each retry, default: 100
+	RetryBackoff int `json:"retryBackoff,omitempty"`
+	// Max delay between retries in milliseconds, default: 2000
+	RetryMaxBackoff int `json:"retryMaxBackoff,omitempty"`
+	// Consecutive outages that open the circuit breaker, 0 disables it, default: 5
+	BreakerThreshold int `json:"breakerThreshold"`
+	// Time in milliseconds the circuit stays open before trying again, default: 10000
+	BreakerCooldown int                 `json:"breakerCooldown,omitempty"`
+	Transport       HTTPTransportConfig `json:"transport"`
+	Auth            UpstreamAuthConfig  `json:"auth"`
+	Cache           CacheConfig         `json:"cache"`
+}
+
+type CacheConfig struct {
+	// Max number of cached lookups, 0 disables the cache, default: 1000
+	Size int `json:"size"`
+	// Time in seconds a user is cached, default: 30
+	TTL int `json:"ttl,omitempty"`
+	// Time in seconds a not found result is cached, default: 5
+	NegativeTTL int `json:"negativeTtl,omitempty"`
+}
+
+const (
+	UpstreamAuthNone   = "none"
+	UpstreamAuthAPIKey = "apiKey"
+	UpstreamAuthMTLS   = "mtls"
+	UpstreamAuthJWT    = "jwt"
+)
+
+// UpstreamAuthConfig selects how this service authenticates with other services
+type UpstreamAuthConfig struct {
+	// One of: none, apiKey, mtls or jwt, default: none
+	Type string `json:"type,omitempty"`
+	// Header used to send the API key, default: X-API-KEY
+	Header string `json:"header,omitempty"`
+	APIKey string `json:"apiKey,omitempty"`
+	// PEM encoded client certificate and key for mtls
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	// PEM bundle used to verify the server certificate, default: system roots
+	CAFile string `json:"caFile,omitempty"`
+	// Audience of the service JWT, it is signed with the token private key
+	Audience string `json:"audience,omitempty"`
+	// Service JWT duration in seconds, default: 60
+	TokenDuration int64 `json:"tokenDuration,omitempty"`
+}
+
+// HTTPTransportConfig tunes the connections to other services, zero values keep the Go defaults
+type HTTPTransportConfig struct {
+	MaxIdleConns        int `json:"maxIdleConns,omitempty"`
+	MaxIdleConnsPerHost int `json:"maxIdleConnsPerHost,omitempty"`
+	MaxConnsPerHost     int `json:"maxConnsPerHost,omitempty"`
+	// Timeouts in milliseconds
+	IdleConnTimeout       int `json:"idleConnTimeout,omitempty"`
+	DialTimeout           int `json:"dialTimeout,omitempty"`
+	TLSHandshakeTimeout   int `json:"tlsHandshakeTimeout,omitempty"`
+	ResponseHeaderTimeout int `json:"responseHeaderTimeout,omitempty"`
+}
+
+// WebAuthnConfig contains options for passkey registration and login
+type WebAuthnConfig struct {
+	// Relying party ID, usually the domain of the web app I.E.: minerva.com
+	RPID string `json:"rpId"`
+	// Human friendly name displayed by the authenticator
+	RPName string `json:"rpName,omitempty"`
+	// Allowed origins for the ceremonies I.E.: https://minerva.com
+	Origins []string `json:"origins"`
+	// Ceremony timeout in seconds, default: 5 minutes
+	Timeout int64 `json:"timeout,omitempty"`
+	// One of: required, preferred or discouraged, default: preferred
+	UserVerification string `json:"userVerification,omitempty"`
+	// HMAC secret of the ceremony sessions, it must be the same in every instance.
+	// When it's empty it's derived from the token private key
+	SessionSecret string `json:"sessionSecret,omitempty"`
+}
+
+// ErrorsConfig changes the format and content of the error responses
+type ErrorsConfig struct {
+	// Use the old {"error": ...} envelope instead of application/problem+json
+	Legacy bool `json:"legacy,omitempty"`
+	// Prefix of the problem type URI, the error name is appended to it
+	TypeBaseURL string `json:"typeBaseUrl,omitempty"`
+	// Locale used when the client doesn't accept any of the catalog locales, default: en
+	DefaultLocale string `json:"defaultLocale,omitempty"`
+	// Overrides of the built-in errors by name I.E.: "user-not-registered"
+	Catalog map[string]ErrorDefinition `json:"catalog,omitempty"`
+}
+
+type ErrorDefinition struct {
+	Code       int32 `json:"code,omitempty"`
+	HTTPStatus int   `json:"httpStatus,omitempty"`
+	// Message templates by locale I.E.: {"es": "el usuario no está registrado"}
+	// templates use text/template syntax and receive the error, I.E.: {{.Code}}
+	Messages map[string]string `json:"messages,omitempty"`
+}
+
+// UsernameConfig contains the rules to accept a new username
+// the rules are checked after the username is normalized with NFKC and case folding
+type UsernameConfig struct {
+	// Regular expression the normalized username must match
+	Pattern string `json:"pattern,omitempty"`
+	// Length limits in characters, default: between 3 and 32
+	MinLength int `json:"minLength,omitempty"`
+	MaxLength int `json:"maxLength,omitempty"`
+	// Names nobody can use I.E.: admin, root
+	Reserved []string `json:"reserved,omitempty"`
+	// Path to a file with one forbidden word per line, usernames containing them are rejected
+	DenyListFile string `json:"denyListFile,omitempty"`
+}
+
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// TLSConfig enables HTTPS when the certificate and key are set,
+// the files are reloaded when they change so certificates can be rotated without a restart
+type TLSConfig struct {
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	// One of: 1.2 or 1.3, default: 1.2
+	MinVersion string `json:"minVersion,omitempty"`
+	// TLS 1.2 cipher suites I.E.: TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, default: Go secure cipher suites
+	CipherSuites []string `json:"cipherSuites,omitempty"`
+	// Client certificates verification, one of: none, optional or require, default: none
+	ClientAuth string `json:"clientAuth,omitempty"`
+	// PEM bundle used to verify client certificates
+	ClientCAFile string `json:"clientCaFile,omitempty"`
+	// HTTP/2 is negotiated with ALPN unless it's disabled
+	DisableHTTP2 bool `json:"disableHttp2,omitempty"`
+	// Port of a plain HTTP listener redirecting to HTTPS, disabled when empty
+	RedirectPort string `json:"redirectPort,omitempty"`
+}
+
+// Enabled reports if the server uses HTTPS
+func (config TLSConfig) Enabled() bool {
+	return config.CertFile != "" || config.KeyFile != ""
+}
+
+// ServerConfig tunes the HTTP server and its shutdown, durations in milliseconds
+type ServerConfig struct {
+	// Time to read the whole request, including the body
+	ReadTimeout       int `json:"readTimeout,omitempty"`
+	ReadHeaderTimeout int `json:"readHeaderTimeout,omitempty"`
+	WriteTimeout      int `json:"writeTimeout,omitempty"`
+	// Time to keep idle keep-alive connections
+	IdleTimeout int `json:"idleTimeout,omitempty"`
+	// Maximum size of the request headers in bytes
+	MaxHeaderBytes int `json:"maxHeaderBytes,omitempty"`
+	// Time serving requests after readiness fails on shutdown,
+	// so load balancers stop sending new requests before the server closes
+	DrainPeriod int `json:"drainPeriod,omitempty"`
+	// Time to finish the requests in progress on shutdown
+	ShutdownTimeout int `json:"shutdownTimeout,omitempty"`
 }
 
 // Config all options required by this service to run
 type Config struct {
 	Token     Token          `json:"token"`
 	UserRepo  UserRepoConfig `json:"userRepo"`
+	WebAuthn  WebAuthnConfig `json:"webAuthn"`
+	Username  UsernameConfig `json:"username"`
 	Host      string         `json:"host,omitempty"`
 	Port      string         `json:"port,omitempty"`
 	APIPrefix string         `json:"apiPrefix,omitempty"`
+	// Roles allowed to use the admin endpoints, default: admin
+	AdminRoles []string     `json:"adminRoles,omitempty"`
+	Errors     ErrorsConfig `json:"errors"`
+	TLS        TLSConfig    `json:"tls"`
+	Server     ServerConfig `json:"server"`
 }
 
 // DefaultConfig returns a configuration object with the default values
@@ -89,24 +277,97 @@ func DefaultConfig() Config {
 			Duration:        7 * 24 * 60 * 60,  // 7 days
 			RefreshDuration: 30 * 24 * 60 * 60, // 30 days
 		},
-		Host:      "0.0.0.0",
-		Port:      "8080",
-		APIPrefix: "/auth",
+		UserRepo: UserRepoConfig{
+			Driver:           UserRepoGraphQL,
+			Timeout:          5000,
+			Retries:          2,
+			RetryBackoff:     100,
+			RetryMaxBackoff:  2000,
+			BreakerThreshold: 5,
+			BreakerCooldown:  10000,
+			Transport: HTTPTransportConfig{
+				MaxIdleConnsPerHost: 10,
+			},
+			Auth: UpstreamAuthConfig{
+				Type:          UpstreamAuthNone,
+				Header:        "X-API-KEY",
+				Audience:      "minerva/owl",
+				TokenDuration: 60,
+			},
+			Cache: CacheConfig{
+				Size:        1000,
+				TTL:         30,
+				NegativeTTL: 5,
+			},
+		},
+		WebAuthn: WebAuthnConfig{
+			RPName:           "Minerva",
+			Timeout:          5 * 60, // 5 minutes
+			UserVerification: "preferred",
+		},
+		Username: UsernameConfig{
+			// Only ASCII after normalization, this rejects most homoglyphs
+			Pattern:   "^[a-z0-9][a-z0-9_.-]*$",
+			MinLength: 3,
+			MaxLength: 32,
+			Reserved: []string{
+				"admin", "administrator", "root", "system", "support", "help",
+				"minerva", "spear", "auth", "api", "me", "null", "undefined",
+			},
+		},
+		Host:       "0.0.0.0",
+		Port:       "8080",
+		APIPrefix:  "/auth",
+		AdminRoles: []string{"admin"},
+		Errors: ErrorsConfig{
+			TypeBaseURL:   "urn:minerva:spear:error:",
+			DefaultLocale: "en",
+		},
+		TLS: TLSConfig{
+			MinVersion: "1.2",
+			ClientAuth: ClientAuthNone,
+		},
+		Server: ServerConfig{
+			ReadTimeout:       15000,
+			ReadHeaderTimeout: 5000,
+			WriteTimeout:      30000,
+			IdleTimeout:       60000,
+			MaxHeaderBytes:    1 << 20, // 1 MB
+			DrainPeriod:       5000,
+			ShutdownTimeout:   5000,
+		},
 	}
 }
 
-// LoadConfiguration reads configuration from the specified json file
-func LoadConfiguration(file string) Config {
-	config := DefaultConfig()
-	configFile, err := os.Open(file)
+// Replaces the secrets of a redacted configuration
+const REDACTED = "REDACTED"
 
-	if err != nil {
-		log.Warn().Err(err).Msg("Can't load config file. Default values will be used instead")
+// Passwords in key=value connection strings I.E.: host=db password=secret
+var dsnPasswordPattern = regexp.MustCompile(`(?i)(password\s*=\s*)('[^']*'|\S+)`)
+
+// Redacted returns a copy of the configuration without secrets, safe to print or log
+func (config Config) Redacted() Config {
+	redacted := config
+	redacted.Token.rsaKey = nil
+	redacted.Token.PrivateKey = redact(config.Token.PrivateKey)
+	redacted.UserRepo.Auth.APIKey = redact(config.UserRepo.Auth.APIKey)
+	redacted.WebAuthn.SessionSecret = redact(config.WebAuthn.SessionSecret)
+
+	redacted.UserRepo.DSN = dsnPasswordPattern.ReplaceAllString(config.UserRepo.DSN, "${1}"+REDACTED)
+	if dsn, err := url.Parse(config.UserRepo.DSN); err == nil && dsn.User != nil {
+		if _, hasPassword := dsn.User.Password(); hasPassword {
+			dsn.User = url.UserPassword(dsn.User.Username(), REDACTED)
+			redacted.UserRepo.DSN = dsn.String()
+		}
 	}
 
-	defer configFile.Close()
+	return redacted
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
 
-	jsonParser := json.NewDecoder(configFile)
-	jsonParser.Decode(&config)
-	return config
+	return REDACTED
 }
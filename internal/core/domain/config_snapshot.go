@@ -0,0 +1,33 @@
+package domain
+
+import "sync/atomic"
+
+// ConfigSnapshot holds the current configuration, reloads replace it atomically
+// so every request reads a consistent configuration. It's safe for concurrent use
+type ConfigSnapshot struct {
+	value atomic.Value
+}
+
+// NewConfigSnapshot creates a ConfigSnapshot with the initial configuration
+func NewConfigSnapshot(config Config) *ConfigSnapshot {
+	snapshot := &ConfigSnapshot{}
+	snapshot.Set(config)
+	return snapshot
+}
+
+// Get returns the current configuration, it's shared and must not be modified
+func (snapshot *ConfigSnapshot) Get() *Config {
+	return snapshot.value.Load().(*Config)
+}
+
+// Loaded reports if the snapshot holds a configuration
+func (snapshot *ConfigSnapshot) Loaded() bool {
+	return snapshot.value.Load() != nil
+}
+
+// Set replaces the current configuration, the token keys are parsed first
+// so readers never write the parsed key cache
+func (snapshot *ConfigSnapshot) Set(config Config) {
+	config.Token.KeyPair()
+	snapshot.value.Store(&config)
+}
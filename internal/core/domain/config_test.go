@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"testing"
+)
+
+func TestConfigRedacted(t *testing.T) {
+	dsns := map[string]string{
+		"postgres://spear:secret@db/users":     "postgres://spear:REDACTED@db/users",
+		"host=db user=spear password='secret'": "host=db user=spear password=REDACTED",
+		"host=db password=secret sslmode=none": "host=db password=REDACTED sslmode=none",
+		"file:users.db":                        "file:users.db",
+	}
+
+	for dsn, expected := range dsns {
+		config := DefaultConfig()
+		config.Token.PrivateKey = "private"
+		config.UserRepo.Auth.APIKey = "key"
+		config.UserRepo.DSN = dsn
+
+		redacted := config.Redacted()
+
+		if redacted.UserRepo.DSN != expected {
+			t.Errorf("Expected DSN: %q got: %q", expected, redacted.UserRepo.DSN)
+		}
+
+		if redacted.Token.PrivateKey != REDACTED || redacted.UserRepo.Auth.APIKey != REDACTED {
+			t.Errorf("Expected secrets to be redacted got: %+v", redacted)
+		}
+
+		if config.Token.PrivateKey != "private" {
+			t.Error("Expected the original configuration to be kept")
+		}
+	}
+}
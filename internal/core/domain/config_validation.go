@@ -0,0 +1,274 @@
+package domain
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// API prefixes are empty or absolute paths without a trailing slash I.E.: /auth, /api/v1/auth
+var apiPrefixPattern = regexp.MustCompile(`^(/[A-Za-z0-9._~-]+)*$`)
+
+// ConfigError contains every problem found in a configuration
+type ConfigError struct {
+	Fields []FieldError
+}
+
+func (e *ConfigError) Error() string {
+	problems := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		problems = append(problems, fmt.Sprintf("  - %s: %s", field.Field, field.Message))
+	}
+
+	return fmt.Sprintf("invalid configuration, %d problems found:\n%s", len(e.Fields), strings.Join(problems, "\n"))
+}
+
+func (e *ConfigError) Unwrap() error {
+	return ErrValidation
+}
+
+// configChecks collects the broken rules of a configuration
+type configChecks []FieldError
+
+func (checks *configChecks) add(field string, rule string, message string, args ...interface{}) {
+	*checks = append(*checks, FieldError{Field: field, Rule: rule, Message: fmt.Sprintf(message, args...)})
+}
+
+func (checks *configChecks) positive(field string, value int64) {
+	if value <= 0 {
+		checks.add(field, "positive", "must be greater than 0, got %d", value)
+	}
+}
+
+func (checks *configChecks) notNegative(field string, value int64) {
+	if value < 0 {
+		checks.add(field, "not_negative", "can't be negative, got %d", value)
+	}
+}
+
+func (checks *configChecks) required(field string, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		checks.add(field, "required", "is required")
+		return false
+	}
+
+	return true
+}
+
+func (checks *configChecks) oneOf(field string, value string, allowed ...string) {
+	for _, option := range allowed {
+		if value == option {
+			return
+		}
+	}
+
+	checks.add(field, "one_of", "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+func (checks *configChecks) httpURL(field string, value string) {
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		checks.add(field, "url", "must be an http or https URL, got %q", value)
+	}
+}
+
+// Validate checks the configuration and returns a *ConfigError with all the problems found
+func (config *Config) Validate() error {
+	checks := configChecks{}
+
+	config.validateToken(&checks)
+	config.validateUserRepo(&checks)
+	config.validateServer(&checks)
+	config.validateTLS(&checks)
+
+	checks.positive("webAuthn.timeout", config.WebAuthn.Timeout)
+	checks.oneOf("webAuthn.userVerification", config.WebAuthn.UserVerification, "required", "preferred", "discouraged")
+	for i, origin := range config.WebAuthn.Origins {
+		checks.httpURL(fmt.Sprintf("webAuthn.origins[%d]", i), origin)
+	}
+
+	config.validateUsername(&checks)
+
+	if len(config.AdminRoles) == 0 {
+		checks.add("adminRoles", "required", "at least one role is required")
+	}
+
+	if len(checks) > 0 {
+		return &ConfigError{Fields: checks}
+	}
+
+	return nil
+}
+
+func (config *Config) validateToken(checks *configChecks) {
+	checks.positive("token.duration", config.Token.Duration)
+	checks.positive("token.refreshDuration", config.Token.RefreshDuration)
+	if config.Token.RefreshDuration < config.Token.Duration {
+		checks.add("token.refreshDuration", "min", "must be at least token.duration, got %d", config.Token.RefreshDuration)
+	}
+
+	privateKey := checks.required("token.privateKey", config.Token.PrivateKey)
+	publicKey := checks.required("token.publicKey", config.Token.PublicKey)
+	if privateKey && publicKey {
+		if _, err := config.Token.KeyPair(); err != nil {
+			checks.add("token", "key_pair", "%v", err)
+		}
+	}
+}
+
+func (config *Config) validateUserRepo(checks *configChecks) {
+	repo := config.UserRepo
+
+	switch repo.Driver {
+	case "", UserRepoGraphQL:
+		checks.httpURL("userRepo.url", repo.Url)
+	case UserRepoSQLite, UserRepoPostgres:
+		checks.required("userRepo.dsn", repo.DSN)
+	case UserRepoMemory:
+	default:
+		checks.oneOf("userRepo.driver", repo.Driver, UserRepoGraphQL, UserRepoSQLite, UserRepoPostgres, UserRepoMemory)
+	}
+
+	checks.positive("userRepo.timeout", int64(repo.Timeout))
+	checks.notNegative("userRepo.retries", int64(repo.Retries))
+	checks.notNegative("userRepo.retryBackoff", int64(repo.RetryBackoff))
+	checks.notNegative("userRepo.retryMaxBackoff", int64(repo.RetryMaxBackoff))
+	checks.notNegative("userRepo.breakerThreshold", int64(repo.BreakerThreshold))
+	checks.notNegative("userRepo.breakerCooldown", int64(repo.BreakerCooldown))
+	checks.notNegative("userRepo.cache.size", int64(repo.Cache.Size))
+	checks.notNegative("userRepo.cache.ttl", int64(repo.Cache.TTL))
+	checks.notNegative("userRepo.cache.negativeTtl", int64(repo.Cache.NegativeTTL))
+
+	switch repo.Auth.Type {
+	case "", UpstreamAuthNone:
+	case UpstreamAuthAPIKey:
+		checks.required("userRepo.auth.header", repo.Auth.Header)
+		checks.required("userRepo.auth.apiKey", repo.Auth.APIKey)
+	case UpstreamAuthMTLS:
+		checks.required("userRepo.auth.certFile", repo.Auth.CertFile)
+		checks.required("userRepo.auth.keyFile", repo.Auth.KeyFile)
+	case UpstreamAuthJWT:
+		checks.required("userRepo.auth.audience", repo.Auth.Audience)
+		checks.positive("userRepo.auth.tokenDuration", repo.Auth.TokenDuration)
+	default:
+		checks.oneOf("userRepo.auth.type", repo.Auth.Type, UpstreamAuthNone, UpstreamAuthAPIKey, UpstreamAuthMTLS, UpstreamAuthJWT)
+	}
+}
+
+func (config *Config) validateUsername(checks *configChecks) {
+	rules := config.Username
+
+	if _, err := regexp.Compile(rules.Pattern); err != nil {
+		checks.add("username.pattern", "regexp", "is not a valid regular expression: %v", err)
+	}
+
+	checks.positive("username.minLength", int64(rules.MinLength))
+	if rules.MaxLength < rules.MinLength {
+		checks.add("username.maxLength", "min", "must be at least username.minLength, got %d", rules.MaxLength)
+	}
+
+	for i, name := range rules.Reserved {
+		checks.required(fmt.Sprintf("username.reserved[%d]", i), name)
+	}
+
+	if rules.DenyListFile != "" {
+		checks.readableFile("username.denyListFile", rules.DenyListFile)
+	}
+}
+
+// readableFile checks a text file can be read line by line
+func (checks *configChecks) readableFile(field string, path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		checks.add(field, "file", "can't be read: %v", err)
+		return
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+	}
+
+	if err := scanner.Err(); err != nil {
+		checks.add(field, "file", "can't be read: %v", err)
+	}
+}
+
+func (checks *configChecks) port(field string, value string) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		checks.add(field, "port", "must be a number between 1 and 65535, got %q", value)
+	}
+}
+
+func (config *Config) validateServer(checks *configChecks) {
+	checks.port("port", config.Port)
+
+	if !apiPrefixPattern.MatchString(config.APIPrefix) {
+		checks.add("apiPrefix", "pattern", "must start with / and not end with / I.E.: /auth, got %q", config.APIPrefix)
+	}
+
+	server := config.Server
+	checks.notNegative("server.readTimeout", int64(server.ReadTimeout))
+	checks.notNegative("server.readHeaderTimeout", int64(server.ReadHeaderTimeout))
+	checks.notNegative("server.writeTimeout", int64(server.WriteTimeout))
+	checks.notNegative("server.idleTimeout", int64(server.IdleTimeout))
+	checks.notNegative("server.maxHeaderBytes", int64(server.MaxHeaderBytes))
+	checks.notNegative("server.drainPeriod", int64(server.DrainPeriod))
+	checks.positive("server.shutdownTimeout", int64(server.ShutdownTimeout))
+}
+
+func (config *Config) validateTLS(checks *configChecks) {
+	settings := config.TLS
+
+	checks.oneOf("tls.minVersion", settings.MinVersion, "", "1.2", "1.3")
+	checks.oneOf("tls.clientAuth", settings.ClientAuth, "", ClientAuthNone, ClientAuthOptional, ClientAuthRequire)
+	for i, name := range settings.CipherSuites {
+		if _, ok := CipherSuite(name); !ok {
+			checks.add(fmt.Sprintf("tls.cipherSuites[%d]", i), "cipher_suite", "is not a secure TLS 1.2 cipher suite, got %q", name)
+		}
+	}
+
+	if !settings.Enabled() {
+		if settings.RedirectPort != "" {
+			checks.add("tls.redirectPort", "tls", "needs tls.certFile and tls.keyFile")
+		}
+
+		if settings.ClientAuth != "" && settings.ClientAuth != ClientAuthNone {
+			checks.add("tls.clientAuth", "tls", "needs tls.certFile and tls.keyFile")
+		}
+
+		return
+	}
+
+	checks.required("tls.certFile", settings.CertFile)
+	checks.required("tls.keyFile", settings.KeyFile)
+
+	if settings.ClientAuth == ClientAuthOptional || settings.ClientAuth == ClientAuthRequire {
+		checks.required("tls.clientCaFile", settings.ClientCAFile)
+	}
+
+	if settings.RedirectPort != "" {
+		checks.port("tls.redirectPort", settings.RedirectPort)
+		if settings.RedirectPort == config.Port {
+			checks.add("tls.redirectPort", "port", "must be different from port, got %q", settings.RedirectPort)
+		}
+	}
+}
+
+// CipherSuite returns the ID of a secure cipher suite by name
+func CipherSuite(name string) (uint16, bool) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return suite.ID, true
+		}
+	}
+
+	return 0, false
+}
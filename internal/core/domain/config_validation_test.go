@@ -0,0 +1,187 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	key := generateKey(t)
+	otherKey := generateKey(t)
+
+	validConfig := func() Config {
+		config := DefaultConfig()
+		config.UserRepo.Url = "http://owl:8080/graphql"
+		config.Token.PrivateKey, config.Token.PublicKey = encodeKeys(t, key, &key.PublicKey)
+		return config
+	}
+
+	t.Run("Test valid configuration", func(t *testing.T) {
+		config := validConfig()
+
+		if err := config.Validate(); err != nil {
+			t.Errorf("Expected valid configuration got: %v", err)
+		}
+	})
+
+	t.Run("Test every problem is reported", func(t *testing.T) {
+		config := validConfig()
+		config.Token.Duration = 0
+		config.UserRepo.Url = "owl:8080"
+		config.Port = "http"
+		config.APIPrefix = "/auth/"
+
+		err := config.Validate()
+
+		var configError *ConfigError
+		if !errors.As(err, &configError) || !errors.Is(err, ErrValidation) {
+			t.Fatalf("Expected a ConfigError got: %v", err)
+		}
+
+		fields := map[string]bool{}
+		for _, field := range configError.Fields {
+			fields[field.Field] = true
+		}
+
+		for _, field := range []string{"token.duration", "userRepo.url", "port", "apiPrefix"} {
+			if !fields[field] {
+				t.Errorf("Expected problem with %s got: %v", field, err)
+			}
+		}
+	})
+
+	t.Run("Test username rules", func(t *testing.T) {
+		config := validConfig()
+		config.Username.Pattern = "["
+		config.Username.DenyListFile = filepath.Join(t.TempDir(), "missing.txt")
+
+		err := config.Validate()
+
+		var configError *ConfigError
+		if !errors.As(err, &configError) {
+			t.Fatalf("Expected a ConfigError got: %v", err)
+		}
+
+		fields := map[string]bool{}
+		for _, field := range configError.Fields {
+			fields[field.Field] = true
+		}
+
+		for _, field := range []string{"username.pattern", "username.denyListFile"} {
+			if !fields[field] {
+				t.Errorf("Expected problem with %s got: %v", field, err)
+			}
+		}
+	})
+
+	t.Run("Test deny list file", func(t *testing.T) {
+		config := validConfig()
+		config.Username.DenyListFile = filepath.Join(t.TempDir(), "deny.txt")
+
+		if err := ioutil.WriteFile(config.Username.DenyListFile, []byte("# Reserved\nroot\n"), 0600); err != nil {
+			t.Fatalf("Expected deny list to be written got: %v", err)
+		}
+
+		if err := config.Validate(); err != nil {
+			t.Errorf("Expected valid configuration got: %v", err)
+		}
+	})
+
+	t.Run("Test keys", func(t *testing.T) {
+		privateKey, otherPublicKey := encodeKeys(t, key, &otherKey.PublicKey)
+
+		cases := []struct {
+			name       string
+			privateKey string
+			publicKey  string
+		}{
+			{name: "Test missing keys"},
+			{name: "Test not PEM encoded", privateKey: "private", publicKey: "public"},
+			{name: "Test keys don't match", privateKey: privateKey, publicKey: otherPublicKey},
+		}
+
+		for _, testCase := range cases {
+			t.Run(testCase.name, func(t *testing.T) {
+				config := validConfig()
+				config.Token = Token{
+					Duration:        config.Token.Duration,
+					RefreshDuration: config.Token.RefreshDuration,
+					PrivateKey:      testCase.privateKey,
+					PublicKey:       testCase.publicKey,
+				}
+
+				if err := config.Validate(); err == nil {
+					t.Error("Expected invalid keys to be reported")
+				}
+			})
+		}
+	})
+
+	t.Run("Test TLS", func(t *testing.T) {
+		cases := []struct {
+			name  string
+			tls   TLSConfig
+			field string
+		}{
+			{name: "Test missing key", tls: TLSConfig{CertFile: "cert.pem"}, field: "tls.keyFile"},
+			{name: "Test unknown version", tls: TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", MinVersion: "1.0"}, field: "tls.minVersion"},
+			{name: "Test insecure cipher suite", tls: TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}, field: "tls.cipherSuites[0]"},
+			{name: "Test client auth without CA", tls: TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", ClientAuth: ClientAuthRequire}, field: "tls.clientCaFile"},
+			{name: "Test redirect without TLS", tls: TLSConfig{RedirectPort: "8081"}, field: "tls.redirectPort"},
+			{name: "Test redirect to the same port", tls: TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", RedirectPort: "8080"}, field: "tls.redirectPort"},
+		}
+
+		for _, testCase := range cases {
+			t.Run(testCase.name, func(t *testing.T) {
+				config := validConfig()
+				config.TLS = testCase.tls
+
+				var configError *ConfigError
+				if err := config.Validate(); !errors.As(err, &configError) || configError.Fields[0].Field != testCase.field {
+					t.Errorf("Expected problem with %s got: %v", testCase.field, err)
+				}
+			})
+		}
+	})
+
+	t.Run("Test driver options", func(t *testing.T) {
+		config := validConfig()
+		config.UserRepo.Url = ""
+		config.UserRepo.Driver = UserRepoMemory
+
+		if err := config.Validate(); err != nil {
+			t.Errorf("Expected memory driver without URL got: %v", err)
+		}
+
+		config.UserRepo.Driver = UserRepoSQLite
+
+		if err := config.Validate(); err == nil {
+			t.Error("Expected sqlite driver to require a DSN")
+		}
+	})
+}
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func encodeKeys(t *testing.T, key *rsa.PrivateKey, publicKey *rsa.PublicKey) (string, string) {
+	publicBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicBytes}))
+}
@@ -0,0 +1,23 @@
+package domain
+
+import "context"
+
+type contextKey string
+
+const requestIdKey contextKey = "requestId"
+
+// WithRequestId returns a copy of the context carrying the request ID,
+// repositories forward it to other services so calls can be traced
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	if requestId == "" {
+		return ctx
+	}
+
+	return context.WithValue(ctx, requestIdKey, requestId)
+}
+
+// RequestId returns the request ID stored in the context or an empty string
+func RequestId(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey).(string)
+	return requestId
+}
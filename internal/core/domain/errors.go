@@ -0,0 +1,16 @@
+package domain
+
+import "errors"
+
+// Errors returned by the repositories, use errors.Is to check them
+// as repositories wrap them with the original cause
+var (
+	// ErrNotFound the requested record doesn't exist
+	ErrNotFound = errors.New("not_found")
+	// ErrDuplicate a record with the same unique values already exists
+	ErrDuplicate = errors.New("duplicated_value")
+	// ErrUnavailable the storage can't be reached or is failing
+	ErrUnavailable = errors.New("unavailable")
+	// ErrTimeout the storage took too long to answer
+	ErrTimeout = errors.New("timeout")
+)
@@ -1,6 +1,26 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+// Account status values
+const (
+	UserActive    = "active"
+	UserSuspended = "suspended"
+	// Soft deleted, the account can still be restored by an admin
+	UserDeleted = "deleted"
+)
+
+var (
+	// ErrUserNotActive is returned when a suspended or deleted user tries to use the service
+	ErrUserNotActive = errors.New("user_not_active")
+	// ErrUsernameTaken is returned when a username belongs to other user
+	ErrUsernameTaken = errors.New("username_taken")
+	// ErrInvalidToken is returned when a token can't be verified, expired or has other use
+	ErrInvalidToken = errors.New("invalid_token")
+)
 
 type User struct {
 	Id string `json:"id,omitempty"`
@@ -10,6 +30,20 @@ type User struct {
 	Name string `json:"name,omitempty"`
 	// Optional url of the user display image
 	Picture string `json:"picture,omitempty"`
+	// For RBAC operations
+	Role string `json:"role,omitempty"`
+	// The OAuth2 provider used by this user
+	Provider string `json:"provider,omitempty"`
+	// Account status I.E.: active, suspended, deleted
+	Status string `json:"status,omitempty"`
+	// Incremented to revoke the tokens issued to the user, tokens carry the version they were issued with
+	TokenVersion int `json:"-"`
+}
+
+// IsActive reports if the user is allowed to login
+// users created before status was tracked have no status and are considered active
+func (user *User) IsActive() bool {
+	return user.Status == "" || user.Status == UserActive
 }
 
 type Login struct {
@@ -48,3 +82,35 @@ type UserToken struct {
 	// The user full info
 	Info User `json:"info"`
 }
+
+// UserUpdate contains the user fields to change, nil fields are left untouched
+type UserUpdate struct {
+	// User screen name, used for login
+	Username *string `json:"username,omitempty"`
+	// User real name
+	Name *string `json:"name,omitempty"`
+	// Optional url of the user display image
+	Picture *string `json:"picture,omitempty"`
+	// For RBAC operations
+	Role *string `json:"role,omitempty"`
+}
+
+// UserFilter selects a page of users, empty fields are not used to filter
+type UserFilter struct {
+	Provider string `json:"provider,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Role     string `json:"role,omitempty"`
+	// Page number starting at 1
+	Page int `json:"page"`
+	// How many users per page
+	PageSize int `json:"pageSize"`
+}
+
+// UserPage is a page of users matching a UserFilter
+type UserPage struct {
+	Items    []User `json:"items"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"pageSize"`
+	// Total users matching the filter
+	Total int `json:"total"`
+}
@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrValidation is wrapped by every ValidationError
+var ErrValidation = errors.New("validation_failed")
+
+// FieldError describes a rule broken by a request field
+type FieldError struct {
+	// The request field name I.E.: username
+	Field string `json:"field"`
+	// The broken rule I.E.: min_length, pattern, reserved
+	Rule string `json:"rule"`
+	// Human friendly description of the rule
+	Message string `json:"message"`
+}
+
+// ValidationError contains all the rules broken by a request
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	rules := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		rules = append(rules, fmt.Sprintf("%s: %s", field.Field, field.Rule))
+	}
+
+	return fmt.Sprintf("%s: %s", ErrValidation, strings.Join(rules, ", "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
@@ -0,0 +1,159 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCredential is returned when a WebAuthn ceremony can't be verified
+var ErrInvalidCredential = errors.New("invalid_credential")
+
+// Base64URL holds binary WebAuthn values, they travel as unpadded base64url strings
+type Base64URL []byte
+
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+
+	// Some clients keep the padding, we accept both forms
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return err
+	}
+
+	*b = decoded
+	return nil
+}
+
+// String returns the unpadded base64url representation
+func (b Base64URL) String() string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Credential is a passkey public key registered by a user
+type Credential struct {
+	// The credential ID as unpadded base64url
+	Id string `json:"id,omitempty"`
+	// The owner of this credential
+	UserId string `json:"userId,omitempty"`
+	// COSE encoded public key
+	PublicKey []byte `json:"publicKey,omitempty"`
+	// Authenticator signature counter, used to detect cloned authenticators
+	SignCount uint32 `json:"signCount"`
+	// Hints about how the client can reach the authenticator I.E.: usb, nfc, internal
+	Transports []string `json:"transports,omitempty"`
+	// When was this credential registered
+	CreatedAt time.Time `json:"createdAt,omitempty"`
+}
+
+// RelyingParty identifies this service to the authenticator
+type RelyingParty struct {
+	Id   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+// CredentialUser is the account a new credential will be bound to
+type CredentialUser struct {
+	Id          Base64URL `json:"id"`
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+}
+
+// CredentialParameter is an accepted public key algorithm
+type CredentialParameter struct {
+	Type string `json:"type"`
+	// COSE algorithm identifier I.E.: -7 for ES256
+	Alg int64 `json:"alg"`
+}
+
+// CredentialDescriptor references an existing credential
+type CredentialDescriptor struct {
+	Type       string    `json:"type"`
+	Id         Base64URL `json:"id"`
+	Transports []string  `json:"transports,omitempty"`
+}
+
+// AuthenticatorSelection constraints the kind of authenticator the user can use
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey,omitempty"`
+	UserVerification string `json:"userVerification,omitempty"`
+}
+
+// CreationOptions maps to the browser PublicKeyCredentialCreationOptions
+type CreationOptions struct {
+	Challenge              Base64URL              `json:"challenge"`
+	RelyingParty           RelyingParty           `json:"rp"`
+	User                   CredentialUser         `json:"user"`
+	Parameters             []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout,omitempty"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation,omitempty"`
+}
+
+// RequestOptions maps to the browser PublicKeyCredentialRequestOptions
+type RequestOptions struct {
+	Challenge        Base64URL              `json:"challenge"`
+	Timeout          int64                  `json:"timeout,omitempty"`
+	RelyingPartyId   string                 `json:"rpId,omitempty"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                 `json:"userVerification,omitempty"`
+}
+
+// CredentialCreation starts a registration ceremony
+type CredentialCreation struct {
+	// Signed ceremony state, must be sent back when the ceremony finishes
+	Session   string          `json:"session"`
+	PublicKey CreationOptions `json:"publicKey"`
+}
+
+// CredentialAssertion starts a login ceremony
+type CredentialAssertion struct {
+	// Signed ceremony state, must be sent back when the ceremony finishes
+	Session   string         `json:"session"`
+	PublicKey RequestOptions `json:"publicKey"`
+}
+
+// AttestationResponse is the authenticator answer to a registration ceremony
+type AttestationResponse struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AttestationObject Base64URL `json:"attestationObject"`
+	Transports        []string  `json:"transports,omitempty"`
+}
+
+// AssertionResponse is the authenticator answer to a login ceremony
+type AssertionResponse struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AuthenticatorData Base64URL `json:"authenticatorData"`
+	Signature         Base64URL `json:"signature"`
+	UserHandle        Base64URL `json:"userHandle,omitempty"`
+}
+
+// RegistrationCredential is the PublicKeyCredential returned by navigator.credentials.create
+type RegistrationCredential struct {
+	// The session returned by the begin registration step
+	Session  string              `json:"session"`
+	Id       string              `json:"id"`
+	RawId    Base64URL           `json:"rawId"`
+	Type     string              `json:"type"`
+	Response AttestationResponse `json:"response"`
+}
+
+// LoginCredential is the PublicKeyCredential returned by navigator.credentials.get
+type LoginCredential struct {
+	// The session returned by the begin login step
+	Session  string            `json:"session"`
+	Id       string            `json:"id"`
+	RawId    Base64URL         `json:"rawId"`
+	Type     string            `json:"type"`
+	Response AssertionResponse `json:"response"`
+}
@@ -1,15 +1,56 @@
 package ports
 
-import "github.com/sy-software/minerva-spear-users/internal/core/domain"
+import (
+	"context"
+	"time"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
 
 // UserRepo handles interaction with user related storage operations
 type UserRepo interface {
 	// Create saves a new user
-	Create(user domain.Register) (domain.User, error)
+	Create(ctx context.Context, user domain.Register) (domain.User, error)
 	// GetById looks for a user with the provided ID
-	GetById(id string) (domain.User, error)
+	GetById(ctx context.Context, id string) (domain.User, error)
 	// GetByUsernamelooks for a user with the provided username
-	GetByUsername(username string) (domain.User, error)
+	GetByUsername(ctx context.Context, username string) (domain.User, error)
+	// List returns a page of users matching the filter
+	List(ctx context.Context, filter domain.UserFilter) (domain.UserPage, error)
+	// Update changes the editable fields of a user
+	Update(ctx context.Context, id string, update domain.UserUpdate) (domain.User, error)
+	// UpdateStatus changes the account status of a user
+	UpdateStatus(ctx context.Context, id string, status string) (domain.User, error)
+	// RevokeTokens increments the token version of a user so the tokens issued before are rejected
+	RevokeTokens(ctx context.Context, id string) (domain.User, error)
+	// Delete permanently removes a user and the records linked to it
+	Delete(ctx context.Context, id string) error
+}
+
+// Pinger is implemented by the storages that can check their connection
+type Pinger interface {
+	// Ping checks the storage can be reached without reading any data
+	Ping(ctx context.Context) error
+}
+
+// CredentialRepo handles storage of passkey public keys
+type CredentialRepo interface {
+	// Create saves a new credential
+	Create(ctx context.Context, credential domain.Credential) (domain.Credential, error)
+	// GetById looks for a credential with the provided ID
+	GetById(ctx context.Context, id string) (domain.Credential, error)
+	// GetByUser returns all the credentials registered by a user
+	GetByUser(ctx context.Context, userId string) ([]domain.Credential, error)
+	// UpdateSignCount stores the last signature counter reported by the authenticator
+	UpdateSignCount(ctx context.Context, id string, signCount uint32) error
+	// DeleteByUser removes all the credentials registered by a user
+	DeleteByUser(ctx context.Context, userId string) error
+}
+
+// ChallengeRepo remembers the WebAuthn challenges already answered so a ceremony can't be replayed
+type ChallengeRepo interface {
+	// Use marks a challenge as used until it expires, returns domain.ErrDuplicate when it was already used
+	Use(ctx context.Context, challenge string, expire time.Time) error
 }
 
 // ConfigRepository provides connection to our config server
@@ -1,15 +1,57 @@
 package ports
 
-import "github.com/sy-software/minerva-spear-users/internal/core/domain"
+import (
+	"context"
+	"crypto/rsa"
+
+	"github.com/lestrrat-go/jwx/jwt"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
 
 // AuthService handle all action related to user life cycle
 type AuthService interface {
 	// Creates a minerva JWT for a user validated by an OAuth provider
-	Login(request domain.Login) (domain.UserToken, error)
+	Login(ctx context.Context, request domain.Login) (domain.UserToken, error)
 	// Registers a user validated by an OAuth provider into minerva platform
-	Register(request domain.Register) (domain.UserToken, error)
+	Register(ctx context.Context, request domain.Register) (domain.UserToken, error)
 	// Refresh the current user token
-	Refresh(refreshToken string) (domain.UserToken, error)
+	Refresh(ctx context.Context, refreshToken string) (domain.UserToken, error)
 	// Get the current user information
-	Me(userId string) (domain.User, error)
+	Me(ctx context.Context, userId string) (domain.User, error)
+	// Change the current user profile and get a token with the new information
+	UpdateMe(ctx context.Context, userId string, update domain.UserUpdate) (domain.UserToken, error)
+	// List users matching the filter, including inactive ones
+	ListUsers(ctx context.Context, filter domain.UserFilter) (domain.UserPage, error)
+	// Get any user by ID, including inactive ones
+	GetUser(ctx context.Context, userId string) (domain.User, error)
+	// Get any user by username, including inactive ones
+	GetUserByUsername(ctx context.Context, username string) (domain.User, error)
+	// Change a user username, name, picture or role
+	UpdateUser(ctx context.Context, userId string, update domain.UserUpdate) (domain.User, error)
+	// Blocks a user from login or refresh its token
+	Suspend(ctx context.Context, userId string) (domain.User, error)
+	// Allows a suspended or deleted user to use the service again
+	Reactivate(ctx context.Context, userId string) (domain.User, error)
+	// Marks a user as deleted, the account can be restored with Reactivate
+	Delete(ctx context.Context, userId string) (domain.User, error)
+	// Permanently removes a user, existing sessions can't be refreshed anymore
+	Erase(ctx context.Context, userId string) error
+}
+
+// WebAuthnService handle passkey registration and login ceremonies
+type WebAuthnService interface {
+	// Creates the options to register a new passkey for an existing user
+	BeginRegistration(ctx context.Context, userId string) (domain.CredentialCreation, error)
+	// Validates the authenticator attestation and stores the new passkey
+	FinishRegistration(ctx context.Context, userId string, credential domain.RegistrationCredential) (domain.Credential, error)
+	// Creates the options to login with a passkey, username is optional
+	BeginLogin(ctx context.Context, username string) (domain.CredentialAssertion, error)
+	// Validates the authenticator assertion and creates a minerva JWT
+	FinishLogin(ctx context.Context, credential domain.LoginCredential) (domain.UserToken, error)
+}
+
+// TokenSigner signs the access and refresh tokens issued to users
+type TokenSigner interface {
+	// Sign serializes token and signs it with key
+	Sign(token jwt.Token, key *rsa.PrivateKey) ([]byte, error)
 }
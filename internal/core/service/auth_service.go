@@ -1,12 +1,17 @@
 package service
 
 import (
+	"context"
 	"crypto/rsa"
 	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
 	"time"
 
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwt"
+	"github.com/rs/zerolog/log"
 	mvdatetime "github.com/sy-software/minerva-go-utils/datetime"
 	"github.com/sy-software/minerva-spear-users/internal/core/domain"
 	"github.com/sy-software/minerva-spear-users/internal/core/ports"
@@ -15,66 +20,158 @@ import (
 const TOKEN_ISSUER = "minerva/spear/auth"
 const TOKEN_AUDIENCE = "minerva/app"
 
+// Claim with the user token version when the token was issued
+const TOKEN_VERSION_CLAIM = "ver"
+
+const (
+	DEFAULT_PAGE_SIZE = 20
+	MAX_PAGE_SIZE     = 100
+)
+
 type TokenUse string
 
 const (
 	Access  TokenUse = "access"
 	Refresh TokenUse = "refresh"
+	// Signed state shared with the client during a WebAuthn ceremony
+	Ceremony TokenUse = "ceremony"
 )
 
 type AuthService struct {
-	repo   ports.UserRepo
-	config domain.Config
+	repo        ports.UserRepo
+	credentials ports.CredentialRepo
+	signer      ports.TokenSigner
+	config      *domain.ConfigSnapshot
+	// *usernameRules built from the current configuration
+	usernames atomic.Value
+}
+
+// usernameRules caches the validator of a configuration snapshot
+type usernameRules struct {
+	config    *domain.Config
+	validator *UsernameValidator
+}
+
+func NewAuthService(repo ports.UserRepo, credentials ports.CredentialRepo, signer ports.TokenSigner, config *domain.ConfigSnapshot) *AuthService {
+	service := &AuthService{
+		repo:        repo,
+		credentials: credentials,
+		signer:      signer,
+		config:      config,
+	}
+
+	service.usernameValidator(config.Get())
+	return service
 }
 
-func NewAuthService(repo ports.UserRepo, config domain.Config) *AuthService {
-	return &AuthService{
-		repo:   repo,
-		config: config,
+// usernameValidator returns the validator for the username rules of config,
+// it's only rebuilt when a reload changes the rules.
+// The rules are checked by Config.Validate, when they still can't be built I.E.: the deny list
+// file was removed, the previous rules are kept and without them usernames are rejected
+func (service *AuthService) usernameValidator(config *domain.Config) (*UsernameValidator, error) {
+	cached, _ := service.usernames.Load().(*usernameRules)
+	if cached != nil && cached.config == config {
+		return cached.validator, nil
+	}
+
+	if cached != nil && reflect.DeepEqual(cached.config.Username, config.Username) {
+		service.usernames.Store(&usernameRules{config: config, validator: cached.validator})
+		return cached.validator, nil
 	}
+
+	validator, err := NewUsernameValidator(config.Username)
+
+	if err != nil {
+		if cached != nil {
+			log.Error().Err(err).Msg("Invalid username rules, the previous rules will be used instead")
+			return cached.validator, nil
+		}
+
+		log.Error().Err(err).Msg("Invalid username rules")
+		return nil, err
+	}
+
+	service.usernames.Store(&usernameRules{config: config, validator: validator})
+	return validator, nil
 }
 
 // Creates a minerva JWT for a user validated by an OAuth provider
 // TODO: Implement token count limit
 // TODO: Update user info on each new login
-func (service *AuthService) Login(request domain.Login) (domain.UserToken, error) {
-	user, err := service.repo.GetByUsername(request.Username)
+func (service *AuthService) Login(ctx context.Context, request domain.Login) (domain.UserToken, error) {
+	config := service.config.Get()
+
+	user, err := findByUsername(ctx, service.repo, request.Username)
 
 	if err != nil {
 		return domain.UserToken{}, err
 	}
 
-	key, err := service.config.Token.KeyPair()
+	if !user.IsActive() {
+		return domain.UserToken{}, domain.ErrUserNotActive
+	}
+
+	key, err := config.Token.KeyPair()
 
 	if err != nil {
 		return domain.UserToken{}, err
 	}
 
-	return createUserToken(user, key, &service.config)
+	return createUserToken(service.signer, user, key, config)
 }
 
 // Registers a user validated by an OAuth provider into minerva platform
-func (service *AuthService) Register(request domain.Register) (domain.UserToken, error) {
-	newUser, err := service.repo.Create(request)
+func (service *AuthService) Register(ctx context.Context, request domain.Register) (domain.UserToken, error) {
+	config := service.config.Get()
+
+	validator, err := service.usernameValidator(config)
+
+	if err != nil {
+		return domain.UserToken{}, err
+	}
+
+	username, err := validator.Validate(request.Username)
+
+	if err != nil {
+		return domain.UserToken{}, err
+	}
+
+	// Users registered before usernames were normalized keep their original username,
+	// the storage can't tell it's the same one
+	_, err = findByUsername(ctx, service.repo, request.Username)
+
+	if err == nil {
+		return domain.UserToken{}, domain.ErrDuplicate
+	}
+
+	if !errors.Is(err, domain.ErrNotFound) {
+		return domain.UserToken{}, err
+	}
+
+	// Usernames are stored in canonical form so the storage can enforce uniqueness
+	request.Username = username
+	newUser, err := service.repo.Create(ctx, request)
 
 	if err != nil {
 		return domain.UserToken{}, err
 	}
 
 	now := mvdatetime.UnixUTCNow()
-	expire := now.Add(time.Duration(service.config.Token.Duration) * time.Second)
+	expire := now.Add(time.Duration(config.Token.Duration) * time.Second)
 
-	key, err := service.config.Token.KeyPair()
+	key, err := config.Token.KeyPair()
 
 	if err != nil {
 		return domain.UserToken{}, err
 	}
 
 	token, err := createToken(
+		service.signer,
 		newUser.Id,
 		expire,
 		Access,
 		&newUser,
+		newUser.TokenVersion,
 		key,
 	)
 
@@ -83,10 +180,12 @@ func (service *AuthService) Register(request domain.Register) (domain.UserToken,
 	}
 
 	refresh, err := createToken(
+		service.signer,
 		newUser.Id,
-		now.Add(time.Duration(service.config.Token.RefreshDuration)*time.Second),
+		now.Add(time.Duration(config.Token.RefreshDuration)*time.Second),
 		Refresh,
 		nil,
+		newUser.TokenVersion,
 		key,
 	)
 
@@ -94,10 +193,6 @@ func (service *AuthService) Register(request domain.Register) (domain.UserToken,
 		return domain.UserToken{}, err
 	}
 
-	if err != nil {
-		return domain.UserToken{}, err
-	}
-
 	return domain.UserToken{
 		AccessToken:  token,
 		RefreshToken: refresh,
@@ -109,8 +204,10 @@ func (service *AuthService) Register(request domain.Register) (domain.UserToken,
 
 // Refresh the current user token
 // TODO: Implement single use refresh token, I.E.: Can't use same refresh token twice
-func (service *AuthService) Refresh(refreshToken string) (domain.UserToken, error) {
-	key, err := service.config.Token.KeyPair()
+func (service *AuthService) Refresh(ctx context.Context, refreshToken string) (domain.UserToken, error) {
+	config := service.config.Get()
+
+	key, err := config.Token.KeyPair()
 
 	if err != nil {
 		return domain.UserToken{}, err
@@ -123,41 +220,234 @@ func (service *AuthService) Refresh(refreshToken string) (domain.UserToken, erro
 	)
 
 	if err != nil {
-		return domain.UserToken{}, err
+		return domain.UserToken{}, fmt.Errorf("%w: %v", domain.ErrInvalidToken, err)
 	}
 
 	use, ok := decoded.Get("use")
 	if !ok || use.(string) != string(Refresh) {
-		return domain.UserToken{}, errors.New("expected refresh token")
+		return domain.UserToken{}, fmt.Errorf("%w: expected refresh token", domain.ErrInvalidToken)
 	}
 
 	userId := decoded.Subject()
 
-	user, err := service.repo.GetById(userId)
+	user, err := service.repo.GetById(ctx, userId)
 
 	if err != nil {
 		return domain.UserToken{}, err
 	}
 
-	return createUserToken(user, key, &service.config)
+	if !user.IsActive() {
+		return domain.UserToken{}, domain.ErrUserNotActive
+	}
+
+	// Tokens issued before versioning have no version claim, they match version 0
+	version, _ := decoded.Get(TOKEN_VERSION_CLAIM)
+	if number, _ := version.(float64); int(number) != user.TokenVersion {
+		return domain.UserToken{}, fmt.Errorf("%w: revoked token", domain.ErrInvalidToken)
+	}
+
+	return createUserToken(service.signer, user, key, config)
 }
 
 // Get the current user information
-func (service *AuthService) Me(userId string) (domain.User, error) {
-	return service.repo.GetById(userId)
+func (service *AuthService) Me(ctx context.Context, userId string) (domain.User, error) {
+	user, err := service.repo.GetById(ctx, userId)
+
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	if !user.IsActive() {
+		return domain.User{}, domain.ErrUserNotActive
+	}
+
+	return user, nil
+}
+
+// List users matching the filter, including inactive ones
+func (service *AuthService) ListUsers(ctx context.Context, filter domain.UserFilter) (domain.UserPage, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+
+	if filter.PageSize < 1 {
+		filter.PageSize = DEFAULT_PAGE_SIZE
+	}
+
+	if filter.PageSize > MAX_PAGE_SIZE {
+		filter.PageSize = MAX_PAGE_SIZE
+	}
+
+	return service.repo.List(ctx, filter)
+}
+
+// Get any user by ID, including inactive ones
+func (service *AuthService) GetUser(ctx context.Context, userId string) (domain.User, error) {
+	return service.repo.GetById(ctx, userId)
+}
+
+// Get any user by username, including inactive ones
+func (service *AuthService) GetUserByUsername(ctx context.Context, username string) (domain.User, error) {
+	return service.repo.GetByUsername(ctx, username)
+}
+
+// Change a user username, name, picture or role
+func (service *AuthService) UpdateUser(ctx context.Context, userId string, update domain.UserUpdate) (domain.User, error) {
+	if update.Username != nil {
+		username, err := service.checkUsername(ctx, userId, *update.Username)
+
+		if err != nil {
+			return domain.User{}, err
+		}
+
+		update.Username = &username
+	}
+
+	updated, err := service.repo.Update(ctx, userId, update)
+
+	// Other user took the username after our check
+	if err != nil && errors.Is(err, domain.ErrDuplicate) {
+		return domain.User{}, domain.ErrUsernameTaken
+	}
+
+	return updated, err
+}
+
+// Change the current user profile and get a token with the new information
+// so the user claim is not stale
+func (service *AuthService) UpdateMe(ctx context.Context, userId string, update domain.UserUpdate) (domain.UserToken, error) {
+	config := service.config.Get()
+
+	user, err := service.repo.GetById(ctx, userId)
+
+	if err != nil {
+		return domain.UserToken{}, err
+	}
+
+	if !user.IsActive() {
+		return domain.UserToken{}, domain.ErrUserNotActive
+	}
+
+	// Users can't change their own role
+	update.Role = nil
+
+	updated, err := service.UpdateUser(ctx, userId, update)
+
+	if err != nil {
+		return domain.UserToken{}, err
+	}
+
+	key, err := config.Token.KeyPair()
+
+	if err != nil {
+		return domain.UserToken{}, err
+	}
+
+	return createUserToken(service.signer, updated, key, config)
+}
+
+// Blocks a user from login, refresh its token or read its information.
+// The refresh tokens issued before are revoked so they can't be used after a reactivation,
+// access tokens are validated by the gateway and are valid until they expire
+func (service *AuthService) Suspend(ctx context.Context, userId string) (domain.User, error) {
+	return service.revokeAndUpdateStatus(ctx, userId, domain.UserSuspended)
+}
+
+// Allows a suspended or deleted user to use the service again
+func (service *AuthService) Reactivate(ctx context.Context, userId string) (domain.User, error) {
+	return service.repo.UpdateStatus(ctx, userId, domain.UserActive)
+}
+
+// Marks a user as deleted, the account can be restored with Reactivate.
+// Tokens are revoked like in Suspend
+func (service *AuthService) Delete(ctx context.Context, userId string) (domain.User, error) {
+	return service.revokeAndUpdateStatus(ctx, userId, domain.UserDeleted)
+}
+
+// Permanently removes a user and its passkeys
+// Once the user is gone Refresh can't resolve the token subject so its refresh
+// tokens can't be used. Access tokens already issued are valid until they expire
+func (service *AuthService) Erase(ctx context.Context, userId string) error {
+	if _, err := service.repo.GetById(ctx, userId); err != nil {
+		return err
+	}
+
+	// Passkeys go first so a failed erase can be retried
+	if err := service.credentials.DeleteByUser(ctx, userId); err != nil {
+		return err
+	}
+
+	return service.repo.Delete(ctx, userId)
 }
 
 // Utils
 
-func createUserToken(user domain.User, key *rsa.PrivateKey, config *domain.Config) (domain.UserToken, error) {
+// revokeAndUpdateStatus revokes the user tokens before changing its status,
+// a failed change can be retried without leaving valid tokens behind
+func (service *AuthService) revokeAndUpdateStatus(ctx context.Context, userId string, status string) (domain.User, error) {
+	if _, err := service.repo.RevokeTokens(ctx, userId); err != nil {
+		return domain.User{}, err
+	}
+
+	return service.repo.UpdateStatus(ctx, userId, status)
+}
+
+// checkUsername validates the username rules and that no other user has it in its canonical
+// or original form, returns the canonical form of the username
+func (service *AuthService) checkUsername(ctx context.Context, userId string, username string) (string, error) {
+	validator, err := service.usernameValidator(service.config.Get())
+
+	if err != nil {
+		return "", err
+	}
+
+	canonical, err := validator.Validate(username)
+
+	if err != nil {
+		return "", err
+	}
+
+	owner, err := findByUsername(ctx, service.repo, username)
+
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return canonical, nil
+		}
+
+		return "", err
+	}
+
+	if owner.Id != userId {
+		return "", domain.ErrUsernameTaken
+	}
+
+	return canonical, nil
+}
+
+// findByUsername looks for the canonical form of the username first, users registered
+// before usernames were normalized are found by their original username
+func findByUsername(ctx context.Context, repo ports.UserRepo, username string) (domain.User, error) {
+	canonical := NormalizeUsername(username)
+	user, err := repo.GetByUsername(ctx, canonical)
+
+	if err != nil && errors.Is(err, domain.ErrNotFound) && canonical != username {
+		return repo.GetByUsername(ctx, username)
+	}
+
+	return user, err
+}
+
+func createUserToken(signer ports.TokenSigner, user domain.User, key *rsa.PrivateKey, config *domain.Config) (domain.UserToken, error) {
 	now := mvdatetime.UnixUTCNow()
 	expire := now.Add(time.Duration(config.Token.Duration) * time.Second)
 
 	token, err := createToken(
+		signer,
 		user.Id,
 		expire,
 		Access,
 		&user,
+		user.TokenVersion,
 		key,
 	)
 
@@ -166,10 +456,12 @@ func createUserToken(user domain.User, key *rsa.PrivateKey, config *domain.Confi
 	}
 
 	refresh, err := createToken(
+		signer,
 		user.Id,
 		now.Add(time.Duration(config.Token.RefreshDuration)*time.Second),
 		Refresh,
 		nil,
+		user.TokenVersion,
 		key,
 	)
 
@@ -177,10 +469,6 @@ func createUserToken(user domain.User, key *rsa.PrivateKey, config *domain.Confi
 		return domain.UserToken{}, err
 	}
 
-	if err != nil {
-		return domain.UserToken{}, err
-	}
-
 	return domain.UserToken{
 		AccessToken:  token,
 		RefreshToken: refresh,
@@ -191,10 +479,12 @@ func createUserToken(user domain.User, key *rsa.PrivateKey, config *domain.Confi
 }
 
 func createToken(
+	signer ports.TokenSigner,
 	subject string,
 	expire time.Time,
 	use TokenUse,
 	user *domain.User,
+	version int,
 	key *rsa.PrivateKey,
 ) (string, error) {
 	token := jwt.New()
@@ -204,15 +494,16 @@ func createToken(
 	token.Set(jwt.AudienceKey, TOKEN_AUDIENCE)
 
 	token.Set("use", use)
+	token.Set(TOKEN_VERSION_CLAIM, version)
 
 	if user != nil {
 		token.Set("user", user)
 	}
 
-	serialized, err := jwt.Sign(token, jwa.RS256, key)
+	serialized, err := signer.Sign(token, key)
 
 	if err != nil {
-		return "", nil
+		return "", err
 	}
 
 	return string(serialized), nil
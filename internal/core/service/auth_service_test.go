@@ -1,6 +1,8 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -37,20 +39,27 @@ func TestUserRegistration(t *testing.T) {
 		Picture:  "https://picture.com/ironman",
 	}
 
+	// Usernames are stored in canonical form
+	expectedReq := registerReq
+	expectedReq.Username = "ironman"
+
 	repo := mocks.UserRepo{
+		GetByUsernameInterceptor: func(username string) (domain.User, error) {
+			return domain.User{}, domain.ErrNotFound
+		},
 		CreateInterceptor: func(user domain.Register) (domain.User, error) {
 			called = true
 
-			if !cmp.Equal(user, registerReq) {
-				t.Errorf("Expected create to be called with: %+v Got: %+v", registerReq, user)
+			if !cmp.Equal(user, expectedReq) {
+				t.Errorf("Expected create to be called with: %+v Got: %+v", expectedReq, user)
 			}
 			return expectedInfo, nil
 		},
 	}
 
-	service := NewAuthService(&repo, config)
+	service := NewAuthService(&repo, &mocks.CredentialRepo{}, NewRS256Signer(), domain.NewConfigSnapshot(config))
 	now := mvdatetime.UnixUTCNow()
-	token, err := service.Register(registerReq)
+	token, err := service.Register(context.Background(), registerReq)
 
 	if !called {
 		t.Error("Expected repo.Create to be called")
@@ -61,6 +70,45 @@ func TestUserRegistration(t *testing.T) {
 	}
 
 	assertUserToken(&token, &config, now, &expectedInfo, t)
+
+	t.Run("Test username taken in original form", func(t *testing.T) {
+		// A user registered before usernames were normalized
+		repo := mocks.UserRepo{
+			GetByUsernameInterceptor: func(username string) (domain.User, error) {
+				if username == "IronMan" {
+					return domain.User{Id: "legacy", Username: "IronMan"}, nil
+				}
+
+				return domain.User{}, domain.ErrNotFound
+			},
+		}
+
+		service := NewAuthService(&repo, &mocks.CredentialRepo{}, NewRS256Signer(), domain.NewConfigSnapshot(config))
+		_, err := service.Register(context.Background(), registerReq)
+
+		if !errors.Is(err, domain.ErrDuplicate) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrDuplicate, err)
+		}
+
+		if calls := repo.CallCount("Create"); calls != 0 {
+			t.Errorf("Expected repo.Create not to be called got: %d calls", calls)
+		}
+	})
+
+	t.Run("Test username lookup error", func(t *testing.T) {
+		repo := mocks.UserRepo{
+			GetByUsernameInterceptor: func(username string) (domain.User, error) {
+				return domain.User{}, domain.ErrUnavailable
+			},
+		}
+
+		service := NewAuthService(&repo, &mocks.CredentialRepo{}, NewRS256Signer(), domain.NewConfigSnapshot(config))
+		_, err := service.Register(context.Background(), registerReq)
+
+		if !errors.Is(err, domain.ErrUnavailable) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrUnavailable, err)
+		}
+	})
 }
 
 func TestLogin(t *testing.T) {
@@ -80,8 +128,8 @@ func TestLogin(t *testing.T) {
 		GetByUsernameInterceptor: func(username string) (domain.User, error) {
 			called = true
 
-			if username != "IronMan" {
-				t.Errorf("Expected username to be IronMan got: %q", username)
+			if username != "ironman" {
+				t.Errorf("Expected username to be ironman got: %q", username)
 			}
 
 			return expectedInfo, nil
@@ -94,8 +142,8 @@ func TestLogin(t *testing.T) {
 		TokenID:  "tokenId",
 	}
 	now := mvdatetime.UnixUTCNow()
-	service := NewAuthService(&repo, config)
-	token, err := service.Login(request)
+	service := NewAuthService(&repo, &mocks.CredentialRepo{}, NewRS256Signer(), domain.NewConfigSnapshot(config))
+	token, err := service.Login(context.Background(), request)
 
 	if !called {
 		t.Error("Expected repo.GetByUsername to be called")
@@ -106,6 +154,28 @@ func TestLogin(t *testing.T) {
 	}
 
 	assertUserToken(&token, &config, now, &expectedInfo, t)
+
+	t.Run("Test signer", func(t *testing.T) {
+		signer := mocks.TokenSigner{SignInterceptor: NewRS256Signer().Sign}
+		service := NewAuthService(&repo, &mocks.CredentialRepo{}, &signer, domain.NewConfigSnapshot(config))
+
+		service.Login(context.Background(), request)
+
+		// Access and refresh tokens
+		if signer.CallCount("Sign") != 2 {
+			t.Errorf("Expected 2 signatures got: %d", signer.CallCount("Sign"))
+		}
+	})
+
+	t.Run("Test signing error", func(t *testing.T) {
+		signer := mocks.TokenSigner{}
+		signer.Returns("Sign", nil, errors.New("signing failed"))
+		service := NewAuthService(&repo, &mocks.CredentialRepo{}, &signer, domain.NewConfigSnapshot(config))
+
+		if _, err := service.Login(context.Background(), request); err == nil {
+			t.Error("Expected the signing error to be returned")
+		}
+	})
 }
 
 func TestRefreshToken(t *testing.T) {
@@ -141,15 +211,17 @@ func TestRefreshToken(t *testing.T) {
 
 	k, err := config.Token.KeyPair()
 	now := mvdatetime.UnixUTCNow()
-	service := NewAuthService(&repo, config)
+	service := NewAuthService(&repo, &mocks.CredentialRepo{}, NewRS256Signer(), domain.NewConfigSnapshot(config))
 	token, err := createToken(
+		NewRS256Signer(),
 		"newid",
 		now.Add(time.Hour*time.Duration(24)),
 		Refresh,
 		&expectedInfo,
+		0,
 		k,
 	)
-	newToken, err := service.Refresh(token)
+	newToken, err := service.Refresh(context.Background(), token)
 
 	if err != nil {
 		t.Errorf("Expected refresh without error, got: %v", err)
@@ -164,6 +236,42 @@ func TestRefreshToken(t *testing.T) {
 	}
 
 	assertUserToken(&newToken, &config, now, &expectedInfo, t)
+
+	t.Run("Test access token", func(t *testing.T) {
+		access, _ := createToken(NewRS256Signer(), "newid", now.Add(time.Hour), Access, &expectedInfo, 0, k)
+		_, err := service.Refresh(context.Background(), access)
+
+		if !errors.Is(err, domain.ErrInvalidToken) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrInvalidToken, err)
+		}
+	})
+
+	t.Run("Test malformed token", func(t *testing.T) {
+		_, err := service.Refresh(context.Background(), "not.a.token")
+
+		if !errors.Is(err, domain.ErrInvalidToken) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrInvalidToken, err)
+		}
+	})
+
+	t.Run("Test revoked token", func(t *testing.T) {
+		revoked := expectedInfo
+		revoked.TokenVersion = 1
+		repo.GetByIdInterceptor = func(id string) (domain.User, error) {
+			return revoked, nil
+		}
+
+		_, err := service.Refresh(context.Background(), token)
+
+		if !errors.Is(err, domain.ErrInvalidToken) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrInvalidToken, err)
+		}
+
+		current, _ := createToken(NewRS256Signer(), "newid", now.Add(time.Hour), Refresh, nil, revoked.TokenVersion, k)
+		if _, err := service.Refresh(context.Background(), current); err != nil {
+			t.Errorf("Expected tokens with the current version to refresh got: %v", err)
+		}
+	})
 }
 
 func TestMe(t *testing.T) {
@@ -190,8 +298,8 @@ func TestMe(t *testing.T) {
 		},
 	}
 
-	service := NewAuthService(&repo, config)
-	me, err := service.Me("newid")
+	service := NewAuthService(&repo, &mocks.CredentialRepo{}, NewRS256Signer(), domain.NewConfigSnapshot(config))
+	me, err := service.Me(context.Background(), "newid")
 
 	if err != nil {
 		t.Errorf("Expected my info to be returned without error, got: %v", err)
@@ -303,3 +411,288 @@ func assertUserToken(
 		t.Errorf("Expected user info to be: %+v; got: %+v", expectedInfo, token.Info)
 	}
 }
+
+func TestInactiveUser(t *testing.T) {
+	config := domain.DefaultConfig()
+	config.Token.PrivateKey = PRIVATE_KEY
+	config.Token.PublicKey = PUBLIC_KEY
+
+	suspended := domain.User{
+		Id:       "newid",
+		Name:     "Tony Stark",
+		Username: "IronMan",
+		Status:   domain.UserSuspended,
+	}
+
+	repo := mocks.UserRepo{
+		GetByUsernameInterceptor: func(username string) (domain.User, error) {
+			return suspended, nil
+		},
+		GetByIdInterceptor: func(id string) (domain.User, error) {
+			return suspended, nil
+		},
+	}
+
+	service := NewAuthService(&repo, &mocks.CredentialRepo{}, NewRS256Signer(), domain.NewConfigSnapshot(config))
+
+	t.Run("Test login", func(t *testing.T) {
+		_, err := service.Login(context.Background(), domain.Login{Username: "IronMan"})
+
+		if err != domain.ErrUserNotActive {
+			t.Errorf("Expected error: %v got: %v", domain.ErrUserNotActive, err)
+		}
+	})
+
+	t.Run("Test refresh", func(t *testing.T) {
+		k, _ := config.Token.KeyPair()
+		token, _ := createToken(
+			NewRS256Signer(),
+			"newid",
+			mvdatetime.UnixUTCNow().Add(time.Hour),
+			Refresh,
+			nil,
+			0,
+			k,
+		)
+
+		_, err := service.Refresh(context.Background(), token)
+
+		if err != domain.ErrUserNotActive {
+			t.Errorf("Expected error: %v got: %v", domain.ErrUserNotActive, err)
+		}
+	})
+
+	t.Run("Test me", func(t *testing.T) {
+		_, err := service.Me(context.Background(), "newid")
+
+		if err != domain.ErrUserNotActive {
+			t.Errorf("Expected error: %v got: %v", domain.ErrUserNotActive, err)
+		}
+	})
+}
+
+func TestUserLifecycle(t *testing.T) {
+	config := domain.DefaultConfig()
+	statuses := []string{}
+
+	repo := mocks.UserRepo{
+		GetByIdInterceptor: func(id string) (domain.User, error) {
+			return domain.User{Id: id}, nil
+		},
+		UpdateStatusInterceptor: func(id string, status string) (domain.User, error) {
+			if id != "newid" {
+				t.Errorf("Expected id to be \"newid\" got: %q", id)
+			}
+
+			statuses = append(statuses, status)
+			return domain.User{Id: id, Status: status}, nil
+		},
+		RevokeTokensInterceptor: func(id string) (domain.User, error) {
+			return domain.User{Id: id, TokenVersion: 1}, nil
+		},
+	}
+
+	credentials := mocks.CredentialRepo{}
+	service := NewAuthService(&repo, &credentials, NewRS256Signer(), domain.NewConfigSnapshot(config))
+	service.Suspend(context.Background(), "newid")
+	service.Reactivate(context.Background(), "newid")
+	service.Delete(context.Background(), "newid")
+
+	expected := []string{domain.UserSuspended, domain.UserActive, domain.UserDeleted}
+	if !cmp.Equal(expected, statuses) {
+		t.Errorf("Expected status changes: %v got: %v", expected, statuses)
+	}
+
+	// Suspend and Delete revoke the tokens, Reactivate doesn't bring them back
+	if calls := repo.CallCount("RevokeTokens"); calls != 2 {
+		t.Errorf("Expected tokens to be revoked 2 times got: %d", calls)
+	}
+
+	t.Run("Test erase", func(t *testing.T) {
+		deleted := ""
+		repo.DeleteInterceptor = func(id string) error {
+			deleted = id
+			return nil
+		}
+
+		passkeysOf := ""
+		credentials.DeleteByUserInterceptor = func(userId string) error {
+			if deleted != "" {
+				t.Error("Expected passkeys to be deleted before the user")
+			}
+
+			passkeysOf = userId
+			return nil
+		}
+
+		err := service.Erase(context.Background(), "newid")
+
+		if err != nil {
+			t.Errorf("Expected erase without error, got: %v", err)
+		}
+
+		if deleted != "newid" {
+			t.Errorf("Expected user \"newid\" to be deleted got: %q", deleted)
+		}
+
+		if passkeysOf != "newid" {
+			t.Errorf("Expected passkeys of user \"newid\" to be deleted got: %q", passkeysOf)
+		}
+	})
+
+	t.Run("Test erase passkeys error", func(t *testing.T) {
+		repo.DeleteInterceptor = func(id string) error {
+			t.Error("Expected the user not to be deleted")
+			return nil
+		}
+
+		credentials.DeleteByUserInterceptor = func(userId string) error {
+			return domain.ErrUnavailable
+		}
+
+		err := service.Erase(context.Background(), "newid")
+
+		if !errors.Is(err, domain.ErrUnavailable) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrUnavailable, err)
+		}
+	})
+}
+
+func TestListUsers(t *testing.T) {
+	config := domain.DefaultConfig()
+	var received domain.UserFilter
+
+	repo := mocks.UserRepo{
+		ListInterceptor: func(filter domain.UserFilter) (domain.UserPage, error) {
+			received = filter
+			return domain.UserPage{Page: filter.Page, PageSize: filter.PageSize}, nil
+		},
+	}
+
+	service := NewAuthService(&repo, &mocks.CredentialRepo{}, NewRS256Signer(), domain.NewConfigSnapshot(config))
+
+	service.ListUsers(context.Background(), domain.UserFilter{Role: "hero"})
+
+	if received.Page != 1 || received.PageSize != DEFAULT_PAGE_SIZE || received.Role != "hero" {
+		t.Errorf("Expected default pagination got: %+v", received)
+	}
+
+	service.ListUsers(context.Background(), domain.UserFilter{Page: 3, PageSize: MAX_PAGE_SIZE + 1})
+
+	if received.Page != 3 || received.PageSize != MAX_PAGE_SIZE {
+		t.Errorf("Expected page size to be limited to %d got: %+v", MAX_PAGE_SIZE, received)
+	}
+}
+
+func TestUpdateMe(t *testing.T) {
+	config := domain.DefaultConfig()
+	config.Token.PrivateKey = PRIVATE_KEY
+	config.Token.PublicKey = PUBLIC_KEY
+
+	current := domain.User{
+		Id:       "newid",
+		Name:     "Tony Stark",
+		Username: "IronMan",
+		Picture:  "https://picture.com/ironman",
+		Role:     "hero",
+	}
+
+	repo := mocks.UserRepo{
+		GetByIdInterceptor: func(id string) (domain.User, error) {
+			return current, nil
+		},
+		GetByUsernameInterceptor: func(username string) (domain.User, error) {
+			if username == "hulk" {
+				return domain.User{Id: "otherid", Username: "hulk"}, nil
+			}
+
+			return domain.User{}, domain.ErrNotFound
+		},
+		UpdateInterceptor: func(id string, update domain.UserUpdate) (domain.User, error) {
+			if update.Role != nil {
+				t.Errorf("Expected role to not be updated got: %q", *update.Role)
+			}
+
+			updated := current
+			updated.Username = *update.Username
+			return updated, nil
+		},
+	}
+
+	service := NewAuthService(&repo, &mocks.CredentialRepo{}, NewRS256Signer(), domain.NewConfigSnapshot(config))
+	username := "Tony"
+	role := "admin"
+	now := mvdatetime.UnixUTCNow()
+	token, err := service.UpdateMe(context.Background(), "newid", domain.UserUpdate{Username: &username, Role: &role})
+
+	if err != nil {
+		t.Fatalf("Expected update without error, got: %v", err)
+	}
+
+	expectedInfo := current
+	expectedInfo.Username = "tony"
+	assertUserToken(&token, &config, now, &expectedInfo, t)
+
+	t.Run("Test username taken", func(t *testing.T) {
+		username := "Hulk"
+		_, err := service.UpdateMe(context.Background(), "newid", domain.UserUpdate{Username: &username})
+
+		if err != domain.ErrUsernameTaken {
+			t.Errorf("Expected error: %v got: %v", domain.ErrUsernameTaken, err)
+		}
+	})
+
+	t.Run("Test invalid username", func(t *testing.T) {
+		username := "I am Iron Man"
+		_, err := service.UpdateMe(context.Background(), "newid", domain.UserUpdate{Username: &username})
+
+		if !errors.Is(err, domain.ErrValidation) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrValidation, err)
+		}
+	})
+}
+
+func TestConfigReload(t *testing.T) {
+	config := domain.DefaultConfig()
+	config.Token.PrivateKey = PRIVATE_KEY
+	config.Token.PublicKey = PUBLIC_KEY
+
+	repo := mocks.UserRepo{
+		GetByUsernameInterceptor: func(username string) (domain.User, error) {
+			return domain.User{}, domain.ErrNotFound
+		},
+		CreateInterceptor: func(user domain.Register) (domain.User, error) {
+			return domain.User{Id: "newid", Username: user.Username}, nil
+		},
+	}
+
+	snapshot := domain.NewConfigSnapshot(config)
+	service := NewAuthService(&repo, &mocks.CredentialRepo{}, NewRS256Signer(), snapshot)
+
+	reloaded := config
+	reloaded.Token.Duration = config.Token.Duration * 2
+	reloaded.Username.MinLength = 8
+	snapshot.Set(reloaded)
+
+	t.Run("Test new token duration", func(t *testing.T) {
+		now := mvdatetime.UnixUTCNow()
+		token, err := service.Register(context.Background(), domain.Register{Username: "tonystark"})
+
+		if err != nil {
+			t.Errorf("Expected register without error, got: %v", err)
+		}
+
+		expire := now.Add(time.Duration(reloaded.Token.Duration) * time.Second)
+		if token.ExpireTime.Before(expire) {
+			t.Errorf("Expected token to expire after: %v got: %v", expire, token.ExpireTime)
+		}
+	})
+
+	t.Run("Test new username rules", func(t *testing.T) {
+		_, err := service.Register(context.Background(), domain.Register{Username: "tony"})
+
+		if !errors.Is(err, domain.ErrValidation) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrValidation, err)
+		}
+	})
+}
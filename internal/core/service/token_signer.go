@@ -0,0 +1,21 @@
+package service
+
+import (
+	"crypto/rsa"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwt"
+)
+
+// RS256Signer signs tokens with RSASSA-PKCS1-v1_5 using SHA-256
+// Implements ports.TokenSigner interface
+type RS256Signer struct{}
+
+// NewRS256Signer creates an instance of RS256Signer
+func NewRS256Signer() *RS256Signer {
+	return &RS256Signer{}
+}
+
+func (signer *RS256Signer) Sign(token jwt.Token, key *rsa.PrivateKey) ([]byte, error) {
+	return jwt.Sign(token, jwa.RS256, key)
+}
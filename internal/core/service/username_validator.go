@@ -0,0 +1,145 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Separators ignored when looking for denied words, so "bad_word" matches "badword"
+var usernameSeparators = strings.NewReplacer("_", "", ".", "", "-", "")
+
+// UsernameValidator checks usernames against the configured rules
+type UsernameValidator struct {
+	pattern  *regexp.Regexp
+	min      int
+	max      int
+	reserved map[string]bool
+	denied   []string
+}
+
+// NewUsernameValidator compiles the username rules, the deny list file is read once
+func NewUsernameValidator(config domain.UsernameConfig) (*UsernameValidator, error) {
+	validator := &UsernameValidator{
+		min:      config.MinLength,
+		max:      config.MaxLength,
+		reserved: map[string]bool{},
+	}
+
+	if config.Pattern != "" {
+		pattern, err := regexp.Compile(config.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid username pattern: %w", err)
+		}
+
+		validator.pattern = pattern
+	}
+
+	for _, name := range config.Reserved {
+		validator.reserved[NormalizeUsername(name)] = true
+	}
+
+	if config.DenyListFile != "" {
+		denied, err := loadDenyList(config.DenyListFile)
+		if err != nil {
+			return nil, err
+		}
+
+		validator.denied = denied
+	}
+
+	return validator, nil
+}
+
+// NormalizeUsername returns the canonical form of a username, two usernames with
+// the same canonical form are considered the same user
+func NormalizeUsername(username string) string {
+	folded := cases.Fold().String(norm.NFKC.String(strings.TrimSpace(username)))
+	// Case folding can produce non normalized sequences
+	return norm.NFKC.String(folded)
+}
+
+// Validate returns the canonical form of the username or a *domain.ValidationError
+// listing every broken rule
+func (validator *UsernameValidator) Validate(username string) (string, error) {
+	canonical := NormalizeUsername(username)
+	length := utf8.RuneCountInString(canonical)
+	fields := []domain.FieldError{}
+
+	broken := func(rule string, message string, args ...interface{}) {
+		fields = append(fields, domain.FieldError{
+			Field:   "username",
+			Rule:    rule,
+			Message: fmt.Sprintf(message, args...),
+		})
+	}
+
+	if length == 0 {
+		broken("required", "username is required")
+		return "", &domain.ValidationError{Fields: fields}
+	}
+
+	if validator.min > 0 && length < validator.min {
+		broken("min_length", "username should have at least %d characters", validator.min)
+	}
+
+	if validator.max > 0 && length > validator.max {
+		broken("max_length", "username should have at most %d characters", validator.max)
+	}
+
+	if validator.pattern != nil && !validator.pattern.MatchString(canonical) {
+		broken("pattern", "username has characters that are not allowed")
+	}
+
+	if validator.reserved[canonical] {
+		broken("reserved", "username is reserved")
+	}
+
+	compact := usernameSeparators.Replace(canonical)
+	for _, word := range validator.denied {
+		if strings.Contains(compact, word) {
+			broken("denied", "username contains a forbidden word")
+			break
+		}
+	}
+
+	if len(fields) > 0 {
+		return "", &domain.ValidationError{Fields: fields}
+	}
+
+	return canonical, nil
+}
+
+// loadDenyList reads one word per line, empty lines and lines starting with # are ignored
+func loadDenyList(file string) ([]string, error) {
+	denyFile, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("can't load username deny list: %w", err)
+	}
+
+	defer denyFile.Close()
+
+	words := []string{}
+	scanner := bufio.NewScanner(denyFile)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		words = append(words, usernameSeparators.Replace(NormalizeUsername(line)))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("can't load username deny list: %w", err)
+	}
+
+	return words, nil
+}
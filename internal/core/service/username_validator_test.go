@@ -0,0 +1,87 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+func TestNormalizeUsername(t *testing.T) {
+	cases := map[string]string{
+		"IronMan":    "ironman",
+		" IronMan  ": "ironman",
+		"ＩｒｏｎＭａｎ":    "ironman",
+		"Straße":     "strasse",
+	}
+
+	for username, expected := range cases {
+		if got := NormalizeUsername(username); got != expected {
+			t.Errorf("Expected %q to be normalized to: %q got: %q", username, expected, got)
+		}
+	}
+}
+
+func TestUsernameValidator(t *testing.T) {
+	denyList := filepath.Join(t.TempDir(), "deny.txt")
+	os.WriteFile(denyList, []byte("# Forbidden words\nvillain\n\nthanos\n"), 0600)
+
+	config := domain.DefaultConfig().Username
+	config.DenyListFile = denyList
+
+	validator, err := NewUsernameValidator(config)
+
+	if err != nil {
+		t.Fatalf("Expected validator without error, got: %v", err)
+	}
+
+	username, err := validator.Validate("Iron_Man")
+
+	if err != nil || username != "iron_man" {
+		t.Errorf("Expected canonical username: \"iron_man\" got: %q %v", username, err)
+	}
+
+	cases := map[string][]string{
+		"":                                     {"required"},
+		"ab":                                   {"min_length"},
+		"ADMIN":                                {"reserved"},
+		"аdmin":                                {"pattern"},
+		"i am ironman":                         {"pattern"},
+		"the_villain":                          {"denied"},
+		"T.h.a.n.o.s":                          {"denied"},
+		"_":                                    {"min_length", "pattern"},
+		"thisusernameiswaytoolongtobeaccepted": {"max_length"},
+	}
+
+	for username, rules := range cases {
+		_, err := validator.Validate(username)
+
+		var validation *domain.ValidationError
+		if !errors.As(err, &validation) {
+			t.Errorf("Expected validation error for %q got: %v", username, err)
+			continue
+		}
+
+		if len(validation.Fields) != len(rules) {
+			t.Errorf("Expected rules %v for %q got: %+v", rules, username, validation.Fields)
+			continue
+		}
+
+		for i, rule := range rules {
+			if validation.Fields[i].Rule != rule || validation.Fields[i].Field != "username" {
+				t.Errorf("Expected rule %q for %q got: %+v", rule, username, validation.Fields[i])
+			}
+		}
+	}
+
+	t.Run("Test missing deny list", func(t *testing.T) {
+		config.DenyListFile = filepath.Join(t.TempDir(), "missing.txt")
+		_, err := NewUsernameValidator(config)
+
+		if err == nil {
+			t.Error("Expected an error for a missing deny list")
+		}
+	})
+}
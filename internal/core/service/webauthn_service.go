@@ -0,0 +1,638 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwt"
+	"github.com/rs/zerolog/log"
+	mvdatetime "github.com/sy-software/minerva-go-utils/datetime"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"github.com/sy-software/minerva-spear-users/internal/core/ports"
+)
+
+const (
+	registrationCeremony = "registration"
+	loginCeremony        = "login"
+)
+
+// Issuer and audience of the ceremony sessions, they are signed with their own HMAC key
+// so they are never accepted as access or refresh tokens
+const SESSION_ISSUER = "minerva/spear/webauthn"
+
+const (
+	// COSE algorithm identifiers
+	coseES256 int64 = -7
+	coseRS256 int64 = -257
+	// COSE key types
+	coseKeyEC2 int64 = 2
+	coseKeyRSA int64 = 3
+	// COSE curve for ES256
+	coseCurveP256 int64 = 1
+)
+
+const (
+	flagUserPresent          byte = 0x01
+	flagUserVerified         byte = 0x04
+	flagAttestedCredential   byte = 0x40
+	authenticatorDataMinSize      = 37
+)
+
+// WebAuthnService implements passkey ceremonies
+// Implements ports.WebAuthnService interface
+type WebAuthnService struct {
+	users       ports.UserRepo
+	credentials ports.CredentialRepo
+	challenges  ports.ChallengeRepo
+	signer      ports.TokenSigner
+	config      *domain.ConfigSnapshot
+}
+
+func NewWebAuthnService(users ports.UserRepo, credentials ports.CredentialRepo, challenges ports.ChallengeRepo, signer ports.TokenSigner, config *domain.ConfigSnapshot) *WebAuthnService {
+	return &WebAuthnService{
+		users:       users,
+		credentials: credentials,
+		challenges:  challenges,
+		signer:      signer,
+		config:      config,
+	}
+}
+
+// Creates the options to register a new passkey for an existing user, suspended or deleted users can't register one
+func (service *WebAuthnService) BeginRegistration(ctx context.Context, userId string) (domain.CredentialCreation, error) {
+	config := service.config.Get()
+
+	user, err := service.users.GetById(ctx, userId)
+
+	if err != nil {
+		return domain.CredentialCreation{}, err
+	}
+
+	if !user.IsActive() {
+		return domain.CredentialCreation{}, domain.ErrUserNotActive
+	}
+
+	existing, err := service.credentials.GetByUser(ctx, user.Id)
+
+	if err != nil {
+		return domain.CredentialCreation{}, err
+	}
+
+	challenge, session, err := service.createSession(registrationCeremony, map[string]string{"userId": user.Id})
+
+	if err != nil {
+		return domain.CredentialCreation{}, err
+	}
+
+	displayName := user.Name
+	if displayName == "" {
+		displayName = user.Username
+	}
+
+	return domain.CredentialCreation{
+		Session: session,
+		PublicKey: domain.CreationOptions{
+			Challenge: challenge,
+			RelyingParty: domain.RelyingParty{
+				Id:   config.WebAuthn.RPID,
+				Name: config.WebAuthn.RPName,
+			},
+			User: domain.CredentialUser{
+				Id:          domain.Base64URL(user.Id),
+				Name:        user.Username,
+				DisplayName: displayName,
+			},
+			Parameters: []domain.CredentialParameter{
+				{Type: "public-key", Alg: coseES256},
+				{Type: "public-key", Alg: coseRS256},
+			},
+			Timeout:            config.WebAuthn.Timeout * 1000,
+			ExcludeCredentials: descriptors(existing),
+			AuthenticatorSelection: domain.AuthenticatorSelection{
+				// Login doesn't list the credentials of a user, they must be discoverable
+				ResidentKey:      "required",
+				UserVerification: config.WebAuthn.UserVerification,
+			},
+			Attestation: "none",
+		},
+	}, nil
+}
+
+// Validates the authenticator attestation and stores the new passkey
+func (service *WebAuthnService) FinishRegistration(ctx context.Context, userId string, credential domain.RegistrationCredential) (domain.Credential, error) {
+	session, err := service.parseSession(credential.Session, registrationCeremony)
+
+	if err != nil {
+		return domain.Credential{}, err
+	}
+
+	if sessionClaim(session, "userId") != userId {
+		return domain.Credential{}, fmt.Errorf("%w: session belongs to other user", domain.ErrInvalidCredential)
+	}
+
+	if credential.Type != "public-key" {
+		return domain.Credential{}, fmt.Errorf("%w: unexpected credential type %q", domain.ErrInvalidCredential, credential.Type)
+	}
+
+	err = service.verifyClientData(credential.Response.ClientDataJSON, "webauthn.create", session)
+
+	if err != nil {
+		return domain.Credential{}, err
+	}
+
+	var attestation struct {
+		Format    string          `cbor:"fmt"`
+		Statement cbor.RawMessage `cbor:"attStmt"`
+		AuthData  []byte          `cbor:"authData"`
+	}
+
+	err = cbor.Unmarshal(credential.Response.AttestationObject, &attestation)
+
+	if err != nil {
+		return domain.Credential{}, fmt.Errorf("%w: malformed attestation object", domain.ErrInvalidCredential)
+	}
+
+	// We request "none" conveyance, we don't verify authenticator models
+	if attestation.Format != "none" {
+		return domain.Credential{}, fmt.Errorf("%w: unsupported attestation format %q", domain.ErrInvalidCredential, attestation.Format)
+	}
+
+	authData, err := service.parseAuthenticatorData(attestation.AuthData)
+
+	if err != nil {
+		return domain.Credential{}, err
+	}
+
+	if authData.flags&flagAttestedCredential == 0 {
+		return domain.Credential{}, fmt.Errorf("%w: attested credential data is missing", domain.ErrInvalidCredential)
+	}
+
+	if !bytes.Equal(authData.credentialId, credential.RawId) {
+		return domain.Credential{}, fmt.Errorf("%w: credential id mismatch", domain.ErrInvalidCredential)
+	}
+
+	_, err = parsePublicKey(authData.publicKey)
+
+	if err != nil {
+		return domain.Credential{}, err
+	}
+
+	id := domain.Base64URL(authData.credentialId).String()
+
+	if err := service.useSession(ctx, session); err != nil {
+		return domain.Credential{}, err
+	}
+
+	_, err = service.credentials.GetById(ctx, id)
+
+	if err == nil {
+		return domain.Credential{}, fmt.Errorf("%w: credential is already registered", domain.ErrInvalidCredential)
+	}
+
+	if !errors.Is(err, domain.ErrNotFound) {
+		return domain.Credential{}, err
+	}
+
+	return service.credentials.Create(ctx, domain.Credential{
+		Id:         id,
+		UserId:     userId,
+		PublicKey:  authData.publicKey,
+		SignCount:  authData.signCount,
+		Transports: credential.Response.Transports,
+		CreatedAt:  mvdatetime.UnixUTCNow(),
+	})
+}
+
+// Creates the options to login with a passkey, username is optional.
+// The user is not looked up, the answer is the same for every username so it doesn't
+// reveal which users exist or their credentials. The authenticator offers its discoverable
+// credentials and the username is checked when the login finishes
+func (service *WebAuthnService) BeginLogin(ctx context.Context, username string) (domain.CredentialAssertion, error) {
+	config := service.config.Get()
+
+	challenge, session, err := service.createSession(loginCeremony, map[string]string{"username": username})
+
+	if err != nil {
+		return domain.CredentialAssertion{}, err
+	}
+
+	return domain.CredentialAssertion{
+		Session: session,
+		PublicKey: domain.RequestOptions{
+			Challenge:        challenge,
+			Timeout:          config.WebAuthn.Timeout * 1000,
+			RelyingPartyId:   config.WebAuthn.RPID,
+			AllowCredentials: []domain.CredentialDescriptor{},
+			UserVerification: config.WebAuthn.UserVerification,
+		},
+	}, nil
+}
+
+// Validates the authenticator assertion and creates a minerva JWT
+func (service *WebAuthnService) FinishLogin(ctx context.Context, credential domain.LoginCredential) (domain.UserToken, error) {
+	config := service.config.Get()
+
+	session, err := service.parseSession(credential.Session, loginCeremony)
+
+	if err != nil {
+		return domain.UserToken{}, err
+	}
+
+	if credential.Type != "public-key" {
+		return domain.UserToken{}, fmt.Errorf("%w: unexpected credential type %q", domain.ErrInvalidCredential, credential.Type)
+	}
+
+	stored, err := service.credentials.GetById(ctx, credential.RawId.String())
+
+	if err != nil {
+		log.Debug().Err(err).Msg("Can't find credential")
+		if errors.Is(err, domain.ErrNotFound) {
+			return domain.UserToken{}, fmt.Errorf("%w: unknown credential", domain.ErrInvalidCredential)
+		}
+
+		return domain.UserToken{}, err
+	}
+
+	userHandle := credential.Response.UserHandle
+	if len(userHandle) > 0 && string(userHandle) != stored.UserId {
+		return domain.UserToken{}, fmt.Errorf("%w: user handle mismatch", domain.ErrInvalidCredential)
+	}
+
+	err = service.verifyClientData(credential.Response.ClientDataJSON, "webauthn.get", session)
+
+	if err != nil {
+		return domain.UserToken{}, err
+	}
+
+	authData, err := service.parseAuthenticatorData(credential.Response.AuthenticatorData)
+
+	if err != nil {
+		return domain.UserToken{}, err
+	}
+
+	publicKey, err := parsePublicKey(stored.PublicKey)
+
+	if err != nil {
+		return domain.UserToken{}, err
+	}
+
+	clientDataHash := sha256.Sum256(credential.Response.ClientDataJSON)
+	signed := append(append([]byte{}, credential.Response.AuthenticatorData...), clientDataHash[:]...)
+
+	if !verifySignature(publicKey, signed, credential.Response.Signature) {
+		return domain.UserToken{}, fmt.Errorf("%w: invalid signature", domain.ErrInvalidCredential)
+	}
+
+	// Authenticators without a counter always report zero
+	if (authData.signCount != 0 || stored.SignCount != 0) && authData.signCount <= stored.SignCount {
+		log.Warn().Str("credential", stored.Id).Msg("Sign counter didn't increase, the authenticator may be cloned")
+		return domain.UserToken{}, fmt.Errorf("%w: sign counter didn't increase", domain.ErrInvalidCredential)
+	}
+
+	user, err := service.users.GetById(ctx, stored.UserId)
+
+	if err != nil {
+		return domain.UserToken{}, err
+	}
+
+	if username := sessionClaim(session, "username"); username != "" {
+		owner, err := findByUsername(ctx, service.users, username)
+
+		if err != nil && !errors.Is(err, domain.ErrNotFound) {
+			return domain.UserToken{}, err
+		}
+
+		if err != nil || owner.Id != user.Id {
+			return domain.UserToken{}, fmt.Errorf("%w: credential belongs to other user", domain.ErrInvalidCredential)
+		}
+	}
+
+	if !user.IsActive() {
+		return domain.UserToken{}, domain.ErrUserNotActive
+	}
+
+	if err := service.useSession(ctx, session); err != nil {
+		return domain.UserToken{}, err
+	}
+
+	err = service.credentials.UpdateSignCount(ctx, stored.Id, authData.signCount)
+
+	if err != nil {
+		return domain.UserToken{}, err
+	}
+
+	key, err := config.Token.KeyPair()
+
+	if err != nil {
+		return domain.UserToken{}, err
+	}
+
+	return createUserToken(service.signer, user, key, config)
+}
+
+// Utils
+
+type authenticatorData struct {
+	rpIdHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialId []byte
+	publicKey    []byte
+}
+
+// createSession returns a random challenge and a token holding the ceremony state signed with
+// the session secret, only the answered challenges are stored, in the ChallengeRepo, to stop replays
+func (service *WebAuthnService) createSession(ceremony string, claims map[string]string) (domain.Base64URL, string, error) {
+	config := service.config.Get()
+
+	challenge := make([]byte, 32)
+
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, "", err
+	}
+
+	secret, err := sessionSecret(config)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	token := jwt.New()
+	token.Set(jwt.IssuerKey, SESSION_ISSUER)
+	token.Set(jwt.AudienceKey, SESSION_ISSUER)
+	token.Set(jwt.ExpirationKey, mvdatetime.UnixUTCNow().Add(time.Duration(config.WebAuthn.Timeout)*time.Second))
+	token.Set("use", Ceremony)
+	token.Set("ceremony", ceremony)
+	token.Set("challenge", base64.RawURLEncoding.EncodeToString(challenge))
+
+	for name, value := range claims {
+		token.Set(name, value)
+	}
+
+	serialized, err := jwt.Sign(token, jwa.HS256, secret)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return challenge, string(serialized), nil
+}
+
+func (service *WebAuthnService) parseSession(session string, ceremony string) (jwt.Token, error) {
+	config := service.config.Get()
+
+	secret, err := sessionSecret(config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := jwt.Parse(
+		[]byte(session),
+		jwt.WithVerify(jwa.HS256, secret),
+		jwt.WithValidate(true),
+		jwt.WithIssuer(SESSION_ISSUER),
+		jwt.WithAudience(SESSION_ISSUER),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid session: %v", domain.ErrInvalidCredential, err)
+	}
+
+	use, ok := decoded.Get("use")
+	if !ok || use != string(Ceremony) {
+		return nil, fmt.Errorf("%w: expected ceremony session", domain.ErrInvalidCredential)
+	}
+
+	kind, ok := decoded.Get("ceremony")
+	if !ok || kind != ceremony {
+		return nil, fmt.Errorf("%w: expected %s ceremony", domain.ErrInvalidCredential, ceremony)
+	}
+
+	return decoded, nil
+}
+
+// useSession marks the session challenge as used until the session expires,
+// sessions are stateless so this is what stops an assertion from being replayed
+func (service *WebAuthnService) useSession(ctx context.Context, session jwt.Token) error {
+	err := service.challenges.Use(ctx, sessionClaim(session, "challenge"), session.Expiration())
+
+	if errors.Is(err, domain.ErrDuplicate) {
+		return fmt.Errorf("%w: session was already used", domain.ErrInvalidCredential)
+	}
+
+	return err
+}
+
+// sessionSecret returns the HMAC key of the ceremony sessions, when it's not configured
+// it's derived from the token private key so every instance uses the same key
+func sessionSecret(config *domain.Config) ([]byte, error) {
+	if config.WebAuthn.SessionSecret != "" {
+		return []byte(config.WebAuthn.SessionSecret), nil
+	}
+
+	if config.Token.PrivateKey == "" {
+		return nil, errors.New("webAuthn.sessionSecret or token.privateKey is required")
+	}
+
+	mac := hmac.New(sha256.New, []byte(config.Token.PrivateKey))
+	mac.Write([]byte(SESSION_ISSUER))
+	return mac.Sum(nil), nil
+}
+
+// sessionClaim returns a string claim of a ceremony session, it's empty when it's missing
+func sessionClaim(session jwt.Token, name string) string {
+	value, _ := session.Get(name)
+	claim, _ := value.(string)
+	return claim
+}
+
+func (service *WebAuthnService) verifyClientData(raw []byte, ceremonyType string, session jwt.Token) error {
+	config := service.config.Get()
+
+	var clientData struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return fmt.Errorf("%w: malformed client data", domain.ErrInvalidCredential)
+	}
+
+	if clientData.Type != ceremonyType {
+		return fmt.Errorf("%w: expected client data type %q got %q", domain.ErrInvalidCredential, ceremonyType, clientData.Type)
+	}
+
+	expected, _ := session.Get("challenge")
+	expectedChallenge, _ := expected.(string)
+
+	if expectedChallenge == "" || subtle.ConstantTimeCompare([]byte(expectedChallenge), []byte(clientData.Challenge)) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", domain.ErrInvalidCredential)
+	}
+
+	for _, origin := range config.WebAuthn.Origins {
+		if origin == clientData.Origin {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: origin %q is not allowed", domain.ErrInvalidCredential, clientData.Origin)
+}
+
+func (service *WebAuthnService) parseAuthenticatorData(raw []byte) (authenticatorData, error) {
+	config := service.config.Get()
+
+	if len(raw) < authenticatorDataMinSize {
+		return authenticatorData{}, fmt.Errorf("%w: authenticator data is too short", domain.ErrInvalidCredential)
+	}
+
+	data := authenticatorData{
+		rpIdHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+
+	rpIdHash := sha256.Sum256([]byte(config.WebAuthn.RPID))
+	if subtle.ConstantTimeCompare(data.rpIdHash, rpIdHash[:]) != 1 {
+		return authenticatorData{}, fmt.Errorf("%w: relying party mismatch", domain.ErrInvalidCredential)
+	}
+
+	if data.flags&flagUserPresent == 0 {
+		return authenticatorData{}, fmt.Errorf("%w: user is not present", domain.ErrInvalidCredential)
+	}
+
+	if config.WebAuthn.UserVerification == "required" && data.flags&flagUserVerified == 0 {
+		return authenticatorData{}, fmt.Errorf("%w: user is not verified", domain.ErrInvalidCredential)
+	}
+
+	if data.flags&flagAttestedCredential == 0 {
+		return data, nil
+	}
+
+	// AAGUID (16 bytes) + credential id length (2 bytes)
+	rest := raw[authenticatorDataMinSize:]
+	if len(rest) < 18 {
+		return authenticatorData{}, fmt.Errorf("%w: attested credential data is too short", domain.ErrInvalidCredential)
+	}
+
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+
+	if len(rest) < idLength {
+		return authenticatorData{}, fmt.Errorf("%w: credential id is too short", domain.ErrInvalidCredential)
+	}
+
+	data.credentialId = rest[:idLength]
+
+	// The public key is followed by optional extensions, only the first CBOR item is the key
+	var publicKey cbor.RawMessage
+	if err := cbor.NewDecoder(bytes.NewReader(rest[idLength:])).Decode(&publicKey); err != nil {
+		return authenticatorData{}, fmt.Errorf("%w: malformed public key", domain.ErrInvalidCredential)
+	}
+
+	data.publicKey = publicKey
+	return data, nil
+}
+
+func parsePublicKey(raw []byte) (crypto.PublicKey, error) {
+	var key struct {
+		KeyType   int64           `cbor:"1,keyasint"`
+		Algorithm int64           `cbor:"3,keyasint"`
+		Param1    cbor.RawMessage `cbor:"-1,keyasint"`
+		Param2    cbor.RawMessage `cbor:"-2,keyasint"`
+		Param3    cbor.RawMessage `cbor:"-3,keyasint"`
+	}
+
+	if err := cbor.Unmarshal(raw, &key); err != nil {
+		return nil, fmt.Errorf("%w: malformed public key", domain.ErrInvalidCredential)
+	}
+
+	switch {
+	case key.KeyType == coseKeyEC2 && key.Algorithm == coseES256:
+		var curve int64
+		var x, y []byte
+		if cbor.Unmarshal(key.Param1, &curve) != nil || cbor.Unmarshal(key.Param2, &x) != nil || cbor.Unmarshal(key.Param3, &y) != nil {
+			return nil, fmt.Errorf("%w: malformed EC2 public key", domain.ErrInvalidCredential)
+		}
+
+		if curve != coseCurveP256 {
+			return nil, fmt.Errorf("%w: unsupported curve %d", domain.ErrInvalidCredential, curve)
+		}
+
+		publicKey := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+
+		if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+			return nil, fmt.Errorf("%w: invalid EC2 public key", domain.ErrInvalidCredential)
+		}
+
+		return publicKey, nil
+	case key.KeyType == coseKeyRSA && key.Algorithm == coseRS256:
+		var n, e []byte
+		if cbor.Unmarshal(key.Param1, &n) != nil || cbor.Unmarshal(key.Param2, &e) != nil || len(e) > 4 {
+			return nil, fmt.Errorf("%w: malformed RSA public key", domain.ErrInvalidCredential)
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: unsupported algorithm %d", domain.ErrInvalidCredential, key.Algorithm)
+}
+
+func verifySignature(publicKey crypto.PublicKey, signed []byte, signature []byte) bool {
+	hash := sha256.Sum256(signed)
+
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, hash[:], signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature) == nil
+	}
+
+	return false
+}
+
+func descriptors(credentials []domain.Credential) []domain.CredentialDescriptor {
+	result := make([]domain.CredentialDescriptor, 0, len(credentials))
+
+	for _, credential := range credentials {
+		id, err := base64.RawURLEncoding.DecodeString(credential.Id)
+
+		if err != nil {
+			log.Warn().Err(err).Str("credential", credential.Id).Msg("Skipping credential with invalid id")
+			continue
+		}
+
+		result = append(result, domain.CredentialDescriptor{
+			Type:       "public-key",
+			Id:         id,
+			Transports: credential.Transports,
+		})
+	}
+
+	return result
+}
@@ -0,0 +1,507 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwt"
+	mvdatetime "github.com/sy-software/minerva-go-utils/datetime"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"github.com/sy-software/minerva-spear-users/mocks"
+)
+
+const RP_ID = "minerva.test"
+const RP_ORIGIN = "https://minerva.test"
+
+func TestPasskeyRegistration(t *testing.T) {
+	config := webAuthnConfig()
+	authenticator := newSoftAuthenticator(t)
+	var stored domain.Credential
+
+	users := mocks.UserRepo{
+		GetByIdInterceptor: func(id string) (domain.User, error) {
+			return domain.User{Id: id, Username: "IronMan", Name: "Tony Stark"}, nil
+		},
+	}
+
+	credentials := mocks.CredentialRepo{
+		GetByUserInterceptor: func(userId string) ([]domain.Credential, error) {
+			return []domain.Credential{}, nil
+		},
+		GetByIdInterceptor: func(id string) (domain.Credential, error) {
+			return domain.Credential{}, domain.ErrNotFound
+		},
+		CreateInterceptor: func(credential domain.Credential) (domain.Credential, error) {
+			stored = credential
+			return credential, nil
+		},
+	}
+
+	service := NewWebAuthnService(&users, &credentials, usedChallenges(), NewRS256Signer(), domain.NewConfigSnapshot(config))
+	options, err := service.BeginRegistration(context.Background(), "newid")
+
+	if err != nil {
+		t.Fatalf("Expected registration options without error, got: %v", err)
+	}
+
+	if options.PublicKey.RelyingParty.Id != RP_ID {
+		t.Errorf("Expected relying party: %q got: %q", RP_ID, options.PublicKey.RelyingParty.Id)
+	}
+
+	if string(options.PublicKey.User.Id) != "newid" {
+		t.Errorf("Expected user handle to be the user id got: %q", options.PublicKey.User.Id)
+	}
+
+	credential, err := service.FinishRegistration(context.Background(), "newid", authenticator.create(options, RP_ORIGIN))
+
+	if err != nil {
+		t.Fatalf("Expected registration without error, got: %v", err)
+	}
+
+	if credential.Id != domain.Base64URL(authenticator.credentialId).String() {
+		t.Errorf("Expected credential id: %q got: %q", domain.Base64URL(authenticator.credentialId), credential.Id)
+	}
+
+	if stored.UserId != "newid" {
+		t.Errorf("Expected credential to be stored for user newid got: %q", stored.UserId)
+	}
+
+	if _, err := parsePublicKey(stored.PublicKey); err != nil {
+		t.Errorf("Expected stored public key to be parseable, got: %v", err)
+	}
+
+	t.Run("Test wrong user", func(t *testing.T) {
+		options, _ := service.BeginRegistration(context.Background(), "newid")
+		_, err := service.FinishRegistration(context.Background(), "otherid", authenticator.create(options, RP_ORIGIN))
+
+		if !errors.Is(err, domain.ErrInvalidCredential) {
+			t.Errorf("Expected invalid credential error got: %v", err)
+		}
+	})
+
+	t.Run("Test credential lookup error", func(t *testing.T) {
+		notFound := credentials.GetByIdInterceptor
+		credentials.GetByIdInterceptor = func(id string) (domain.Credential, error) {
+			return domain.Credential{}, domain.ErrUnavailable
+		}
+		defer func() { credentials.GetByIdInterceptor = notFound }()
+		creates := credentials.CallCount("Create")
+
+		options, _ := service.BeginRegistration(context.Background(), "newid")
+		_, err := service.FinishRegistration(context.Background(), "newid", authenticator.create(options, RP_ORIGIN))
+
+		if !errors.Is(err, domain.ErrUnavailable) {
+			t.Errorf("Expected unavailable error got: %v", err)
+		}
+
+		if credentials.CallCount("Create") != creates {
+			t.Error("Expected the credential not to be stored")
+		}
+	})
+
+	t.Run("Test wrong origin", func(t *testing.T) {
+		options, _ := service.BeginRegistration(context.Background(), "newid")
+		_, err := service.FinishRegistration(context.Background(), "newid", authenticator.create(options, "https://evil.test"))
+
+		if !errors.Is(err, domain.ErrInvalidCredential) {
+			t.Errorf("Expected invalid credential error got: %v", err)
+		}
+	})
+
+	t.Run("Test inactive user", func(t *testing.T) {
+		active := users.GetByIdInterceptor
+		users.GetByIdInterceptor = func(id string) (domain.User, error) {
+			return domain.User{Id: id, Username: "IronMan", Status: domain.UserSuspended}, nil
+		}
+		defer func() { users.GetByIdInterceptor = active }()
+		lookups := credentials.CallCount("GetByUser")
+
+		_, err := service.BeginRegistration(context.Background(), "newid")
+
+		if !errors.Is(err, domain.ErrUserNotActive) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrUserNotActive, err)
+		}
+
+		if credentials.CallCount("GetByUser") != lookups {
+			t.Error("Expected the credentials not to be listed")
+		}
+	})
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	config := webAuthnConfig()
+	authenticator := newSoftAuthenticator(t)
+
+	expectedInfo := domain.User{
+		Id:       "newid",
+		Name:     "Tony Stark",
+		Username: "IronMan",
+		Picture:  "https://picture.com/ironman",
+	}
+
+	stored := domain.Credential{
+		Id:        domain.Base64URL(authenticator.credentialId).String(),
+		UserId:    expectedInfo.Id,
+		PublicKey: authenticator.publicKey(),
+	}
+
+	users := mocks.UserRepo{
+		GetByIdInterceptor: func(id string) (domain.User, error) {
+			return expectedInfo, nil
+		},
+		GetByUsernameInterceptor: func(username string) (domain.User, error) {
+			return expectedInfo, nil
+		},
+	}
+
+	credentials := mocks.CredentialRepo{
+		GetByUserInterceptor: func(userId string) ([]domain.Credential, error) {
+			return []domain.Credential{stored}, nil
+		},
+		GetByIdInterceptor: func(id string) (domain.Credential, error) {
+			if id != stored.Id {
+				return domain.Credential{}, domain.ErrNotFound
+			}
+
+			return stored, nil
+		},
+		UpdateSignCountInterceptor: func(id string, signCount uint32) error {
+			stored.SignCount = signCount
+			return nil
+		},
+	}
+
+	service := NewWebAuthnService(&users, &credentials, usedChallenges(), NewRS256Signer(), domain.NewConfigSnapshot(config))
+	options, err := service.BeginLogin(context.Background(), "IronMan")
+
+	if err != nil {
+		t.Fatalf("Expected login options without error, got: %v", err)
+	}
+
+	if len(options.PublicKey.AllowCredentials) != 0 {
+		t.Errorf("Expected the credentials of the user to be hidden got: %d", len(options.PublicKey.AllowCredentials))
+	}
+
+	if calls := users.CallCount("GetByUsername"); calls != 0 {
+		t.Errorf("Expected the user to be looked up when the login finishes got: %d calls", calls)
+	}
+
+	now := mvdatetime.UnixUTCNow()
+	token, err := service.FinishLogin(context.Background(), authenticator.get(options, RP_ORIGIN, expectedInfo.Id))
+
+	if err != nil {
+		t.Fatalf("Expected login without error, got: %v", err)
+	}
+
+	if stored.SignCount != authenticator.signCount {
+		t.Errorf("Expected sign count to be updated to: %d got: %d", authenticator.signCount, stored.SignCount)
+	}
+
+	assertUserToken(&token, &config, now, &expectedInfo, t)
+
+	t.Run("Test discoverable credential", func(t *testing.T) {
+		options, err := service.BeginLogin(context.Background(), "")
+
+		if err != nil {
+			t.Fatalf("Expected login options without error, got: %v", err)
+		}
+
+		if len(options.PublicKey.AllowCredentials) != 0 {
+			t.Errorf("Expected no allowed credentials got: %d", len(options.PublicKey.AllowCredentials))
+		}
+
+		_, err = service.FinishLogin(context.Background(), authenticator.get(options, RP_ORIGIN, expectedInfo.Id))
+
+		if err != nil {
+			t.Errorf("Expected login without error, got: %v", err)
+		}
+	})
+
+	t.Run("Test session", func(t *testing.T) {
+		options, _ := service.BeginLogin(context.Background(), "IronMan")
+		key, _ := config.Token.KeyPair()
+
+		if _, err := jwt.Parse([]byte(options.Session), jwt.WithVerify(jwa.RS256, key.PublicKey)); err == nil {
+			t.Error("Expected the session to be rejected as a token signed with the token key")
+		}
+
+		session, err := jwt.Parse([]byte(options.Session))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if session.Subject() != "" || session.Issuer() == TOKEN_ISSUER {
+			t.Errorf("Expected a session without subject and token issuer got: %q %q", session.Subject(), session.Issuer())
+		}
+	})
+
+	t.Run("Test unknown username", func(t *testing.T) {
+		known, _ := service.BeginLogin(context.Background(), "IronMan")
+		unknown, err := service.BeginLogin(context.Background(), "Nobody")
+
+		if err != nil {
+			t.Fatalf("Expected login options without error, got: %v", err)
+		}
+
+		if len(unknown.PublicKey.AllowCredentials) != len(known.PublicKey.AllowCredentials) || unknown.PublicKey.RelyingPartyId != known.PublicKey.RelyingPartyId {
+			t.Errorf("Expected the same options for unknown users got: %+v", unknown.PublicKey)
+		}
+	})
+
+	t.Run("Test credential of other user", func(t *testing.T) {
+		users.GetByUsernameInterceptor = func(username string) (domain.User, error) {
+			return domain.User{Id: "otherid", Username: username}, nil
+		}
+		defer func() {
+			users.GetByUsernameInterceptor = func(username string) (domain.User, error) {
+				return expectedInfo, nil
+			}
+		}()
+
+		options, _ := service.BeginLogin(context.Background(), "Hulk")
+		_, err := service.FinishLogin(context.Background(), authenticator.get(options, RP_ORIGIN, expectedInfo.Id))
+
+		if !errors.Is(err, domain.ErrInvalidCredential) {
+			t.Errorf("Expected invalid credential error got: %v", err)
+		}
+	})
+
+	t.Run("Test replayed assertion", func(t *testing.T) {
+		// Authenticators without a counter always report zero, the counter can't detect the replay
+		counter := stored.SignCount
+		authenticator.signCount = 0
+		stored.SignCount = 0
+		defer func() { authenticator.signCount, stored.SignCount = counter, counter }()
+
+		options, _ := service.BeginLogin(context.Background(), "IronMan")
+		assertion := authenticator.get(options, RP_ORIGIN, expectedInfo.Id)
+		assertion.Response.AuthenticatorData = authenticatorDataWithCounter(assertion.Response.AuthenticatorData, 0)
+		assertion.Response.Signature = authenticator.sign(assertion.Response.AuthenticatorData, assertion.Response.ClientDataJSON)
+
+		if _, err := service.FinishLogin(context.Background(), assertion); err != nil {
+			t.Fatalf("Expected login without error, got: %v", err)
+		}
+
+		if _, err := service.FinishLogin(context.Background(), assertion); !errors.Is(err, domain.ErrInvalidCredential) {
+			t.Errorf("Expected invalid credential error got: %v", err)
+		}
+	})
+
+	t.Run("Test inactive user", func(t *testing.T) {
+		users.GetByIdInterceptor = func(id string) (domain.User, error) {
+			return domain.User{Id: id, Status: domain.UserSuspended}, nil
+		}
+		defer func() {
+			users.GetByIdInterceptor = func(id string) (domain.User, error) {
+				return expectedInfo, nil
+			}
+		}()
+
+		updates := credentials.CallCount("UpdateSignCount")
+		options, _ := service.BeginLogin(context.Background(), "")
+		_, err := service.FinishLogin(context.Background(), authenticator.get(options, RP_ORIGIN, expectedInfo.Id))
+
+		if !errors.Is(err, domain.ErrUserNotActive) {
+			t.Errorf("Expected user not active error got: %v", err)
+		}
+
+		if credentials.CallCount("UpdateSignCount") != updates {
+			t.Error("Expected the sign count of inactive users to be kept")
+		}
+	})
+
+	t.Run("Test cloned authenticator", func(t *testing.T) {
+		options, _ := service.BeginLogin(context.Background(), "IronMan")
+		authenticator.signCount = 1
+		_, err := service.FinishLogin(context.Background(), authenticator.get(options, RP_ORIGIN, expectedInfo.Id))
+
+		if !errors.Is(err, domain.ErrInvalidCredential) {
+			t.Errorf("Expected invalid credential error got: %v", err)
+		}
+	})
+
+	t.Run("Test invalid signature", func(t *testing.T) {
+		options, _ := service.BeginLogin(context.Background(), "IronMan")
+		credential := authenticator.get(options, RP_ORIGIN, expectedInfo.Id)
+		credential.Response.Signature[len(credential.Response.Signature)-1] ^= 0xff
+		_, err := service.FinishLogin(context.Background(), credential)
+
+		if !errors.Is(err, domain.ErrInvalidCredential) {
+			t.Errorf("Expected invalid credential error got: %v", err)
+		}
+	})
+
+	t.Run("Test registration session", func(t *testing.T) {
+		registration, _ := service.BeginRegistration(context.Background(), "newid")
+		options := domain.CredentialAssertion{
+			Session: registration.Session,
+			PublicKey: domain.RequestOptions{
+				Challenge: registration.PublicKey.Challenge,
+			},
+		}
+		_, err := service.FinishLogin(context.Background(), authenticator.get(options, RP_ORIGIN, expectedInfo.Id))
+
+		if !errors.Is(err, domain.ErrInvalidCredential) {
+			t.Errorf("Expected invalid credential error got: %v", err)
+		}
+	})
+}
+
+// Utils
+
+func webAuthnConfig() domain.Config {
+	config := domain.DefaultConfig()
+	config.Token.PrivateKey = PRIVATE_KEY
+	config.Token.PublicKey = PUBLIC_KEY
+	config.WebAuthn.RPID = RP_ID
+	config.WebAuthn.Origins = []string{RP_ORIGIN}
+	return config
+}
+
+// usedChallenges returns a ChallengeRepo that remembers the used challenges
+func usedChallenges() *mocks.ChallengeRepo {
+	used := map[string]bool{}
+	return &mocks.ChallengeRepo{
+		UseInterceptor: func(challenge string, expire time.Time) error {
+			if used[challenge] {
+				return domain.ErrDuplicate
+			}
+
+			used[challenge] = true
+			return nil
+		},
+	}
+}
+
+// softAuthenticator emulates a platform authenticator with an ES256 key
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialId []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatalf("Can't generate authenticator key: %v", err)
+	}
+
+	credentialId := make([]byte, 16)
+	rand.Read(credentialId)
+
+	return &softAuthenticator{
+		key:          key,
+		credentialId: credentialId,
+	}
+}
+
+func (a *softAuthenticator) publicKey() []byte {
+	encoded, _ := cbor.Marshal(map[int]interface{}{
+		1:  coseKeyEC2,
+		3:  coseES256,
+		-1: coseCurveP256,
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+
+	return encoded
+}
+
+func (a *softAuthenticator) authenticatorData(attested []byte) []byte {
+	rpIdHash := sha256.Sum256([]byte(RP_ID))
+	data := append([]byte{}, rpIdHash[:]...)
+
+	flags := flagUserPresent | flagUserVerified
+	if attested != nil {
+		flags |= flagAttestedCredential
+	}
+
+	counter := make([]byte, 4)
+	binary.BigEndian.PutUint32(counter, a.signCount)
+
+	data = append(data, flags)
+	data = append(data, counter...)
+	return append(data, attested...)
+}
+
+func clientData(ceremonyType string, challenge domain.Base64URL, origin string) []byte {
+	data, _ := json.Marshal(map[string]string{
+		"type":      ceremonyType,
+		"challenge": challenge.String(),
+		"origin":    origin,
+	})
+
+	return data
+}
+
+func (a *softAuthenticator) create(options domain.CredentialCreation, origin string) domain.RegistrationCredential {
+	attested := make([]byte, 16)
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(a.credentialId)))
+	attested = append(attested, length...)
+	attested = append(attested, a.credentialId...)
+	attested = append(attested, a.publicKey()...)
+
+	attestation, _ := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authenticatorData(attested),
+	})
+
+	return domain.RegistrationCredential{
+		Session: options.Session,
+		Id:      domain.Base64URL(a.credentialId).String(),
+		RawId:   a.credentialId,
+		Type:    "public-key",
+		Response: domain.AttestationResponse{
+			ClientDataJSON:    clientData("webauthn.create", options.PublicKey.Challenge, origin),
+			AttestationObject: attestation,
+			Transports:        []string{"internal"},
+		},
+	}
+}
+
+func (a *softAuthenticator) get(options domain.CredentialAssertion, origin string, userHandle string) domain.LoginCredential {
+	a.signCount++
+	authData := a.authenticatorData(nil)
+	clientDataJSON := clientData("webauthn.get", options.PublicKey.Challenge, origin)
+	signature := a.sign(authData, clientDataJSON)
+
+	return domain.LoginCredential{
+		Session: options.Session,
+		Id:      domain.Base64URL(a.credentialId).String(),
+		RawId:   a.credentialId,
+		Type:    "public-key",
+		Response: domain.AssertionResponse{
+			ClientDataJSON:    clientDataJSON,
+			AuthenticatorData: authData,
+			Signature:         signature,
+			UserHandle:        domain.Base64URL(userHandle),
+		},
+	}
+}
+
+func (a *softAuthenticator) sign(authData []byte, clientDataJSON []byte) []byte {
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	hash := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, _ := ecdsa.SignASN1(rand.Reader, a.key, hash[:])
+	return signature
+}
+
+// authenticatorDataWithCounter returns a copy of the authenticator data with other sign counter
+func authenticatorDataWithCounter(authData []byte, signCount uint32) []byte {
+	changed := append([]byte{}, authData...)
+	binary.BigEndian.PutUint32(changed[33:37], signCount)
+	return changed
+}
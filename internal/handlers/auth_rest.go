@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
@@ -20,28 +25,31 @@ const (
 	USER_INFO_HEADER  string = "X-USER-INFO"
 	TOKEN_USE_HEADER  string = "X-TOKEN-USE"
 	USER_ID_HEADER    string = "X-USER-ID"
+	USER_ROLE_HEADER  string = "X-USER-ROLE"
 )
 
 type AuthRESTHandler struct {
-	config  *domain.Config
+	config  *domain.ConfigSnapshot
+	catalog *catalogSnapshot
 	service ports.AuthService
 }
 
-func NewAuthRESTHandler(config *domain.Config, service ports.AuthService) *AuthRESTHandler {
+func NewAuthRESTHandler(config *domain.ConfigSnapshot, service ports.AuthService) *AuthRESTHandler {
 	return &AuthRESTHandler{
 		config:  config,
+		catalog: newCatalogSnapshot(config),
 		service: service,
 	}
 }
 
-func (handler *AuthRESTHandler) CreateRoutes(router *gin.Engine) {
-	group := router.Group(handler.config.APIPrefix)
+func (handler *AuthRESTHandler) CreateRoutes(router gin.IRouter) {
+	group := router.Group(handler.config.Get().APIPrefix)
 	{
 		group.POST("/login", func(c *gin.Context) {
 			token, err := handler.Login(c)
 
 			if err != nil {
-				handleError(err, c)
+				handleError(err, c, handler.catalog.Get())
 				return
 			}
 
@@ -52,7 +60,7 @@ func (handler *AuthRESTHandler) CreateRoutes(router *gin.Engine) {
 			token, err := handler.Refresh(c)
 
 			if err != nil {
-				handleError(err, c)
+				handleError(err, c, handler.catalog.Get())
 				return
 			}
 
@@ -63,7 +71,7 @@ func (handler *AuthRESTHandler) CreateRoutes(router *gin.Engine) {
 			token, err := handler.Register(c)
 
 			if err != nil {
-				handleError(err, c)
+				handleError(err, c, handler.catalog.Get())
 				return
 			}
 
@@ -74,7 +82,7 @@ func (handler *AuthRESTHandler) CreateRoutes(router *gin.Engine) {
 			token, err := handler.Authenticate(c)
 
 			if err != nil {
-				handleError(err, c)
+				handleError(err, c, handler.catalog.Get())
 				return
 			}
 
@@ -85,15 +93,134 @@ func (handler *AuthRESTHandler) CreateRoutes(router *gin.Engine) {
 			user, err := handler.Me(c)
 
 			if err != nil {
-				handleError(err, c)
+				handleError(err, c, handler.catalog.Get())
 				return
 			}
 
 			c.JSON(http.StatusOK, gin.H{"data": user})
 		})
+
+		group.PATCH("/me", func(c *gin.Context) {
+			token, err := handler.UpdateMe(c)
+
+			if err != nil {
+				handleError(err, c, handler.catalog.Get())
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"data": token})
+		})
+	}
+
+	admin := router.Group(handler.config.Get().APIPrefix+"/admin", handler.RequireAdmin)
+	{
+		admin.GET("/users", func(c *gin.Context) {
+			page, err := handler.ListUsers(c)
+
+			if err != nil {
+				handleError(err, c, handler.catalog.Get())
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"data": page})
+		})
+
+		admin.GET("/users/:id", func(c *gin.Context) {
+			user, err := handler.GetUser(c)
+
+			if err != nil {
+				handleError(err, c, handler.catalog.Get())
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"data": user})
+		})
+
+		admin.GET("/usernames/:username", func(c *gin.Context) {
+			user, err := handler.GetUserByUsername(c)
+
+			if err != nil {
+				handleError(err, c, handler.catalog.Get())
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"data": user})
+		})
+
+		admin.PATCH("/users/:id", func(c *gin.Context) {
+			user, err := handler.UpdateUser(c)
+
+			if err != nil {
+				handleError(err, c, handler.catalog.Get())
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"data": user})
+		})
+
+		admin.POST("/users/:id/suspend", func(c *gin.Context) {
+			user, err := handler.Suspend(c)
+
+			if err != nil {
+				handleError(err, c, handler.catalog.Get())
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"data": user})
+		})
+
+		admin.POST("/users/:id/reactivate", func(c *gin.Context) {
+			user, err := handler.Reactivate(c)
+
+			if err != nil {
+				handleError(err, c, handler.catalog.Get())
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"data": user})
+		})
+
+		admin.DELETE("/users/:id", func(c *gin.Context) {
+			user, err := handler.Delete(c)
+
+			if err != nil {
+				handleError(err, c, handler.catalog.Get())
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"data": user})
+		})
+
+		admin.POST("/users/:id/erase", func(c *gin.Context) {
+			err := handler.Erase(c)
+
+			if err != nil {
+				handleError(err, c, handler.catalog.Get())
+				return
+			}
+
+			c.Status(http.StatusNoContent)
+		})
 	}
 }
 
+// RequireAdmin aborts the request unless the caller has one of the configured admin roles
+// the role is forwarded by the gateway after validating the access token
+func (handler *AuthRESTHandler) RequireAdmin(c *gin.Context) {
+	role := c.Request.Header.Get(USER_ROLE_HEADER)
+
+	for _, admin := range handler.config.Get().AdminRoles {
+		if role == admin && role != "" {
+			c.Next()
+			return
+		}
+	}
+
+	log.Warn().Str("role", role).Msg("Admin endpoint called without admin role")
+	handleError(&ForbiddenErr, c, handler.catalog.Get())
+	c.Abort()
+}
+
 func (handler *AuthRESTHandler) Login(c *gin.Context) (domain.UserToken, error) {
 	var login domain.Login
 
@@ -119,17 +246,19 @@ func (handler *AuthRESTHandler) Login(c *gin.Context) (domain.UserToken, error)
 		return domain.UserToken{}, &InvalidRequestError
 	}
 
-	user, err := handler.service.Login(login)
+	user, err := handler.service.Login(requestContext(c), login)
 
 	if err != nil {
 		log.Error().Err(err).Msg("Login error")
-		if err.Error() == "not_found" {
+		if errors.Is(err, domain.ErrNotFound) {
 			return domain.UserToken{}, &UserNotRegisteredErr
 		}
 
-		// Any other error is considered an unknown or unexpected error
-		// user should only get internal server error
-		return domain.UserToken{}, &InternalServerError
+		if errors.Is(err, domain.ErrUserNotActive) {
+			return domain.UserToken{}, &UserNotActiveErr
+		}
+
+		return domain.UserToken{}, unexpectedError(err)
 	}
 
 	return user, nil
@@ -156,16 +285,19 @@ func (handler *AuthRESTHandler) Register(c *gin.Context) (domain.UserToken, erro
 		return domain.UserToken{}, &InvalidRequestError
 	}
 
-	user, err := handler.service.Register(register)
+	user, err := handler.service.Register(requestContext(c), register)
 
 	if err != nil {
-		if err.Error() == "duplicated_value" {
+		if errors.Is(err, domain.ErrDuplicate) {
 			return domain.UserToken{}, &UserAlreadyRegisteredErr
 		}
 
-		// Any other error is considered an unknown or unexpected error
-		// user should only get internal server error
-		return domain.UserToken{}, &InternalServerError
+		var validation *domain.ValidationError
+		if errors.As(err, &validation) {
+			return domain.UserToken{}, withDetails(InvalidFieldsErr, validation.Fields)
+		}
+
+		return domain.UserToken{}, unexpectedError(err)
 	}
 
 	return user, nil
@@ -182,7 +314,23 @@ func (handler *AuthRESTHandler) Refresh(c *gin.Context) (domain.UserToken, error
 	groups := re.FindStringSubmatch(refreshToken)
 	refreshToken = groups[1]
 
-	return handler.service.Refresh(refreshToken)
+	token, err := handler.service.Refresh(requestContext(c), refreshToken)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Refresh error")
+		if errors.Is(err, domain.ErrUserNotActive) {
+			return domain.UserToken{}, &UserNotActiveErr
+		}
+
+		// Tokens that can't be verified or whose subject was erased
+		if errors.Is(err, domain.ErrInvalidToken) || errors.Is(err, domain.ErrNotFound) {
+			return domain.UserToken{}, &InavalidTokenErr
+		}
+
+		return domain.UserToken{}, unexpectedError(err)
+	}
+
+	return token, nil
 }
 
 func (handler *AuthRESTHandler) Authenticate(c *gin.Context) (domain.UserToken, error) {
@@ -211,18 +359,195 @@ func (handler *AuthRESTHandler) Me(c *gin.Context) (domain.User, error) {
 		return domain.User{}, fmt.Errorf("expected header %q to have exactly one value", USER_ID_HEADER)
 	}
 
-	return handler.service.Me(userId)
+	user, err := handler.service.Me(requestContext(c), userId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Me error")
+		if errors.Is(err, domain.ErrUserNotActive) {
+			return domain.User{}, &UserNotActiveErr
+		}
+
+		return domain.User{}, userError(err)
+	}
+
+	return user, nil
+}
+
+// ListUsers returns a page of users filtered by provider, status and role query params
+func (handler *AuthRESTHandler) ListUsers(c *gin.Context) (domain.UserPage, error) {
+	filter := domain.UserFilter{
+		Provider: c.Query("provider"),
+		Status:   c.Query("status"),
+		Role:     c.Query("role"),
+	}
+
+	switch filter.Status {
+	case "", domain.UserActive, domain.UserSuspended, domain.UserDeleted:
+	default:
+		return domain.UserPage{}, &InvalidRequestError
+	}
+
+	var err error
+	if filter.Page, err = intQuery(c, "page"); err != nil {
+		return domain.UserPage{}, &InvalidRequestError
+	}
+
+	if filter.PageSize, err = intQuery(c, "pageSize"); err != nil {
+		return domain.UserPage{}, &InvalidRequestError
+	}
+
+	page, err := handler.service.ListUsers(requestContext(c), filter)
+	if err != nil {
+		return domain.UserPage{}, userError(err)
+	}
+
+	return page, nil
+}
+
+// GetUser returns the user in the path, including inactive users
+func (handler *AuthRESTHandler) GetUser(c *gin.Context) (domain.User, error) {
+	user, err := handler.service.GetUser(requestContext(c), c.Param("id"))
+	return user, userError(err)
+}
+
+// GetUserByUsername returns the user with the username in the path, including inactive users
+func (handler *AuthRESTHandler) GetUserByUsername(c *gin.Context) (domain.User, error) {
+	user, err := handler.service.GetUserByUsername(requestContext(c), c.Param("username"))
+	return user, userError(err)
+}
+
+// UpdateUser changes the username, name, picture or role of the user in the path
+func (handler *AuthRESTHandler) UpdateUser(c *gin.Context) (domain.User, error) {
+	var update domain.UserUpdate
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&update); err != nil {
+		log.Error().Err(err).Msg("User update can't be decoded from JSON")
+		return domain.User{}, &InavalidBodyErr
+	}
+
+	if !validUpdate(&update) {
+		return domain.User{}, &InvalidRequestError
+	}
+
+	user, err := handler.service.UpdateUser(requestContext(c), c.Param("id"), update)
+	return user, userError(err)
+}
+
+// UpdateMe changes the current user username, name or picture
+// and returns a new token with the updated user info
+func (handler *AuthRESTHandler) UpdateMe(c *gin.Context) (domain.UserToken, error) {
+	var update domain.UserUpdate
+
+	userId := c.Request.Header.Get(USER_ID_HEADER)
+	if userId == "" {
+		return domain.UserToken{}, fmt.Errorf("expected header %q to have exactly one value", USER_ID_HEADER)
+	}
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&update); err != nil {
+		log.Error().Err(err).Msg("Profile update can't be decoded from JSON")
+		return domain.UserToken{}, &InavalidBodyErr
+	}
+
+	// The role can only be changed by an admin
+	if update.Role != nil || !validUpdate(&update) {
+		return domain.UserToken{}, &InvalidRequestError
+	}
+
+	token, err := handler.service.UpdateMe(requestContext(c), userId, update)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Profile update error")
+		if errors.Is(err, domain.ErrUserNotActive) {
+			return domain.UserToken{}, &UserNotActiveErr
+		}
+
+		return domain.UserToken{}, userError(err)
+	}
+
+	return token, nil
+}
+
+// Suspend blocks the user in the path from login or refresh its token
+func (handler *AuthRESTHandler) Suspend(c *gin.Context) (domain.User, error) {
+	user, err := handler.service.Suspend(requestContext(c), c.Param("id"))
+	return user, userError(err)
+}
+
+// Reactivate restores a suspended or deleted user
+func (handler *AuthRESTHandler) Reactivate(c *gin.Context) (domain.User, error) {
+	user, err := handler.service.Reactivate(requestContext(c), c.Param("id"))
+	return user, userError(err)
+}
+
+// Delete soft deletes the user in the path
+func (handler *AuthRESTHandler) Delete(c *gin.Context) (domain.User, error) {
+	user, err := handler.service.Delete(requestContext(c), c.Param("id"))
+	return user, userError(err)
+}
+
+// Erase permanently removes the user in the path and revokes its sessions
+func (handler *AuthRESTHandler) Erase(c *gin.Context) error {
+	return userError(handler.service.Erase(requestContext(c), c.Param("id")))
 }
 
 // Utils
 
-func handleError(err error, c *gin.Context) {
-	log.Error().Stack().Err(err).Msg("Request error")
-	// TODO: Map errors to HTTP status codes
-	if rest, ok := err.(*RestError); ok {
-		c.JSON(rest.HTTPStatus, gin.H{"error": rest})
-		return
+// requestContext returns the request context with the request ID so it reaches the repositories
+func requestContext(c *gin.Context) context.Context {
+	return domain.WithRequestId(c.Request.Context(), c.Request.Header.Get(REQUEST_ID_HEADER))
+}
+
+// validUpdate checks the update changes something and the fields are not blank
+func validUpdate(update *domain.UserUpdate) bool {
+	if update.Username == nil && update.Name == nil && update.Picture == nil && update.Role == nil {
+		return false
+	}
+
+	if update.Name != nil && strings.TrimSpace(*update.Name) == "" {
+		return false
+	}
+
+	if update.Role != nil && strings.TrimSpace(*update.Role) == "" {
+		return false
+	}
+
+	if update.Picture != nil && *update.Picture != "" {
+		picture, err := url.Parse(*update.Picture)
+		if err != nil || !picture.IsAbs() {
+			return false
+		}
+	}
+
+	return true
+}
+
+func intQuery(c *gin.Context, key string) (int, error) {
+	value := c.Query(key)
+	if value == "" {
+		return 0, nil
+	}
+
+	return strconv.Atoi(value)
+}
+
+func userError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	log.Error().Err(err).Msg("User operation error")
+	if errors.Is(err, domain.ErrNotFound) {
+		return &UserNotRegisteredErr
+	}
+
+	var validation *domain.ValidationError
+	if errors.As(err, &validation) {
+		return withDetails(InvalidFieldsErr, validation.Fields)
+	}
+
+	if errors.Is(err, domain.ErrUsernameTaken) {
+		return &UsernameTakenErr
 	}
 
-	c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+	return unexpectedError(err)
 }
@@ -3,15 +3,15 @@ package handlers
 import (
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sy-software/minerva-spear-users/internal/core/domain"
-	"github.com/sy-software/minerva-spear-users/internal/core/service"
 	"github.com/sy-software/minerva-spear-users/mocks"
 )
 
@@ -20,33 +20,22 @@ const PUBLIC_KEY = "-----BEGIN PUBLIC KEY-----\nMIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8A
 
 func TestLoginEndpoint(t *testing.T) {
 	config := domain.DefaultConfig()
-	config.Token.PrivateKey = PRIVATE_KEY
-	config.Token.PublicKey = PUBLIC_KEY
-
-	repo := mocks.UserRepo{
-		GetByUsernameInterceptor: func(username string) (domain.User, error) {
-			return domain.User{
-				Id:       "newid",
-				Name:     "Tony Stark",
-				Username: "IronMan",
-				Picture:  "https://picture.com/ironman",
-			}, nil
-		},
-	}
 
-	service := service.NewAuthService(&repo, config)
+	service := mocks.AuthService{}
+	service.Returns("Login", domain.UserToken{Info: domain.User{Id: "newid", Username: "IronMan"}}, nil)
 
-	handler := NewAuthRESTHandler(&config, service)
+	handler := NewAuthRESTHandler(domain.NewConfigSnapshot(config), &service)
 
 	userInfo := `
 	{
 		"username": "IronMan",
-		"provder": "StarkIndustries",
+		"provider": "StarkIndustries",
 		"tokenID": "myTokenId"
 	}
 	`
 	headers := http.Header{}
 	headers.Add(USER_INFO_HEADER, base64.StdEncoding.EncodeToString([]byte(userInfo)))
+	headers.Add(REQUEST_ID_HEADER, "request")
 	context := gin.Context{
 		Request: &http.Request{
 			Header: headers,
@@ -62,27 +51,27 @@ func TestLoginEndpoint(t *testing.T) {
 	if token.Info.Username != "IronMan" {
 		t.Errorf("Expected token for username: IronMan got: %q", token.Info.Username)
 	}
+
+	call, _ := service.LastCall("Login")
+	expected := domain.Login{Username: "IronMan", Provider: "StarkIndustries", TokenID: "myTokenId"}
+
+	if service.CallCount("Login") != 1 || call.Args[0] != expected {
+		t.Errorf("Expected service to receive: %+v got: %+v", expected, call.Args)
+	}
+
+	if requestId := domain.RequestId(call.Context); requestId != "request" {
+		t.Errorf("Expected request ID: %q got: %q", "request", requestId)
+	}
 }
 
 func TestRegisterEndpoint(t *testing.T) {
 	config := domain.DefaultConfig()
-	config.Token.PrivateKey = PRIVATE_KEY
-	config.Token.PublicKey = PUBLIC_KEY
-
-	repo := mocks.UserRepo{
-		CreateInterceptor: func(user domain.Register) (domain.User, error) {
-			return domain.User{
-				Id:       "newid",
-				Name:     "Tony Stark",
-				Username: "IronMan",
-				Picture:  "https://picture.com/ironman",
-			}, nil
-		},
-	}
 
-	service := service.NewAuthService(&repo, config)
+	service := mocks.AuthService{}
+	service.Returns("Register", domain.UserToken{Info: domain.User{Id: "newid", Username: "IronMan"}}, nil)
+	service.Returns("Register", domain.UserToken{}, domain.ErrDuplicate)
 
-	handler := NewAuthRESTHandler(&config, service)
+	handler := NewAuthRESTHandler(domain.NewConfigSnapshot(config), &service)
 
 	userInfo := `
 	{
@@ -90,7 +79,7 @@ func TestRegisterEndpoint(t *testing.T) {
 		"name": "Tony Stark",
 		"picture": "https://picture.com/tony",
 		"role": "hero",
-		"provder": "StarkIndustries",
+		"provider": "StarkIndustries",
 		"tokenID": "myTokenId"
 	}
 	`
@@ -111,112 +100,90 @@ func TestRegisterEndpoint(t *testing.T) {
 	if token.Info.Username != "IronMan" {
 		t.Errorf("Expected token for username: IronMan got: %q", token.Info.Username)
 	}
-}
 
-func TestRefreshEndpoint(t *testing.T) {
-	config := domain.DefaultConfig()
-	config.Token.PrivateKey = PRIVATE_KEY
-	config.Token.PublicKey = PUBLIC_KEY
-
-	repo := mocks.UserRepo{
-		GetByUsernameInterceptor: func(username string) (domain.User, error) {
-			return domain.User{
-				Id:       "newid",
-				Name:     "Tony Stark",
-				Username: "IronMan",
-				Picture:  "https://picture.com/ironman",
-			}, nil
-		},
-		GetByIdInterceptor: func(id string) (domain.User, error) {
-			return domain.User{
-				Id:       "newid",
-				Name:     "Tony Stark",
-				Username: "IronMan",
-				Picture:  "https://picture.com/ironman",
-			}, nil
-		},
+	expected := domain.Register{
+		Username: "IronMan",
+		Name:     "Tony Stark",
+		Picture:  "https://picture.com/tony",
+		Role:     "hero",
+		Provider: "StarkIndustries",
+		TokenID:  "myTokenId",
 	}
 
-	service := service.NewAuthService(&repo, config)
+	if call, _ := service.LastCall("Register"); call.Args[0] != expected {
+		t.Errorf("Expected service to receive: %+v got: %+v", expected, call.Args[0])
+	}
 
-	handler := NewAuthRESTHandler(&config, service)
+	_, err = handler.Register(&context)
 
-	userInfo := `
-	{
-		"username": "IronMan",
-		"provder": "StarkIndustries",
-		"tokenID": "myTokenId"
+	if err != &UserAlreadyRegisteredErr {
+		t.Errorf("Expected error: %v got: %v", UserAlreadyRegisteredErr, err)
 	}
-	`
+}
+
+func TestRefreshEndpoint(t *testing.T) {
+	config := domain.DefaultConfig()
+
+	service := mocks.AuthService{}
+	service.Returns("Refresh", domain.UserToken{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		Info:         domain.User{Id: "newid", Username: "IronMan"},
+	}, nil)
+
+	handler := NewAuthRESTHandler(domain.NewConfigSnapshot(config), &service)
 
 	headers := http.Header{}
-	headers.Add(USER_INFO_HEADER, base64.StdEncoding.EncodeToString([]byte(userInfo)))
+	headers.Add("Authorization", "Bearer myRefreshToken")
+	headers.Add(REQUEST_ID_HEADER, "request")
 	context := gin.Context{
 		Request: &http.Request{
 			Header: headers,
 		},
 	}
 
-	login, _ := handler.Login(&context)
-	// Wait a few seconds to have a token with different expiration
-	time.Sleep(1 * time.Second)
-
-	headers = http.Header{}
-	headers.Add("Authorization", "Bearer "+login.RefreshToken)
-	context = gin.Context{
-		Request: &http.Request{
-			Header: headers,
-		},
-	}
 	token, err := handler.Refresh(&context)
 
 	if err != nil {
 		t.Errorf("Expected to refresh token without error, got: %v", err)
 	}
 
-	if token.Info.Username != "IronMan" {
-		t.Errorf("Expected token for username: IronMan got: %q", token.Info.Username)
+	if token.Info.Username != "IronMan" || token.AccessToken != "access" || token.RefreshToken != "refresh" {
+		t.Errorf("Expected the service token got: %+v", token)
 	}
 
-	if login.AccessToken == token.AccessToken {
-		t.Errorf("Expected a new access token got the same as login")
+	call, _ := service.LastCall("Refresh")
+
+	if service.CallCount("Refresh") != 1 || call.Args[0] != "myRefreshToken" {
+		t.Errorf("Expected service to receive token: %q got: %v", "myRefreshToken", call.Args)
 	}
 
-	if login.RefreshToken == token.RefreshToken {
-		t.Errorf("Expected a new refresh access token got the same as login")
+	if requestId := domain.RequestId(call.Context); requestId != "request" {
+		t.Errorf("Expected request ID: %q got: %q", "request", requestId)
 	}
 }
 
 func TestAuthenticateEndpoint(t *testing.T) {
-	t.Run("Test login", func(t *testing.T) {
-		config := domain.DefaultConfig()
-		config.Token.PrivateKey = PRIVATE_KEY
-		config.Token.PublicKey = PUBLIC_KEY
-
-		repo := mocks.UserRepo{
-			GetByUsernameInterceptor: func(username string) (domain.User, error) {
-				return domain.User{
-					Id:       "newid",
-					Name:     "Tony Stark",
-					Username: "IronMan",
-					Picture:  "https://picture.com/ironman",
-				}, nil
-			},
-		}
+	config := domain.DefaultConfig()
 
-		service := service.NewAuthService(&repo, config)
+	userInfo := `
+	{
+		"username": "IronMan",
+		"name": "Tony Stark",
+		"picture": "https://picture.com/tony",
+		"role": "hero",
+		"provider": "StarkIndustries",
+		"tokenID": "myTokenId"
+	}
+	`
+	headers := http.Header{}
+	headers.Add(USER_INFO_HEADER, base64.StdEncoding.EncodeToString([]byte(userInfo)))
 
-		handler := NewAuthRESTHandler(&config, service)
+	t.Run("Test login", func(t *testing.T) {
+		service := mocks.AuthService{}
+		service.Returns("Login", domain.UserToken{Info: domain.User{Id: "newid", Username: "IronMan"}}, nil)
 
-		userInfo := `
-			{
-				"username": "IronMan",
-				"provder": "StarkIndustries",
-				"tokenID": "myTokenId"
-			}
-		`
-		headers := http.Header{}
-		headers.Add(USER_INFO_HEADER, base64.StdEncoding.EncodeToString([]byte(userInfo)))
+		handler := NewAuthRESTHandler(domain.NewConfigSnapshot(config), &service)
 		context := gin.Context{
 			Request: &http.Request{
 				Header: headers,
@@ -232,44 +199,24 @@ func TestAuthenticateEndpoint(t *testing.T) {
 		if token.Info.Username != "IronMan" {
 			t.Errorf("Expected token for username: IronMan got: %q", token.Info.Username)
 		}
-	})
 
-	t.Run("Test register", func(t *testing.T) {
-		config := domain.DefaultConfig()
-		config.Token.PrivateKey = PRIVATE_KEY
-		config.Token.PublicKey = PUBLIC_KEY
+		expected := domain.Login{Username: "IronMan", Provider: "StarkIndustries", TokenID: "myTokenId"}
 
-		repo := mocks.UserRepo{
-			GetByUsernameInterceptor: func(username string) (domain.User, error) {
-				return domain.User{}, errors.New("not_found")
-			},
-			CreateInterceptor: func(user domain.Register) (domain.User, error) {
-				return domain.User{
-					Id:       "newid",
-					Name:     "Tony Stark",
-					Username: "IronMan",
-					Picture:  "https://picture.com/ironman",
-				}, nil
-			},
+		if call, _ := service.LastCall("Login"); call.Args[0] != expected {
+			t.Errorf("Expected service to receive: %+v got: %+v", expected, call.Args)
 		}
 
-		service := service.NewAuthService(&repo, config)
-
-		handler := NewAuthRESTHandler(&config, service)
-
-		userInfo := `
-		{
-			"username": "IronMan",
-			"name": "Tony Stark",
-			"picture": "https://picture.com/tony",
-			"role": "hero",
-			"provder": "StarkIndustries",
-			"tokenID": "myTokenId"
+		if service.CallCount("Register") != 0 {
+			t.Error("Expected service.Register to not be called")
 		}
-		`
+	})
 
-		headers := http.Header{}
-		headers.Add(USER_INFO_HEADER, base64.StdEncoding.EncodeToString([]byte(userInfo)))
+	t.Run("Test register", func(t *testing.T) {
+		service := mocks.AuthService{}
+		service.Returns("Login", domain.UserToken{}, fmt.Errorf("%w: user", domain.ErrNotFound))
+		service.Returns("Register", domain.UserToken{Info: domain.User{Id: "newid", Username: "IronMan"}}, nil)
+
+		handler := NewAuthRESTHandler(domain.NewConfigSnapshot(config), &service)
 		context := gin.Context{
 			Request: &http.Request{
 				Header: headers,
@@ -285,103 +232,87 @@ func TestAuthenticateEndpoint(t *testing.T) {
 		if token.Info.Username != "IronMan" {
 			t.Errorf("Expected token for username: IronMan got: %q", token.Info.Username)
 		}
+
+		expected := domain.Register{
+			Username: "IronMan",
+			Name:     "Tony Stark",
+			Picture:  "https://picture.com/tony",
+			Role:     "hero",
+			Provider: "StarkIndustries",
+			TokenID:  "myTokenId",
+		}
+
+		if call, _ := service.LastCall("Register"); service.CallCount("Login") != 1 || call.Args[0] != expected {
+			t.Errorf("Expected service to receive: %+v got: %+v", expected, call.Args)
+		}
 	})
 }
 
 func TestMeEndpoint(t *testing.T) {
 	config := domain.DefaultConfig()
-	config.Token.PrivateKey = PRIVATE_KEY
-	config.Token.PublicKey = PUBLIC_KEY
-
-	called := false
-	repo := mocks.UserRepo{
-		GetByUsernameInterceptor: func(username string) (domain.User, error) {
-			return domain.User{
-				Id:       "newid",
-				Name:     "Tony Stark",
-				Username: "IronMan",
-				Picture:  "https://picture.com/ironman",
-			}, nil
-		},
-		GetByIdInterceptor: func(id string) (domain.User, error) {
-			called = true
 
-			if id != "newid" {
-				t.Errorf("Expected id to be \"newid\" got: %q", id)
-			}
+	service := mocks.AuthService{}
+	service.Returns("Me", domain.User{
+		Id:       "newid",
+		Name:     "Tony Stark",
+		Username: "IronMan",
+		Picture:  "https://picture.com/ironman",
+	}, nil)
 
-			return domain.User{
-				Id:       "newid",
-				Name:     "Tony Stark",
-				Username: "IronMan",
-				Picture:  "https://picture.com/ironman",
-			}, nil
-		},
-	}
-
-	service := service.NewAuthService(&repo, config)
-
-	handler := NewAuthRESTHandler(&config, service)
+	handler := NewAuthRESTHandler(domain.NewConfigSnapshot(config), &service)
 
-	body := `
-	{
-		"username": "IronMan",
-		"provder": "StarkIndustries",
-		"tokenID": "myTokenId"
-	}
-	`
-	bodyReader := io.NopCloser(strings.NewReader(body))
-	context := gin.Context{
-		Request: &http.Request{
-			Header: http.Header{},
-			Body:   bodyReader,
-		},
-	}
-
-	login, _ := handler.Login(&context)
 	headers := http.Header{}
-	headers.Add("Authorization", "Bearer "+login.AccessToken)
 	headers.Add(USER_ID_HEADER, "newid")
-	context = gin.Context{
+	context := gin.Context{
 		Request: &http.Request{
 			Header: headers,
 		},
 	}
+
 	info, err := handler.Me(&context)
 
 	if err != nil {
 		t.Errorf("Expected to /me to return without error, got: %v", err)
 	}
 
-	if !called {
-		t.Error("Expected repo.GetById to be called")
-	}
-
 	if info.Username != "IronMan" {
 		t.Errorf("Expected token for username: IronMan got: %q", info.Username)
 	}
+
+	if call, _ := service.LastCall("Me"); service.CallCount("Me") != 1 || call.Args[0] != "newid" {
+		t.Errorf("Expected service to receive id: %q got: %v", "newid", call.Args)
+	}
 }
 
 func TestErrors(t *testing.T) {
 	config := domain.DefaultConfig()
-	config.Token.PrivateKey = PRIVATE_KEY
-	config.Token.PublicKey = PUBLIC_KEY
 
-	t.Run("Test invalid token error", func(t *testing.T) {
-		repo := mocks.UserRepo{
-			GetByUsernameInterceptor: func(username string) (domain.User, error) {
-				return domain.User{
-					Id:       "newid",
-					Name:     "Tony Stark",
-					Username: "IronMan",
-					Picture:  "https://picture.com/ironman",
-				}, nil
-			},
+	userInfo := `
+	{
+		"username": "IronMan",
+		"name": "Tony Stark",
+		"provider": "StarkIndustries",
+		"tokenID": "myTokenId"
+	}
+	`
+	headers := http.Header{}
+	headers.Add(USER_INFO_HEADER, base64.StdEncoding.EncodeToString([]byte(userInfo)))
+
+	// restError returns err as a RestError or fails the test
+	restError := func(t *testing.T, err error) *RestError {
+		parsed, ok := err.(*RestError)
+
+		if !ok {
+			t.Fatalf("Expected error of type RestError got: %v", err)
 		}
 
-		service := service.NewAuthService(&repo, config)
+		return parsed
+	}
+
+	t.Run("Test invalid token error", func(t *testing.T) {
+		service := mocks.AuthService{}
+		handler := NewAuthRESTHandler(domain.NewConfigSnapshot(config), &service)
 
-		handler := NewAuthRESTHandler(&config, service)
 		headers := http.Header{}
 		headers.Add("Authorization", "Not A Bearer token")
 		context := gin.Context{
@@ -392,88 +323,174 @@ func TestErrors(t *testing.T) {
 
 		_, err := handler.Refresh(&context)
 
-		if err == nil {
-			t.Errorf("Expected an error got nil")
+		if parsed := restError(t, err); parsed.Code != InvalidToken {
+			t.Errorf("Expected error code: %d got: %d", InvalidToken, parsed.Code)
 		}
 
-		parsed, ok := err.(*RestError)
+		if service.CallCount("Refresh") != 0 {
+			t.Error("Expected service.Refresh to not be called")
+		}
+	})
 
-		if !ok {
-			t.Errorf("Expected error of type RestError got: %v", err)
+	t.Run("Test refresh token errors", func(t *testing.T) {
+		cases := []struct {
+			name     string
+			err      error
+			expected ErrorCode
+		}{
+			{name: "Test malformed token", err: fmt.Errorf("%w: malformed", domain.ErrInvalidToken), expected: InvalidToken},
+			{name: "Test erased user", err: fmt.Errorf("%w: user", domain.ErrNotFound), expected: InvalidToken},
+			{name: "Test user not active", err: domain.ErrUserNotActive, expected: UserNotActive},
 		}
 
-		if parsed.Code != InvalidToken {
-			t.Errorf("Expected error code: %d got: %d", InvalidToken, parsed.Code)
+		for _, testCase := range cases {
+			t.Run(testCase.name, func(t *testing.T) {
+				service := mocks.AuthService{}
+				service.Returns("Refresh", domain.UserToken{}, testCase.err)
+
+				handler := NewAuthRESTHandler(domain.NewConfigSnapshot(config), &service)
+
+				headers := http.Header{}
+				headers.Add("Authorization", "Bearer not.a.token")
+				context := gin.Context{
+					Request: &http.Request{
+						Header: headers,
+					},
+				}
+
+				_, err := handler.Refresh(&context)
+
+				if parsed := restError(t, err); parsed.Code != testCase.expected {
+					t.Errorf("Expected error code: %d got: %d", testCase.expected, parsed.Code)
+				}
+
+				if call, _ := service.LastCall("Refresh"); call.Args[0] != "not.a.token" {
+					t.Errorf("Expected service to receive token: %q got: %v", "not.a.token", call.Args)
+				}
+			})
 		}
 	})
 
 	t.Run("Test user not registered error", func(t *testing.T) {
-		repo := mocks.UserRepo{
-			GetByUsernameInterceptor: func(username string) (domain.User, error) {
-				return domain.User{}, errors.New("not_found")
+		service := mocks.AuthService{}
+		service.Returns("Login", domain.UserToken{}, fmt.Errorf("%w: user", domain.ErrNotFound))
+
+		handler := NewAuthRESTHandler(domain.NewConfigSnapshot(config), &service)
+		context := gin.Context{
+			Request: &http.Request{
+				Header: headers,
 			},
 		}
 
-		service := service.NewAuthService(&repo, config)
+		_, err := handler.Login(&context)
 
-		handler := NewAuthRESTHandler(&config, service)
+		if parsed := restError(t, err); parsed.Code != UserNotRegistered {
+			t.Errorf("Expected error code: %d got: %d", UserNotRegistered, parsed.Code)
+		}
 
-		userInfo := `
-		{
-			"username": "IronMan",
-			"provder": "StarkIndustries",
-			"tokenID": "myTokenId"
+		if service.CallCount("Login") != 1 {
+			t.Errorf("Expected service.Login to be called once got: %d", service.CallCount("Login"))
 		}
-		`
-		headers := http.Header{}
-		headers.Add(USER_INFO_HEADER, base64.StdEncoding.EncodeToString([]byte(userInfo)))
+	})
+
+	t.Run("Test user not active error", func(t *testing.T) {
+		service := mocks.AuthService{}
+		service.Returns("Login", domain.UserToken{}, domain.ErrUserNotActive)
+
+		handler := NewAuthRESTHandler(domain.NewConfigSnapshot(config), &service)
 		context := gin.Context{
 			Request: &http.Request{
 				Header: headers,
 			},
 		}
 
-		_, err := handler.Login(&context)
+		_, err := handler.Authenticate(&context)
 
-		if err == nil {
-			t.Errorf("Expected an error got nil")
+		if parsed := restError(t, err); parsed.Code != UserNotActive {
+			t.Errorf("Expected error code: %d got: %d", UserNotActive, parsed.Code)
 		}
 
-		parsed, ok := err.(*RestError)
+		if service.CallCount("Register") != 0 {
+			t.Error("Expected inactive users to not be registered")
+		}
+	})
 
-		if !ok {
-			t.Errorf("Expected error of type RestError got: %v", err)
+	t.Run("Test user already registered error", func(t *testing.T) {
+		service := mocks.AuthService{}
+		service.Returns("Login", domain.UserToken{}, fmt.Errorf("%w: user", domain.ErrNotFound))
+		service.Returns("Register", domain.UserToken{}, fmt.Errorf("%w: username", domain.ErrDuplicate))
+
+		handler := NewAuthRESTHandler(domain.NewConfigSnapshot(config), &service)
+		context := gin.Context{
+			Request: &http.Request{
+				Header: headers,
+			},
 		}
 
-		if parsed.Code != UserNotRegistered {
-			t.Errorf("Expected error code: %d got: %d", UserNotRegistered, parsed.Code)
+		_, err := handler.Authenticate(&context)
+
+		if parsed := restError(t, err); parsed.Code != UserAlreadyRegistered {
+			t.Errorf("Expected error code: %d got: %d", UserAlreadyRegistered, parsed.Code)
+		}
+
+		if service.CallCount("Login") != 1 || service.CallCount("Register") != 1 {
+			t.Errorf("Expected login and register to be called once got: %d %d", service.CallCount("Login"), service.CallCount("Register"))
 		}
 	})
 
-	t.Run("Test user already registered error", func(t *testing.T) {
-		repo := mocks.UserRepo{
-			CreateInterceptor: func(user domain.Register) (domain.User, error) {
-				return domain.User{}, errors.New("duplicated_value")
+	t.Run("Test user repo unavailable error", func(t *testing.T) {
+		service := mocks.AuthService{}
+		service.Returns("Login", domain.UserToken{}, fmt.Errorf("%w: connection refused", domain.ErrUnavailable))
+
+		handler := NewAuthRESTHandler(domain.NewConfigSnapshot(config), &service)
+		context := gin.Context{
+			Request: &http.Request{
+				Header: headers,
 			},
 		}
 
-		service := service.NewAuthService(&repo, config)
+		_, err := handler.Authenticate(&context)
 
-		handler := NewAuthRESTHandler(&config, service)
+		if parsed := restError(t, err); parsed.Code != UpstreamUnavailable || parsed.HTTPStatus != http.StatusServiceUnavailable {
+			t.Errorf("Expected error code: %d got: %d", UpstreamUnavailable, parsed.Code)
+		}
 
-		userInfo := `
-		{
-			"username": "IronMan",
-			"name": "Tony Stark",
-			"picture": "https://picture.com/tony",
-			"role": "hero",
-			"provder": "StarkIndustries",
-			"tokenID": "myTokenId"
+		if service.CallCount("Register") != 0 {
+			t.Error("Expected service.Register to not be called")
 		}
-		`
+	})
+
+	t.Run("Test invalid username error", func(t *testing.T) {
+		service := mocks.AuthService{}
+		service.Returns("Register", domain.UserToken{}, &domain.ValidationError{
+			Fields: []domain.FieldError{{Field: "username", Rule: "reserved", Message: "username is reserved"}},
+		})
+
+		handler := NewAuthRESTHandler(domain.NewConfigSnapshot(config), &service)
+		context := gin.Context{
+			Request: &http.Request{
+				Header: headers,
+			},
+		}
+
+		_, err := handler.Register(&context)
+		parsed := restError(t, err)
+
+		if parsed.Code != InvalidFields {
+			t.Errorf("Expected error code: %d got: %d", InvalidFields, parsed.Code)
+		}
+
+		if len(parsed.Details) != 1 || parsed.Details[0].Field != "username" || parsed.Details[0].Rule != "reserved" {
+			t.Errorf("Expected reserved username detail got: %+v", parsed.Details)
+		}
+	})
+
+	t.Run("Test invalid user info header", func(t *testing.T) {
+		service := mocks.AuthService{}
+		handler := NewAuthRESTHandler(domain.NewConfigSnapshot(config), &service)
 
 		headers := http.Header{}
-		headers.Add(USER_INFO_HEADER, base64.StdEncoding.EncodeToString([]byte(userInfo)))
+		headers.Add(USER_INFO_HEADER, base64.StdEncoding.EncodeToString([]byte("not json")))
 		context := gin.Context{
 			Request: &http.Request{
 				Header: headers,
@@ -482,72 +499,295 @@ func TestErrors(t *testing.T) {
 
 		_, err := handler.Register(&context)
 
-		if err == nil {
-			t.Errorf("Expected an error got nil")
+		if parsed := restError(t, err); parsed.Code != InavalidRequest {
+			t.Errorf("Expected error code: %d got: %d", InavalidRequest, parsed.Code)
 		}
 
-		parsed, ok := err.(*RestError)
+		_, err = handler.Login(&context)
 
-		if !ok {
-			t.Errorf("Expected error of type RestError got: %v", err)
+		if parsed := restError(t, err); parsed.Code != InavalidRequest {
+			t.Errorf("Expected error code: %d got: %d", InavalidRequest, parsed.Code)
 		}
 
-		if parsed.Code != UserAlreadyRegistered {
-			t.Errorf("Expected error code: %d got: %d", UserAlreadyRegistered, parsed.Code)
+		if service.CallCount("Register") != 0 || service.CallCount("Login") != 0 {
+			t.Error("Expected the service to not be called")
 		}
 	})
 
-	t.Run("Test invalid user info header", func(t *testing.T) {
-		repo := mocks.UserRepo{
-			CreateInterceptor: func(user domain.Register) (domain.User, error) {
-				return domain.User{}, errors.New("duplicated_value")
+	t.Run("Test deleted user me error", func(t *testing.T) {
+		service := mocks.AuthService{}
+		service.Returns("Me", domain.User{}, fmt.Errorf("%w: user newid", domain.ErrNotFound))
+
+		handler := NewAuthRESTHandler(domain.NewConfigSnapshot(config), &service)
+
+		headers := http.Header{}
+		headers.Add(USER_ID_HEADER, "newid")
+		context := gin.Context{
+			Request: &http.Request{
+				Header: headers,
 			},
 		}
 
-		service := service.NewAuthService(&repo, config)
+		_, err := handler.Me(&context)
 
-		handler := NewAuthRESTHandler(&config, service)
+		if err != &UserNotRegisteredErr {
+			t.Errorf("Expected error: %v got: %v", UserNotRegisteredErr, err)
+		}
 
-		userInfo := "not json"
+		if call, _ := service.LastCall("Me"); call.Args[0] != "newid" {
+			t.Errorf("Expected service to receive id: %q got: %v", "newid", call.Args)
+		}
+	})
+
+	t.Run("Test refresh unexpected errors", func(t *testing.T) {
+		service := mocks.AuthService{}
+		service.Returns("Refresh", domain.UserToken{}, fmt.Errorf("%w: connection refused", domain.ErrUnavailable))
+		service.Returns("Refresh", domain.UserToken{}, errors.New("unexpected"))
+
+		handler := NewAuthRESTHandler(domain.NewConfigSnapshot(config), &service)
 
 		headers := http.Header{}
-		headers.Add(USER_INFO_HEADER, base64.StdEncoding.EncodeToString([]byte(userInfo)))
+		headers.Add("Authorization", "Bearer refresh")
 		context := gin.Context{
 			Request: &http.Request{
 				Header: headers,
 			},
 		}
 
-		_, err := handler.Register(&context)
+		for _, expected := range []*RestError{&UpstreamUnavailableErr, &InternalServerError} {
+			if _, err := handler.Refresh(&context); err != expected {
+				t.Errorf("Expected error: %v got: %v", expected, err)
+			}
+		}
 
-		if err == nil {
-			t.Errorf("Expected an error got nil")
+		if call, _ := service.LastCall("Refresh"); service.CallCount("Refresh") != 2 || call.Args[0] != "refresh" {
+			t.Errorf("Expected service to receive token: %q got: %v", "refresh", call.Args)
 		}
+	})
+}
 
-		parsed, ok := err.(*RestError)
+func TestAdminEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config := domain.DefaultConfig()
 
-		if !ok {
-			t.Errorf("Expected error of type RestError got: %v", err)
+	service := mocks.AuthService{
+		SuspendInterceptor: func(userId string) (domain.User, error) {
+			return domain.User{Id: userId, Status: domain.UserSuspended}, nil
+		},
+	}
+
+	handler := NewAuthRESTHandler(domain.NewConfigSnapshot(config), &service)
+	router := gin.New()
+	handler.CreateRoutes(router)
+
+	t.Run("Test forbidden", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/auth/admin/users/newid/suspend", nil)
+		req.Header.Add(USER_ROLE_HEADER, "hero")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusForbidden {
+			t.Errorf("Expected status: %d got: %d", http.StatusForbidden, recorder.Code)
 		}
 
-		if parsed.Code != InavalidRequest {
-			t.Errorf("Expected error code: %d got: %d", InavalidRequest, parsed.Code)
+		if service.CallCount("Suspend") != 0 {
+			t.Error("Expected service.Suspend to not be called")
 		}
+	})
 
-		_, err = handler.Login(&context)
+	t.Run("Test suspend", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/auth/admin/users/newid/suspend", nil)
+		req.Header.Add(USER_ROLE_HEADER, "admin")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusOK {
+			t.Errorf("Expected status: %d got: %d", http.StatusOK, recorder.Code)
+		}
+
+		if call, _ := service.LastCall("Suspend"); service.CallCount("Suspend") != 1 || call.Args[0] != "newid" {
+			t.Errorf("Expected user \"newid\" to be suspended got: %v", call.Args)
+		}
+	})
+}
+
+func TestAdminUserManagement(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config := domain.DefaultConfig()
+
+	service := mocks.AuthService{
+		ListUsersInterceptor: func(filter domain.UserFilter) (domain.UserPage, error) {
+			return domain.UserPage{
+				Items:    []domain.User{{Id: "newid", Username: "IronMan"}},
+				Page:     filter.Page,
+				PageSize: filter.PageSize,
+				Total:    1,
+			}, nil
+		},
+		UpdateUserInterceptor: func(userId string, update domain.UserUpdate) (domain.User, error) {
+			return domain.User{Id: userId, Name: *update.Name}, nil
+		},
+		GetUserByUsernameInterceptor: func(username string) (domain.User, error) {
+			return domain.User{}, fmt.Errorf("%w: user", domain.ErrNotFound)
+		},
+	}
+
+	handler := NewAuthRESTHandler(domain.NewConfigSnapshot(config), &service)
+	router := gin.New()
+	handler.CreateRoutes(router)
+
+	send := func(method string, path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Add(USER_ROLE_HEADER, "admin")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	t.Run("Test list", func(t *testing.T) {
+		recorder := send(http.MethodGet, "/auth/admin/users?provider=StarkIndustries&status=suspended&role=hero&page=2", "")
 
-		if err == nil {
-			t.Errorf("Expected an error got nil")
+		if recorder.Code != http.StatusOK {
+			t.Errorf("Expected status: %d got: %d", http.StatusOK, recorder.Code)
 		}
 
-		parsed, ok = err.(*RestError)
+		// The default page size is applied by the service
+		expected := domain.UserFilter{
+			Provider: "StarkIndustries",
+			Status:   domain.UserSuspended,
+			Role:     "hero",
+			Page:     2,
+		}
+
+		if call, _ := service.LastCall("ListUsers"); service.CallCount("ListUsers") != 1 || call.Args[0] != expected {
+			t.Errorf("Expected filter: %+v got: %+v", expected, call.Args)
+		}
+	})
+
+	t.Run("Test list invalid status", func(t *testing.T) {
+		recorder := send(http.MethodGet, "/auth/admin/users?status=unknown", "")
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected status: %d got: %d", http.StatusBadRequest, recorder.Code)
+		}
+
+		if service.CallCount("ListUsers") != 1 {
+			t.Error("Expected service.ListUsers to not be called with an invalid status")
+		}
+	})
+
+	t.Run("Test update", func(t *testing.T) {
+		recorder := send(http.MethodPatch, "/auth/admin/users/newid", `{"name": "Anthony Stark"}`)
+
+		if recorder.Code != http.StatusOK {
+			t.Errorf("Expected status: %d got: %d", http.StatusOK, recorder.Code)
+		}
+
+		call, ok := service.LastCall("UpdateUser")
+		if !ok || call.Args[0] != "newid" {
+			t.Fatalf("Expected user \"newid\" to be updated got: %v", call.Args)
+		}
+
+		update := call.Args[1].(domain.UserUpdate)
+		if update.Name == nil || *update.Name != "Anthony Stark" || update.Role != nil || update.Picture != nil {
+			t.Errorf("Expected only the name to be updated got: %+v", update)
+		}
+	})
+
+	t.Run("Test update invalid picture", func(t *testing.T) {
+		recorder := send(http.MethodPatch, "/auth/admin/users/newid", `{"picture": "not a url"}`)
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected status: %d got: %d", http.StatusBadRequest, recorder.Code)
+		}
+
+		if service.CallCount("UpdateUser") != 1 {
+			t.Error("Expected service.UpdateUser to not be called with an invalid picture")
+		}
+	})
+
+	t.Run("Test get unknown username", func(t *testing.T) {
+		recorder := send(http.MethodGet, "/auth/admin/usernames/Hulk", "")
+
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("Expected status: %d got: %d", http.StatusNotFound, recorder.Code)
+		}
+
+		if call, _ := service.LastCall("GetUserByUsername"); call.Args[0] != "Hulk" {
+			t.Errorf("Expected service to receive username: %q got: %v", "Hulk", call.Args)
+		}
+	})
+}
+
+func TestUpdateMeEndpoint(t *testing.T) {
+	config := domain.DefaultConfig()
+
+	t.Run("Test update", func(t *testing.T) {
+		service := mocks.AuthService{}
+		service.Returns("UpdateMe", domain.UserToken{
+			AccessToken: "access",
+			Info:        domain.User{Id: "newid", Username: "IronMan", Name: "Anthony Stark"},
+		}, nil)
+
+		handler := NewAuthRESTHandler(domain.NewConfigSnapshot(config), &service)
+
+		headers := http.Header{}
+		headers.Add(USER_ID_HEADER, "newid")
+		context := gin.Context{
+			Request: &http.Request{
+				Header: headers,
+				Body:   io.NopCloser(strings.NewReader(`{"name": "Anthony Stark"}`)),
+			},
+		}
+
+		token, err := handler.UpdateMe(&context)
+
+		if err != nil {
+			t.Errorf("Expected to update profile without error, got: %v", err)
+		}
+
+		if token.Info.Name != "Anthony Stark" || token.AccessToken != "access" {
+			t.Errorf("Expected a new token for the updated user got: %+v", token)
+		}
+
+		call, ok := service.LastCall("UpdateMe")
+		if !ok || call.Args[0] != "newid" {
+			t.Fatalf("Expected user \"newid\" to be updated got: %v", call.Args)
+		}
+
+		update := call.Args[1].(domain.UserUpdate)
+		if update.Name == nil || *update.Name != "Anthony Stark" || update.Role != nil || update.Picture != nil {
+			t.Errorf("Expected only the name to be updated got: %+v", update)
+		}
+	})
+
+	t.Run("Test role change", func(t *testing.T) {
+		service := mocks.AuthService{}
+		handler := NewAuthRESTHandler(domain.NewConfigSnapshot(config), &service)
+
+		headers := http.Header{}
+		headers.Add(USER_ID_HEADER, "newid")
+		context := gin.Context{
+			Request: &http.Request{
+				Header: headers,
+				Body:   io.NopCloser(strings.NewReader(`{"role": "admin"}`)),
+			},
+		}
+
+		_, err := handler.UpdateMe(&context)
+
+		parsed, ok := err.(*RestError)
 
 		if !ok {
-			t.Errorf("Expected error of type RestError got: %v", err)
+			t.Fatalf("Expected error of type RestError got: %v", err)
 		}
 
 		if parsed.Code != InavalidRequest {
 			t.Errorf("Expected error code: %d got: %d", InavalidRequest, parsed.Code)
 		}
+
+		if service.CallCount("UpdateMe") != 0 {
+			t.Error("Expected service.UpdateMe to not be called")
+		}
 	})
 }
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"text/template"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"golang.org/x/text/language"
+)
+
+const DEFAULT_LOCALE = "en"
+
+// builtinErrors are the errors known by the handlers, the built-in messages are in english
+var builtinErrors = []*RestError{
+	&InavalidBodyErr,
+	&InavalidTokenErr,
+	&UserNotRegisteredErr,
+	&UserAlreadyRegisteredErr,
+	&InternalServerError,
+	&InvalidRequestError,
+	&InvalidCredentialErr,
+	&UserNotActiveErr,
+	&ForbiddenErr,
+	&UsernameTakenErr,
+	&InvalidFieldsErr,
+	&UpstreamUnavailableErr,
+	&UpstreamTimeoutErr,
+}
+
+type catalogEntry struct {
+	code       ErrorCode
+	httpStatus int
+	messages   map[string]*template.Template
+}
+
+// catalogSnapshot keeps the error catalog of the current configuration,
+// it's rebuilt when a reload changes the errors configuration
+type catalogSnapshot struct {
+	config *domain.ConfigSnapshot
+	// *cachedCatalog
+	value atomic.Value
+}
+
+type cachedCatalog struct {
+	config  *domain.Config
+	catalog *ErrorCatalog
+}
+
+func newCatalogSnapshot(config *domain.ConfigSnapshot) *catalogSnapshot {
+	snapshot := &catalogSnapshot{config: config}
+	snapshot.Get()
+	return snapshot
+}
+
+// Get returns the catalog for the current configuration
+func (snapshot *catalogSnapshot) Get() *ErrorCatalog {
+	config := snapshot.config.Get()
+	cached, _ := snapshot.value.Load().(*cachedCatalog)
+	if cached != nil && cached.config == config {
+		return cached.catalog
+	}
+
+	catalog := NewErrorCatalog(config.Errors)
+	if cached != nil && reflect.DeepEqual(cached.config.Errors, config.Errors) {
+		catalog = cached.catalog
+	}
+
+	snapshot.value.Store(&cachedCatalog{config: config, catalog: catalog})
+	return catalog
+}
+
+// ErrorCatalog holds the error codes, statuses and translated messages
+// returned to the clients, anything missing falls back to the built-in errors
+type ErrorCatalog struct {
+	config  domain.ErrorsConfig
+	locale  string
+	entries map[string]catalogEntry
+	matcher language.Matcher
+	locales []string
+}
+
+// NewErrorCatalog compiles the message templates, invalid entries are logged and ignored
+func NewErrorCatalog(config domain.ErrorsConfig) *ErrorCatalog {
+	catalog := &ErrorCatalog{
+		config:  config,
+		locale:  config.DefaultLocale,
+		entries: map[string]catalogEntry{},
+	}
+
+	if catalog.locale == "" {
+		catalog.locale = DEFAULT_LOCALE
+	}
+
+	known := map[string]bool{}
+	for _, rest := range builtinErrors {
+		known[rest.Type] = true
+	}
+
+	locales := map[string]bool{catalog.locale: true}
+	for name, definition := range config.Catalog {
+		if !known[name] {
+			log.Warn().Str("error", name).Msg("Unknown error in catalog")
+			continue
+		}
+
+		entry := catalogEntry{
+			code:       ErrorCode(definition.Code),
+			httpStatus: definition.HTTPStatus,
+			messages:   map[string]*template.Template{},
+		}
+
+		for locale, message := range definition.Messages {
+			tmpl, err := template.New(name + "." + locale).Parse(message)
+			if err != nil {
+				log.Warn().Err(err).Str("error", name).Str("locale", locale).Msg("Invalid error message template")
+				continue
+			}
+
+			entry.messages[locale] = tmpl
+			locales[locale] = true
+		}
+
+		catalog.entries[name] = entry
+	}
+
+	// The default locale goes first so it wins when nothing matches
+	catalog.locales = append(catalog.locales, catalog.locale)
+	tags := []language.Tag{language.Make(catalog.locale)}
+	for locale := range locales {
+		if locale == catalog.locale {
+			continue
+		}
+
+		catalog.locales = append(catalog.locales, locale)
+		tags = append(tags, language.Make(locale))
+	}
+
+	catalog.matcher = language.NewMatcher(tags)
+	return catalog
+}
+
+// Locale returns the catalog locale that best matches an Accept-Language header
+func (catalog *ErrorCatalog) Locale(acceptLanguage string) string {
+	accepted, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(accepted) == 0 {
+		return catalog.locale
+	}
+
+	_, index, confidence := catalog.matcher.Match(accepted...)
+	if confidence == language.No {
+		return catalog.locale
+	}
+
+	return catalog.locales[index]
+}
+
+// Localize returns a copy of the error with the configured code, status and
+// the message in the given locale
+func (catalog *ErrorCatalog) Localize(rest *RestError, locale string) *RestError {
+	localized := *rest
+	entry, ok := catalog.entries[rest.Type]
+	if !ok {
+		return &localized
+	}
+
+	if entry.code != 0 {
+		localized.Code = entry.code
+	}
+
+	if entry.httpStatus != 0 {
+		localized.HTTPStatus = entry.httpStatus
+	}
+
+	tmpl, ok := entry.messages[locale]
+	if !ok {
+		tmpl, ok = entry.messages[catalog.locale]
+	}
+
+	if ok {
+		var message strings.Builder
+		err := tmpl.Execute(&message, localized)
+		if err == nil {
+			localized.Message = message.String()
+		} else {
+			log.Warn().Err(err).Str("error", rest.Type).Msg("Can't render error message")
+		}
+	}
+
+	return &localized
+}
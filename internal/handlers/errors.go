@@ -1,10 +1,23 @@
 package handlers
 
-import "net/http"
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
 
 type ErrorCode int32
 
-// TODO: Error codes could came from configuration server
+const PROBLEM_CONTENT_TYPE = "application/problem+json"
+
+// Context key of the ErrorCode answered to the request
+const ERROR_CODE_KEY = "errorCode"
+
+// Built-in error codes, they can be changed with the error catalog in the configuration
 const (
 	InavalidBody          ErrorCode = 54000
 	InvalidToken                    = 54001
@@ -12,52 +25,212 @@ const (
 	UserAlreadyRegistered           = 54003
 	InternalError                   = 54004
 	InavalidRequest                 = 54005
+	InvalidCredential               = 54006
+	UserNotActive                   = 54007
+	Forbidden                       = 54008
+	UsernameTaken                   = 54009
+	InvalidFields                   = 54010
+	UpstreamUnavailable             = 54011
+	UpstreamTimeout                 = 54012
 )
 
 var (
 	InavalidBodyErr RestError = RestError{
 		Code:       InavalidBody,
+		Type:       "invalid-body",
 		Message:    "request body should a valid JSON",
 		HTTPStatus: http.StatusBadRequest,
 	}
 
 	InavalidTokenErr RestError = RestError{
 		Code:       InvalidToken,
+		Type:       "invalid-token",
 		Message:    "invalid token",
 		HTTPStatus: http.StatusBadRequest,
 	}
 
 	UserNotRegisteredErr RestError = RestError{
 		Code:       UserNotRegistered,
+		Type:       "user-not-registered",
 		Message:    "user is not registered",
 		HTTPStatus: http.StatusNotFound,
 	}
 
 	UserAlreadyRegisteredErr RestError = RestError{
 		Code:       UserAlreadyRegistered,
+		Type:       "user-already-registered",
 		Message:    "user is already registered",
 		HTTPStatus: http.StatusBadRequest,
 	}
 
 	InternalServerError RestError = RestError{
 		Code:       InternalError,
+		Type:       "internal-error",
 		Message:    "internal server error",
 		HTTPStatus: http.StatusInternalServerError,
 	}
 
 	InvalidRequestError RestError = RestError{
 		Code:       InavalidRequest,
-		Message:    "ivalid request",
+		Type:       "invalid-request",
+		Message:    "invalid request",
 		HTTPStatus: http.StatusBadRequest,
 	}
+
+	InvalidCredentialErr RestError = RestError{
+		Code:       InvalidCredential,
+		Type:       "invalid-credential",
+		Message:    "invalid credential",
+		HTTPStatus: http.StatusUnauthorized,
+	}
+
+	UserNotActiveErr RestError = RestError{
+		Code:       UserNotActive,
+		Type:       "user-not-active",
+		Message:    "user is not active",
+		HTTPStatus: http.StatusForbidden,
+	}
+
+	ForbiddenErr RestError = RestError{
+		Code:       Forbidden,
+		Type:       "forbidden",
+		Message:    "not allowed to perform this action",
+		HTTPStatus: http.StatusForbidden,
+	}
+
+	UsernameTakenErr RestError = RestError{
+		Code:       UsernameTaken,
+		Type:       "username-taken",
+		Message:    "username is already taken",
+		HTTPStatus: http.StatusConflict,
+	}
+
+	InvalidFieldsErr RestError = RestError{
+		Code:       InvalidFields,
+		Type:       "invalid-fields",
+		Message:    "request has invalid fields",
+		HTTPStatus: http.StatusBadRequest,
+	}
+
+	UpstreamUnavailableErr RestError = RestError{
+		Code:       UpstreamUnavailable,
+		Type:       "upstream-unavailable",
+		Message:    "service temporarily unavailable",
+		HTTPStatus: http.StatusServiceUnavailable,
+	}
+
+	UpstreamTimeoutErr RestError = RestError{
+		Code:       UpstreamTimeout,
+		Type:       "upstream-timeout",
+		Message:    "service took too long to answer",
+		HTTPStatus: http.StatusGatewayTimeout,
+	}
 )
 
 type RestError struct {
-	Code       ErrorCode `json:"code"`
-	Message    string    `json:"message"`
-	HTTPStatus int       `json:"-"`
+	Code ErrorCode `json:"code"`
+	// Short name of the error, used to build the problem type URI
+	Type       string `json:"-"`
+	Message    string `json:"message"`
+	HTTPStatus int    `json:"-"`
+	// Field level errors, only for validation errors
+	Details []domain.FieldError `json:"details,omitempty"`
 }
 
 func (e *RestError) Error() string {
 	return e.Message
 }
+
+// withDetails returns a copy of a RestError with the field level errors
+func withDetails(e RestError, details []domain.FieldError) *RestError {
+	e.Details = details
+	return &e
+}
+
+// unexpectedError maps storage outages to their own errors,
+// any other error is considered an unknown or unexpected error
+// and the user should only get internal server error
+func unexpectedError(err error) *RestError {
+	switch {
+	case errors.Is(err, domain.ErrUnavailable):
+		return &UpstreamUnavailableErr
+	case errors.Is(err, domain.ErrTimeout):
+		return &UpstreamTimeoutErr
+	}
+
+	return &InternalServerError
+}
+
+// Problem is an RFC 7807 error response
+type Problem struct {
+	Type     string    `json:"type"`
+	Title    string    `json:"title"`
+	Status   int       `json:"status"`
+	Detail   string    `json:"detail,omitempty"`
+	Instance string    `json:"instance,omitempty"`
+	Code     ErrorCode `json:"code"`
+	// Value of the X-REQUEST-ID header, so clients can report it
+	RequestId string `json:"requestId,omitempty"`
+	// Field level errors, only for validation errors
+	Errors []domain.FieldError `json:"errors,omitempty"`
+}
+
+// newProblem builds the problem document of a RestError for the current request
+func newProblem(rest *RestError, c *gin.Context, config domain.ErrorsConfig) Problem {
+	problem := Problem{
+		Type:      "about:blank",
+		Title:     rest.Message,
+		Status:    rest.HTTPStatus,
+		Code:      rest.Code,
+		RequestId: c.Request.Header.Get(REQUEST_ID_HEADER),
+		Errors:    rest.Details,
+	}
+
+	if rest.Type != "" && config.TypeBaseURL != "" {
+		problem.Type = config.TypeBaseURL + rest.Type
+	}
+
+	if c.Request.URL != nil {
+		problem.Instance = c.Request.URL.Path
+	}
+
+	if len(rest.Details) > 0 {
+		messages := make([]string, 0, len(rest.Details))
+		for _, field := range rest.Details {
+			messages = append(messages, field.Message)
+		}
+
+		problem.Detail = strings.Join(messages, "; ")
+	}
+
+	return problem
+}
+
+// handleError writes the error response in the client language,
+// internal errors are never exposed to the client
+func handleError(err error, c *gin.Context, catalog *ErrorCatalog) {
+	log.Error().Stack().Err(err).Msg("Request error")
+	rest, ok := err.(*RestError)
+	if !ok {
+		rest = unexpectedError(err)
+	}
+
+	// Decided before the catalog can change the code
+	internal := rest.Code == InternalError
+	rest = catalog.Localize(rest, catalog.Locale(c.Request.Header.Get("Accept-Language")))
+	// Read by the decorators after the request I.E.: metrics
+	c.Set(ERROR_CODE_KEY, rest.Code)
+
+	if catalog.config.Legacy {
+		if internal {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			return
+		}
+
+		c.JSON(rest.HTTPStatus, gin.H{"error": rest})
+		return
+	}
+
+	c.Header("Content-Type", PROBLEM_CONTENT_TYPE)
+	c.JSON(rest.HTTPStatus, newProblem(rest, c, catalog.config))
+}
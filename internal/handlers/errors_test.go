@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-cmp/cmp"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+func serveError(config *domain.Config, err error, acceptLanguage string) *httptest.ResponseRecorder {
+	catalog := NewErrorCatalog(config.Errors)
+	router := gin.New()
+	router.GET("/auth/fail", func(c *gin.Context) {
+		handleError(err, c, catalog)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/fail", nil)
+	req.Header.Add(REQUEST_ID_HEADER, "request-1")
+	req.Header.Add("Accept-Language", acceptLanguage)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestProblemResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config := domain.DefaultConfig()
+
+	t.Run("Test validation problem", func(t *testing.T) {
+		fields := []domain.FieldError{
+			{Field: "username", Rule: "min_length", Message: "username should have at least 3 characters"},
+			{Field: "username", Rule: "reserved", Message: "username is reserved"},
+		}
+
+		recorder := serveError(&config, withDetails(InvalidFieldsErr, fields), "")
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected status: %d got: %d", http.StatusBadRequest, recorder.Code)
+		}
+
+		if contentType := recorder.Header().Get("Content-Type"); contentType != PROBLEM_CONTENT_TYPE {
+			t.Errorf("Expected content type: %q got: %q", PROBLEM_CONTENT_TYPE, contentType)
+		}
+
+		var got Problem
+		if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Expected a problem document got: %v", err)
+		}
+
+		expected := Problem{
+			Type:      "urn:minerva:spear:error:invalid-fields",
+			Title:     InvalidFieldsErr.Message,
+			Status:    http.StatusBadRequest,
+			Detail:    "username should have at least 3 characters; username is reserved",
+			Instance:  "/auth/fail",
+			Code:      InvalidFields,
+			RequestId: "request-1",
+			Errors:    fields,
+		}
+
+		if diff := cmp.Diff(expected, got); diff != "" {
+			t.Errorf("Problem mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("Test unexpected errors are not exposed", func(t *testing.T) {
+		recorder := serveError(&config, errors.New("database password is wrong"), "")
+
+		if recorder.Code != http.StatusInternalServerError {
+			t.Errorf("Expected status: %d got: %d", http.StatusInternalServerError, recorder.Code)
+		}
+
+		if strings.Contains(recorder.Body.String(), "password") {
+			t.Errorf("Expected internal error to be hidden got: %s", recorder.Body.String())
+		}
+
+		var got Problem
+		if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Expected a problem document got: %v", err)
+		}
+
+		if got.Code != InternalError || got.Status != http.StatusInternalServerError {
+			t.Errorf("Expected internal error problem got: %+v", got)
+		}
+	})
+
+	t.Run("Test outages use their own problem type", func(t *testing.T) {
+		recorder := serveError(&config, domain.ErrTimeout, "")
+
+		if recorder.Code != http.StatusGatewayTimeout {
+			t.Errorf("Expected status: %d got: %d", http.StatusGatewayTimeout, recorder.Code)
+		}
+
+		if !strings.Contains(recorder.Body.String(), "urn:minerva:spear:error:upstream-timeout") {
+			t.Errorf("Expected upstream timeout problem type got: %s", recorder.Body.String())
+		}
+	})
+}
+
+func TestLegacyErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config := domain.DefaultConfig()
+	config.Errors.Legacy = true
+
+	t.Run("Test known error", func(t *testing.T) {
+		recorder := serveError(&config, &UserNotRegisteredErr, "")
+
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("Expected status: %d got: %d", http.StatusNotFound, recorder.Code)
+		}
+
+		expected := `{"error":{"code":54002,"message":"user is not registered"}}`
+		if recorder.Body.String() != expected {
+			t.Errorf("Expected body: %s got: %s", expected, recorder.Body.String())
+		}
+	})
+
+	t.Run("Test unexpected error", func(t *testing.T) {
+		recorder := serveError(&config, errors.New("boom"), "")
+
+		expected := `{"error":"internal server error"}`
+		if recorder.Body.String() != expected {
+			t.Errorf("Expected body: %s got: %s", expected, recorder.Body.String())
+		}
+
+		if contentType := recorder.Header().Get("Content-Type"); strings.HasPrefix(contentType, PROBLEM_CONTENT_TYPE) {
+			t.Errorf("Expected legacy content type got: %q", contentType)
+		}
+	})
+
+	t.Run("Test internal error", func(t *testing.T) {
+		recorder := serveError(&config, &InternalServerError, "")
+
+		expected := `{"error":"internal server error"}`
+		if recorder.Code != http.StatusInternalServerError || recorder.Body.String() != expected {
+			t.Errorf("Expected status: %d body: %s got: %d %s", http.StatusInternalServerError, expected, recorder.Code, recorder.Body.String())
+		}
+	})
+}
+
+func TestErrorCatalog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config := domain.DefaultConfig()
+	config.Errors.Catalog = map[string]domain.ErrorDefinition{
+		"user-not-registered": {
+			HTTPStatus: http.StatusUnauthorized,
+			Messages: map[string]string{
+				"en": "unknown user",
+				"es": "el usuario no está registrado",
+			},
+		},
+		"forbidden": {
+			Code: 60008,
+			Messages: map[string]string{
+				"es": "error {{.Code}}: acción no permitida",
+			},
+		},
+		"invalid-token": {
+			Messages: map[string]string{
+				"es": "{{.Broken",
+			},
+		},
+	}
+
+	problem := func(t *testing.T, err error, acceptLanguage string) (int, Problem) {
+		recorder := serveError(&config, err, acceptLanguage)
+
+		var got Problem
+		if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+			t.Fatalf("Expected a problem document got: %v", err)
+		}
+
+		return recorder.Code, got
+	}
+
+	t.Run("Test locale from Accept-Language", func(t *testing.T) {
+		status, got := problem(t, &UserNotRegisteredErr, "fr-CA, es-MX;q=0.8, en;q=0.5")
+
+		if status != http.StatusUnauthorized || got.Status != http.StatusUnauthorized {
+			t.Errorf("Expected configured status: %d got: %d %d", http.StatusUnauthorized, status, got.Status)
+		}
+
+		if got.Title != "el usuario no está registrado" {
+			t.Errorf("Expected spanish message got: %q", got.Title)
+		}
+	})
+
+	t.Run("Test default locale", func(t *testing.T) {
+		_, got := problem(t, &UserNotRegisteredErr, "de")
+
+		if got.Title != "unknown user" {
+			t.Errorf("Expected default locale message got: %q", got.Title)
+		}
+	})
+
+	t.Run("Test template and code", func(t *testing.T) {
+		status, got := problem(t, &ForbiddenErr, "es")
+
+		if status != http.StatusForbidden || got.Code != 60008 {
+			t.Errorf("Expected built-in status and configured code got: %d %d", status, got.Code)
+		}
+
+		if got.Title != "error 60008: acción no permitida" {
+			t.Errorf("Expected rendered template got: %q", got.Title)
+		}
+	})
+
+	t.Run("Test built-in fallback", func(t *testing.T) {
+		_, got := problem(t, &InavalidTokenErr, "es")
+
+		if got.Title != InavalidTokenErr.Message || got.Code != InvalidToken {
+			t.Errorf("Expected built-in error got: %+v", got)
+		}
+
+		_, got = problem(t, &ForbiddenErr, "en")
+
+		if got.Title != ForbiddenErr.Message {
+			t.Errorf("Expected built-in message got: %q", got.Title)
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"github.com/sy-software/minerva-spear-users/internal/core/ports"
+)
+
+const (
+	HEALTH_ALIVE     = "alive"
+	HEALTH_READY     = "ready"
+	HEALTH_NOT_READY = "not_ready"
+	HEALTH_DRAINING  = "draining"
+
+	HEALTH_CHECK_OK     = "ok"
+	HEALTH_CHECK_FAILED = "failed"
+
+	// Maximum time a readiness check can take before it fails
+	HEALTH_CHECK_TIMEOUT = 2 * time.Second
+)
+
+// HealthCheck is a dependency checked by the readiness probe
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// HealthCheckResult is the outcome of a HealthCheck
+type HealthCheckResult struct {
+	Status string `json:"status"`
+	// Time the check took in milliseconds
+	Latency float64 `json:"latency"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// ConfigHealthCheck fails when no valid configuration is loaded
+func ConfigHealthCheck(snapshot *domain.ConfigSnapshot) HealthCheck {
+	return HealthCheck{
+		Name: "config",
+		Check: func(ctx context.Context) error {
+			if !snapshot.Loaded() {
+				return errors.New("configuration not loaded")
+			}
+
+			return snapshot.Get().Validate()
+		},
+	}
+}
+
+// SigningKeysHealthCheck fails when the token signing keys can't be parsed
+func SigningKeysHealthCheck(snapshot *domain.ConfigSnapshot) HealthCheck {
+	return HealthCheck{
+		Name: "signingKeys",
+		Check: func(ctx context.Context) error {
+			if !snapshot.Loaded() {
+				return errors.New("configuration not loaded")
+			}
+
+			// A copy, the shared configuration must not be modified
+			token := snapshot.Get().Token
+			_, err := token.KeyPair()
+			return err
+		},
+	}
+}
+
+// UserRepoHealthCheck fails when the user storage can't be reached,
+// it always succeeds when the storage can't be checked
+func UserRepoHealthCheck(repo ports.UserRepo) HealthCheck {
+	return HealthCheck{
+		Name: "userRepo",
+		Check: func(ctx context.Context) error {
+			if pinger, ok := repo.(ports.Pinger); ok {
+				return pinger.Ping(ctx)
+			}
+
+			return nil
+		},
+	}
+}
+
+// HealthRESTHandler serves the probes of load balancers and orchestrators,
+// the routes are outside the API prefix
+type HealthRESTHandler struct {
+	checks   []HealthCheck
+	draining int32
+}
+
+// NewHealthRESTHandler creates an instance of HealthRESTHandler, checks are run by the readiness probe
+func NewHealthRESTHandler(checks ...HealthCheck) *HealthRESTHandler {
+	return &HealthRESTHandler{checks: checks}
+}
+
+// Drain makes the readiness probe fail so no new requests are sent to this instance
+func (handler *HealthRESTHandler) Drain() {
+	atomic.StoreInt32(&handler.draining, 1)
+}
+
+// Draining reports if the instance is shutting down
+func (handler *HealthRESTHandler) Draining() bool {
+	return atomic.LoadInt32(&handler.draining) == 1
+}
+
+func (handler *HealthRESTHandler) CreateRoutes(router *gin.Engine) {
+	// Liveness only tells the process is serving, dependencies are not checked
+	// so an outage doesn't restart every instance
+	router.GET("/healthz", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"data": gin.H{"status": HEALTH_ALIVE}})
+	})
+
+	router.GET("/readyz", func(c *gin.Context) {
+		if handler.Draining() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"data": gin.H{"status": HEALTH_DRAINING}})
+			return
+		}
+
+		results, ready := handler.Check(c.Request.Context())
+		if !ready {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"data": gin.H{"status": HEALTH_NOT_READY, "checks": results}})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": gin.H{"status": HEALTH_READY, "checks": results}})
+	})
+}
+
+// Check runs the readiness checks concurrently, each one with HEALTH_CHECK_TIMEOUT.
+// Returns the results by check name and if all of them passed
+func (handler *HealthRESTHandler) Check(ctx context.Context) (map[string]HealthCheckResult, bool) {
+	results := make([]HealthCheckResult, len(handler.checks))
+	var wait sync.WaitGroup
+
+	for i, check := range handler.checks {
+		wait.Add(1)
+		go func(i int, check HealthCheck) {
+			defer wait.Done()
+			results[i] = runHealthCheck(ctx, check)
+		}(i, check)
+	}
+
+	wait.Wait()
+
+	byName := make(map[string]HealthCheckResult, len(results))
+	ready := true
+	for i, result := range results {
+		byName[handler.checks[i].Name] = result
+		ready = ready && result.Status == HEALTH_CHECK_OK
+	}
+
+	return byName, ready
+}
+
+func runHealthCheck(ctx context.Context, check HealthCheck) HealthCheckResult {
+	ctx, cancel := context.WithTimeout(ctx, HEALTH_CHECK_TIMEOUT)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Check(ctx)
+	result := HealthCheckResult{
+		Status:  HEALTH_CHECK_OK,
+		Latency: float64(time.Since(start).Microseconds()) / 1000,
+	}
+
+	if err != nil {
+		result.Status = HEALTH_CHECK_FAILED
+		result.Error = err.Error()
+	}
+
+	return result
+}
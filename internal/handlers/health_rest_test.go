@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"github.com/sy-software/minerva-spear-users/mocks"
+)
+
+type readinessResponse struct {
+	Data struct {
+		Status string                       `json:"status"`
+		Checks map[string]HealthCheckResult `json:"checks"`
+	} `json:"data"`
+}
+
+// userRepoPinger is a user repository that can be pinged
+type userRepoPinger struct {
+	mocks.UserRepo
+	mocks.Pinger
+}
+
+func TestLivenessEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := NewHealthRESTHandler(HealthCheck{Name: "broken", Check: func(ctx context.Context) error {
+		return errors.New("broken")
+	}})
+	router := gin.New()
+	handler.CreateRoutes(router)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status: %d got: %d", http.StatusOK, recorder.Code)
+	}
+}
+
+func TestReadinessEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ready := func(handler *HealthRESTHandler) (int, readinessResponse) {
+		router := gin.New()
+		handler.CreateRoutes(router)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		var response readinessResponse
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		return recorder.Code, response
+	}
+
+	t.Run("Test draining", func(t *testing.T) {
+		handler := NewHealthRESTHandler()
+
+		if status, _ := ready(handler); status != http.StatusOK {
+			t.Errorf("Expected status: %d got: %d", http.StatusOK, status)
+		}
+
+		handler.Drain()
+
+		status, response := ready(handler)
+		if status != http.StatusServiceUnavailable || response.Data.Status != HEALTH_DRAINING {
+			t.Errorf("Expected status: %d %q got: %d %q", http.StatusServiceUnavailable, HEALTH_DRAINING, status, response.Data.Status)
+		}
+	})
+
+	t.Run("Test checks", func(t *testing.T) {
+		config := domain.DefaultConfig()
+		config.UserRepo.Driver = domain.UserRepoMemory
+		config.Token.PrivateKey = PRIVATE_KEY
+		config.Token.PublicKey = PUBLIC_KEY
+		snapshot := domain.NewConfigSnapshot(config)
+
+		pinger := &userRepoPinger{}
+		pinger.PingInterceptor = func() error { return nil }
+		handler := NewHealthRESTHandler(ConfigHealthCheck(snapshot), SigningKeysHealthCheck(snapshot), UserRepoHealthCheck(pinger))
+
+		status, response := ready(handler)
+		if status != http.StatusOK || response.Data.Status != HEALTH_READY {
+			t.Errorf("Expected status: %d %q got: %d %+v", http.StatusOK, HEALTH_READY, status, response.Data)
+		}
+
+		if calls := pinger.Pinger.CallCount("Ping"); calls != 1 {
+			t.Errorf("Expected the user repository to be pinged got: %d calls", calls)
+		}
+
+		for _, name := range []string{"config", "signingKeys", "userRepo"} {
+			if result := response.Data.Checks[name]; result.Status != HEALTH_CHECK_OK || result.Latency < 0 {
+				t.Errorf("Expected check %s to pass got: %+v", name, result)
+			}
+		}
+	})
+
+	t.Run("Test failed check", func(t *testing.T) {
+		config := domain.DefaultConfig()
+		config.Token.PrivateKey = "invalid"
+		snapshot := domain.NewConfigSnapshot(config)
+
+		userRepo := HealthCheck{Name: "userRepo", Check: func(ctx context.Context) error {
+			if _, ok := ctx.Deadline(); !ok {
+				t.Error("Expected the check to have a deadline")
+			}
+
+			return errors.New("connection refused")
+		}}
+
+		handler := NewHealthRESTHandler(SigningKeysHealthCheck(snapshot), userRepo)
+
+		status, response := ready(handler)
+		if status != http.StatusServiceUnavailable || response.Data.Status != HEALTH_NOT_READY {
+			t.Errorf("Expected status: %d %q got: %d %q", http.StatusServiceUnavailable, HEALTH_NOT_READY, status, response.Data.Status)
+		}
+
+		for _, name := range []string{"signingKeys", "userRepo"} {
+			if result := response.Data.Checks[name]; result.Status != HEALTH_CHECK_FAILED || result.Error == "" {
+				t.Errorf("Expected check %s to fail with an error got: %+v", name, result)
+			}
+		}
+	})
+}
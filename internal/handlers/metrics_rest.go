@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sy-software/minerva-spear-users/internal/metrics"
+)
+
+// Authentication flows counted by InstrumentedAuthRESTHandler by route, relative to the API prefix
+var authFlows = map[string]string{
+	"/login":        "login",
+	"/register":     "register",
+	"/refresh":      "refresh",
+	"/authenticate": "authenticate",
+}
+
+// Authentication flows counted by InstrumentedWebAuthnRESTHandler by route, relative to the API prefix
+var webAuthnFlows = map[string]string{
+	"/webauthn/login/finish": "webauthn_login",
+}
+
+// InstrumentedAuthRESTHandler measures the routes of an AuthRESTHandler
+// and counts the outcomes of the authentication flows
+type InstrumentedAuthRESTHandler struct {
+	*AuthRESTHandler
+	metrics *metrics.Metrics
+}
+
+// NewInstrumentedAuthRESTHandler creates an instance of InstrumentedAuthRESTHandler
+func NewInstrumentedAuthRESTHandler(handler *AuthRESTHandler, metrics *metrics.Metrics) *InstrumentedAuthRESTHandler {
+	return &InstrumentedAuthRESTHandler{
+		AuthRESTHandler: handler,
+		metrics:         metrics,
+	}
+}
+
+// CreateRoutes creates the routes of the AuthRESTHandler in a group measured by this handler
+func (instrumented *InstrumentedAuthRESTHandler) CreateRoutes(router gin.IRouter) {
+	flows := prefixFlows(instrumented.config.Get().APIPrefix, authFlows)
+	instrumented.AuthRESTHandler.CreateRoutes(router.Group("", measure(instrumented.metrics, flows)))
+}
+
+// InstrumentedWebAuthnRESTHandler measures the routes of a WebAuthnRESTHandler
+// and counts the outcomes of the passkey logins
+type InstrumentedWebAuthnRESTHandler struct {
+	*WebAuthnRESTHandler
+	metrics *metrics.Metrics
+}
+
+// NewInstrumentedWebAuthnRESTHandler creates an instance of InstrumentedWebAuthnRESTHandler
+func NewInstrumentedWebAuthnRESTHandler(handler *WebAuthnRESTHandler, metrics *metrics.Metrics) *InstrumentedWebAuthnRESTHandler {
+	return &InstrumentedWebAuthnRESTHandler{
+		WebAuthnRESTHandler: handler,
+		metrics:             metrics,
+	}
+}
+
+// CreateRoutes creates the routes of the WebAuthnRESTHandler in a group measured by this handler
+func (instrumented *InstrumentedWebAuthnRESTHandler) CreateRoutes(router gin.IRouter) {
+	flows := prefixFlows(instrumented.config.Get().APIPrefix, webAuthnFlows)
+	instrumented.WebAuthnRESTHandler.CreateRoutes(router.Group("", measure(instrumented.metrics, flows)))
+}
+
+// prefixFlows returns the flows by their full route
+func prefixFlows(prefix string, flows map[string]string) map[string]string {
+	prefixed := make(map[string]string, len(flows))
+	for route, flow := range flows {
+		prefixed[path.Join(prefix, route)] = flow
+	}
+
+	return prefixed
+}
+
+// measure observes the latency of every route and counts the outcome of the POST requests to the flows
+func measure(appMetrics *metrics.Metrics, flows map[string]string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		appMetrics.HandlerLatency.
+			WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+
+		flow, ok := flows[route]
+		if !ok || c.Request.Method != http.MethodPost {
+			return
+		}
+
+		code := ""
+		if value, ok := c.Get(ERROR_CODE_KEY); ok {
+			code = strconv.Itoa(int(value.(ErrorCode)))
+		}
+
+		appMetrics.ObserveAuth(flow, userInfoProvider(c), code)
+	}
+}
+
+// userInfoProvider returns the provider of the user info header, it's empty when the header is missing or invalid
+func userInfoProvider(c *gin.Context) string {
+	decoded, err := base64.StdEncoding.DecodeString(c.Request.Header.Get(USER_INFO_HEADER))
+	if err != nil {
+		return ""
+	}
+
+	var userInfo struct {
+		Provider string `json:"provider"`
+	}
+
+	json.Unmarshal(decoded, &userInfo)
+	return userInfo.Provider
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"github.com/sy-software/minerva-spear-users/internal/metrics"
+	"github.com/sy-software/minerva-spear-users/mocks"
+)
+
+func TestInstrumentedAuthEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config := domain.DefaultConfig()
+	snapshot := domain.NewConfigSnapshot(config)
+
+	service := mocks.AuthService{}
+	service.Returns("Login", domain.UserToken{Info: domain.User{Id: "newid", Provider: "StarkIndustries"}}, nil)
+	service.Returns("Login", domain.UserToken{}, domain.ErrUserNotActive)
+
+	appMetrics := metrics.New(snapshot)
+	handler := NewInstrumentedAuthRESTHandler(NewAuthRESTHandler(snapshot, &service), appMetrics)
+	router := gin.New()
+	handler.CreateRoutes(router)
+
+	login := func(userInfo string) int {
+		request := httptest.NewRequest(http.MethodPost, config.APIPrefix+"/login", nil)
+		request.Header.Set(USER_INFO_HEADER, base64.StdEncoding.EncodeToString([]byte(userInfo)))
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	login(`{"username": "IronMan", "provider": "StarkIndustries", "tokenID": "myTokenId"}`)
+	login(`{"username": "IronMan", "provider": "StarkIndustries", "tokenID": "myTokenId"}`)
+	login(`invalid`)
+
+	cases := []struct {
+		name     string
+		labels   []string
+		expected float64
+	}{
+		{name: "Test success", labels: []string{"login", "StarkIndustries", metrics.RESULT_SUCCESS, metrics.LABEL_NONE}, expected: 1},
+		{name: "Test error code", labels: []string{"login", "StarkIndustries", metrics.RESULT_ERROR, "54007"}, expected: 1},
+		{name: "Test missing provider", labels: []string{"login", metrics.LABEL_NONE, metrics.RESULT_ERROR, "54005"}, expected: 1},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			count := testutil.ToFloat64(appMetrics.AuthOutcomes.WithLabelValues(testCase.labels...))
+			if count != testCase.expected {
+				t.Errorf("Expected count: %v for %v got: %v", testCase.expected, testCase.labels, count)
+			}
+		})
+	}
+
+	t.Run("Test handler latency", func(t *testing.T) {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, config.APIPrefix+"/me", nil))
+
+		// One series per route and status
+		if series := testutil.CollectAndCount(appMetrics.HandlerLatency); series != 4 {
+			t.Errorf("Expected 4 latency series got: %d", series)
+		}
+	})
+}
+
+func TestInstrumentedWebAuthnEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config := domain.DefaultConfig()
+	snapshot := domain.NewConfigSnapshot(config)
+
+	service := mocks.WebAuthnService{}
+	service.Returns("FinishLogin", domain.UserToken{Info: domain.User{Id: "newid"}}, nil)
+	service.Returns("FinishLogin", domain.UserToken{}, domain.ErrInvalidCredential)
+	service.Returns("BeginLogin", domain.CredentialAssertion{}, nil)
+
+	appMetrics := metrics.New(snapshot)
+	handler := NewInstrumentedWebAuthnRESTHandler(NewWebAuthnRESTHandler(snapshot, &service), appMetrics)
+	router := gin.New()
+	handler.CreateRoutes(router)
+
+	post := func(route string) {
+		request := httptest.NewRequest(http.MethodPost, config.APIPrefix+route, strings.NewReader(`{"session": "session", "type": "public-key"}`))
+		router.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	post("/webauthn/login/finish")
+	post("/webauthn/login/finish")
+	post("/webauthn/login/begin")
+
+	success := testutil.ToFloat64(appMetrics.AuthOutcomes.WithLabelValues("webauthn_login", metrics.LABEL_NONE, metrics.RESULT_SUCCESS, metrics.LABEL_NONE))
+	if success != 1 {
+		t.Errorf("Expected a successful passkey login got: %v", success)
+	}
+
+	code := strconv.Itoa(int(InvalidCredential))
+	failed := testutil.ToFloat64(appMetrics.AuthOutcomes.WithLabelValues("webauthn_login", metrics.LABEL_NONE, metrics.RESULT_ERROR, code))
+	if failed != 1 {
+		t.Errorf("Expected a failed passkey login got: %v", failed)
+	}
+
+	// Only the finished logins are authentication outcomes
+	if series := testutil.CollectAndCount(appMetrics.AuthOutcomes); series != 2 {
+		t.Errorf("Expected 2 outcome series got: %d", series)
+	}
+}
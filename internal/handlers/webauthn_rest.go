@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"github.com/sy-software/minerva-spear-users/internal/core/ports"
+)
+
+type WebAuthnRESTHandler struct {
+	config  *domain.ConfigSnapshot
+	catalog *catalogSnapshot
+	service ports.WebAuthnService
+}
+
+func NewWebAuthnRESTHandler(config *domain.ConfigSnapshot, service ports.WebAuthnService) *WebAuthnRESTHandler {
+	return &WebAuthnRESTHandler{
+		config:  config,
+		catalog: newCatalogSnapshot(config),
+		service: service,
+	}
+}
+
+func (handler *WebAuthnRESTHandler) CreateRoutes(router gin.IRouter) {
+	group := router.Group(handler.config.Get().APIPrefix + "/webauthn")
+	{
+		group.POST("/register/begin", func(c *gin.Context) {
+			options, err := handler.BeginRegistration(c)
+
+			if err != nil {
+				handleError(err, c, handler.catalog.Get())
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"data": options})
+		})
+
+		group.POST("/register/finish", func(c *gin.Context) {
+			credential, err := handler.FinishRegistration(c)
+
+			if err != nil {
+				handleError(err, c, handler.catalog.Get())
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"data": credential})
+		})
+
+		group.POST("/login/begin", func(c *gin.Context) {
+			options, err := handler.BeginLogin(c)
+
+			if err != nil {
+				handleError(err, c, handler.catalog.Get())
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"data": options})
+		})
+
+		group.POST("/login/finish", func(c *gin.Context) {
+			token, err := handler.FinishLogin(c)
+
+			if err != nil {
+				handleError(err, c, handler.catalog.Get())
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"data": token})
+		})
+	}
+}
+
+// BeginRegistration starts a passkey registration for the current user
+func (handler *WebAuthnRESTHandler) BeginRegistration(c *gin.Context) (domain.CredentialCreation, error) {
+	userId := c.Request.Header.Get(USER_ID_HEADER)
+	if userId == "" {
+		return domain.CredentialCreation{}, fmt.Errorf("expected header %q to have exactly one value", USER_ID_HEADER)
+	}
+
+	options, err := handler.service.BeginRegistration(requestContext(c), userId)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Passkey registration error")
+		if errors.Is(err, domain.ErrNotFound) {
+			return domain.CredentialCreation{}, &UserNotRegisteredErr
+		}
+
+		if errors.Is(err, domain.ErrUserNotActive) {
+			return domain.CredentialCreation{}, &UserNotActiveErr
+		}
+
+		return domain.CredentialCreation{}, unexpectedError(err)
+	}
+
+	return options, nil
+}
+
+// FinishRegistration stores the passkey created by the user authenticator
+func (handler *WebAuthnRESTHandler) FinishRegistration(c *gin.Context) (domain.Credential, error) {
+	var credential domain.RegistrationCredential
+
+	userId := c.Request.Header.Get(USER_ID_HEADER)
+	if userId == "" {
+		return domain.Credential{}, fmt.Errorf("expected header %q to have exactly one value", USER_ID_HEADER)
+	}
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&credential); err != nil {
+		log.Error().Err(err).Msg("Registration credential can't be decoded from JSON")
+		return domain.Credential{}, &InavalidBodyErr
+	}
+
+	created, err := handler.service.FinishRegistration(requestContext(c), userId, credential)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Passkey registration error")
+		if errors.Is(err, domain.ErrInvalidCredential) {
+			return domain.Credential{}, &InvalidCredentialErr
+		}
+
+		return domain.Credential{}, unexpectedError(err)
+	}
+
+	return created, nil
+}
+
+// BeginLogin starts a passkey login, the username is optional
+func (handler *WebAuthnRESTHandler) BeginLogin(c *gin.Context) (domain.CredentialAssertion, error) {
+	var request struct {
+		Username string `json:"username,omitempty"`
+	}
+
+	// An empty body starts a login with discoverable credentials
+	if c.Request.Body != nil {
+		if err := json.NewDecoder(c.Request.Body).Decode(&request); err != nil && err != io.EOF {
+			log.Error().Err(err).Msg("Login request can't be decoded from JSON")
+			return domain.CredentialAssertion{}, &InavalidBodyErr
+		}
+	}
+
+	options, err := handler.service.BeginLogin(requestContext(c), request.Username)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Passkey login error")
+		if errors.Is(err, domain.ErrNotFound) {
+			return domain.CredentialAssertion{}, &UserNotRegisteredErr
+		}
+
+		return domain.CredentialAssertion{}, unexpectedError(err)
+	}
+
+	return options, nil
+}
+
+// FinishLogin validates the passkey assertion and returns a new token
+func (handler *WebAuthnRESTHandler) FinishLogin(c *gin.Context) (domain.UserToken, error) {
+	var credential domain.LoginCredential
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&credential); err != nil {
+		log.Error().Err(err).Msg("Login credential can't be decoded from JSON")
+		return domain.UserToken{}, &InavalidBodyErr
+	}
+
+	token, err := handler.service.FinishLogin(requestContext(c), credential)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Passkey login error")
+		if errors.Is(err, domain.ErrInvalidCredential) {
+			return domain.UserToken{}, &InvalidCredentialErr
+		}
+
+		if errors.Is(err, domain.ErrUserNotActive) {
+			return domain.UserToken{}, &UserNotActiveErr
+		}
+
+		return domain.UserToken{}, unexpectedError(err)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"github.com/sy-software/minerva-spear-users/internal/core/service"
+	"github.com/sy-software/minerva-spear-users/mocks"
+)
+
+func TestPasskeyBeginLoginEndpoint(t *testing.T) {
+	config := domain.DefaultConfig()
+	config.Token.PrivateKey = PRIVATE_KEY
+	config.Token.PublicKey = PUBLIC_KEY
+	config.WebAuthn.RPID = "minerva.test"
+
+	repo := mocks.UserRepo{
+		GetByUsernameInterceptor: func(username string) (domain.User, error) {
+			return domain.User{Id: "newid", Username: username}, nil
+		},
+	}
+
+	credentials := mocks.CredentialRepo{
+		GetByUserInterceptor: func(userId string) ([]domain.Credential, error) {
+			return []domain.Credential{{Id: "Y3JlZGVudGlhbA", UserId: userId}}, nil
+		},
+	}
+
+	service := service.NewWebAuthnService(&repo, &credentials, &mocks.ChallengeRepo{}, service.NewRS256Signer(), domain.NewConfigSnapshot(config))
+	handler := NewWebAuthnRESTHandler(domain.NewConfigSnapshot(config), service)
+
+	context := gin.Context{
+		Request: &http.Request{
+			Header: http.Header{},
+			Body:   io.NopCloser(strings.NewReader(`{"username": "IronMan"}`)),
+		},
+	}
+
+	options, err := handler.BeginLogin(&context)
+
+	if err != nil {
+		t.Errorf("Expected login options without error, got: %v", err)
+	}
+
+	if options.Session == "" {
+		t.Error("Expected a ceremony session")
+	}
+
+	// The options don't reveal if the user exists or its credentials
+	if len(options.PublicKey.AllowCredentials) != 0 || repo.CallCount("GetByUsername") != 0 || credentials.CallCount("GetByUser") != 0 {
+		t.Errorf("Expected options without the user credentials got: %+v", options.PublicKey.AllowCredentials)
+	}
+}
+
+func TestPasskeyErrors(t *testing.T) {
+	config := domain.DefaultConfig()
+	config.Token.PrivateKey = PRIVATE_KEY
+	config.Token.PublicKey = PUBLIC_KEY
+
+	service := service.NewWebAuthnService(&mocks.UserRepo{}, &mocks.CredentialRepo{}, &mocks.ChallengeRepo{}, service.NewRS256Signer(), domain.NewConfigSnapshot(config))
+	handler := NewWebAuthnRESTHandler(domain.NewConfigSnapshot(config), service)
+
+	t.Run("Test invalid body", func(t *testing.T) {
+		context := gin.Context{
+			Request: &http.Request{
+				Header: http.Header{},
+				Body:   io.NopCloser(strings.NewReader("not json")),
+			},
+		}
+
+		_, err := handler.FinishLogin(&context)
+
+		parsed, ok := err.(*RestError)
+
+		if !ok {
+			t.Fatalf("Expected error of type RestError got: %v", err)
+		}
+
+		if parsed.Code != InavalidBody {
+			t.Errorf("Expected error code: %d got: %d", InavalidBody, parsed.Code)
+		}
+	})
+
+	t.Run("Test invalid session", func(t *testing.T) {
+		context := gin.Context{
+			Request: &http.Request{
+				Header: http.Header{},
+				Body:   io.NopCloser(strings.NewReader(`{"session": "not a session", "type": "public-key"}`)),
+			},
+		}
+
+		_, err := handler.FinishLogin(&context)
+
+		parsed, ok := err.(*RestError)
+
+		if !ok {
+			t.Fatalf("Expected error of type RestError got: %v", err)
+		}
+
+		if parsed.Code != InvalidCredential {
+			t.Errorf("Expected error code: %d got: %d", InvalidCredential, parsed.Code)
+		}
+	})
+
+	t.Run("Test begin registration errors", func(t *testing.T) {
+		cases := []struct {
+			name     string
+			err      error
+			expected *RestError
+		}{
+			{name: "Test deleted user", err: fmt.Errorf("%w: user", domain.ErrNotFound), expected: &UserNotRegisteredErr},
+			{name: "Test suspended user", err: domain.ErrUserNotActive, expected: &UserNotActiveErr},
+			{name: "Test unavailable storage", err: domain.ErrUnavailable, expected: &UpstreamUnavailableErr},
+		}
+
+		for _, testCase := range cases {
+			t.Run(testCase.name, func(t *testing.T) {
+				service := mocks.WebAuthnService{}
+				service.Returns("BeginRegistration", domain.CredentialCreation{}, testCase.err)
+
+				handler := NewWebAuthnRESTHandler(domain.NewConfigSnapshot(config), &service)
+
+				headers := http.Header{}
+				headers.Add(USER_ID_HEADER, "newid")
+				context := gin.Context{
+					Request: &http.Request{
+						Header: headers,
+					},
+				}
+
+				if _, err := handler.BeginRegistration(&context); err != testCase.expected {
+					t.Errorf("Expected error: %v got: %v", testCase.expected, err)
+				}
+
+				if call, _ := service.LastCall("BeginRegistration"); call.Args[0] != "newid" {
+					t.Errorf("Expected service to receive id: %q got: %v", "newid", call.Args)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,4 @@
+// Package metrics contains the Prometheus collectors of the service
+// The adapters are instrumented with decorators that observe these collectors,
+// so the core services don't depend on them
+package metrics
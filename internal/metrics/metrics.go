@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+const NAMESPACE = "spear"
+
+const (
+	RESULT_SUCCESS = "success"
+	RESULT_ERROR   = "error"
+
+	// Label of missing values
+	LABEL_NONE = "none"
+	// Label of the providers after MAX_PROVIDERS
+	LABEL_OTHER = "other"
+	// Providers are sent by clients, only the first ones seen are labeled to limit the number of series
+	MAX_PROVIDERS = 20
+)
+
+// Metrics holds the collectors of the service in its own registry
+type Metrics struct {
+	Registry *prometheus.Registry
+	// Authentication flow outcomes by flow, provider, result and error code
+	AuthOutcomes *prometheus.CounterVec
+	// REST handler latency by HTTP method, route and status
+	HandlerLatency *prometheus.HistogramVec
+	// UserRepo call latency by method and result
+	UserRepoLatency *prometheus.HistogramVec
+	// Time to sign the access and refresh tokens issued to users
+	SigningDuration prometheus.Histogram
+
+	lock      sync.Mutex
+	providers map[string]bool
+}
+
+// New creates the collectors and registers them with the Go runtime and process collectors
+func New(snapshot *domain.ConfigSnapshot) *Metrics {
+	metrics := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		AuthOutcomes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: NAMESPACE,
+			Name:      "auth_requests_total",
+			Help:      "Authentication requests by flow, provider, result and error code.",
+		}, []string{"flow", "provider", "result", "code"}),
+		HandlerLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: NAMESPACE,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time to handle a REST request by method, route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		UserRepoLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: NAMESPACE,
+			Name:      "user_repo_duration_seconds",
+			Help:      "Time of the user storage calls by method and result.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "result"}),
+		SigningDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: NAMESPACE,
+			Name:      "token_signing_duration_seconds",
+			Help:      "Time to sign a token issued to a user with the active signing key.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1},
+		}),
+		providers: map[string]bool{},
+	}
+
+	keys := &keyAge{snapshot: snapshot, now: time.Now}
+	keys.age()
+	metrics.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		metrics.AuthOutcomes,
+		metrics.HandlerLatency,
+		metrics.UserRepoLatency,
+		metrics.SigningDuration,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: NAMESPACE,
+			Name:      "signing_key_age_seconds",
+			Help:      "Seconds since this instance loaded the active signing key.",
+		}, keys.age),
+	)
+
+	return metrics
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (metrics *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveAuth counts the outcome of an authentication flow, code is empty when it succeeded
+func (metrics *Metrics) ObserveAuth(flow string, provider string, code string) {
+	result := RESULT_SUCCESS
+	if code != "" {
+		result = RESULT_ERROR
+	} else {
+		code = LABEL_NONE
+	}
+
+	metrics.AuthOutcomes.WithLabelValues(flow, metrics.provider(provider), result, code).Inc()
+}
+
+// Result returns the result label of an operation
+func Result(err error) string {
+	if err != nil {
+		return RESULT_ERROR
+	}
+
+	return RESULT_SUCCESS
+}
+
+// provider returns the label of a provider, providers after MAX_PROVIDERS share LABEL_OTHER
+func (metrics *Metrics) provider(provider string) string {
+	if provider == "" {
+		return LABEL_NONE
+	}
+
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+
+	if metrics.providers[provider] {
+		return provider
+	}
+
+	if len(metrics.providers) >= MAX_PROVIDERS {
+		return LABEL_OTHER
+	}
+
+	metrics.providers[provider] = true
+	return provider
+}
+
+// keyAge tracks when the signing key changed, keys don't have a creation time
+// so the age starts when this instance loads the key
+type keyAge struct {
+	snapshot *domain.ConfigSnapshot
+	now      func() time.Time
+
+	lock  sync.Mutex
+	key   string
+	since time.Time
+}
+
+func (keys *keyAge) age() float64 {
+	key := keys.snapshot.Get().Token.PrivateKey
+	now := keys.now()
+
+	keys.lock.Lock()
+	defer keys.lock.Unlock()
+
+	if key != keys.key {
+		keys.key = key
+		keys.since = now
+	}
+
+	return now.Sub(keys.since).Seconds()
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwt"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"github.com/sy-software/minerva-spear-users/mocks"
+)
+
+func TestObserveAuth(t *testing.T) {
+	metrics := New(domain.NewConfigSnapshot(domain.DefaultConfig()))
+
+	metrics.ObserveAuth("login", "google", "")
+	metrics.ObserveAuth("login", "", "54002")
+
+	if count := testutil.ToFloat64(metrics.AuthOutcomes.WithLabelValues("login", "google", RESULT_SUCCESS, LABEL_NONE)); count != 1 {
+		t.Errorf("Expected a successful login got: %v", count)
+	}
+
+	if count := testutil.ToFloat64(metrics.AuthOutcomes.WithLabelValues("login", LABEL_NONE, RESULT_ERROR, "54002")); count != 1 {
+		t.Errorf("Expected a failed login without provider got: %v", count)
+	}
+
+	t.Run("Test provider limit", func(t *testing.T) {
+		for i := 0; i < MAX_PROVIDERS*2; i++ {
+			metrics.ObserveAuth("register", "provider"+strconv.Itoa(i), "")
+		}
+
+		if count := testutil.ToFloat64(metrics.AuthOutcomes.WithLabelValues("register", LABEL_OTHER, RESULT_SUCCESS, LABEL_NONE)); count != MAX_PROVIDERS+1 {
+			t.Errorf("Expected %d providers labeled as other got: %v", MAX_PROVIDERS+1, count)
+		}
+
+		if count := testutil.ToFloat64(metrics.AuthOutcomes.WithLabelValues("register", "google", RESULT_SUCCESS, LABEL_NONE)); count != 0 {
+			t.Errorf("Expected providers seen before the limit to keep their label got: %v", count)
+		}
+	})
+}
+
+func TestKeyAge(t *testing.T) {
+	config := domain.DefaultConfig()
+	config.Token.PrivateKey = "first"
+	snapshot := domain.NewConfigSnapshot(config)
+
+	now := time.Now()
+	keys := &keyAge{snapshot: snapshot, now: func() time.Time { return now }}
+	keys.age()
+
+	now = now.Add(time.Minute)
+	if age := keys.age(); age != 60 {
+		t.Errorf("Expected age: 60 got: %v", age)
+	}
+
+	config.Token.PrivateKey = "second"
+	snapshot.Set(config)
+	now = now.Add(time.Minute)
+
+	if age := keys.age(); age != 0 {
+		t.Errorf("Expected the age to restart on rotation got: %v", age)
+	}
+}
+
+func TestSigningDuration(t *testing.T) {
+	metrics := New(domain.NewConfigSnapshot(domain.DefaultConfig()))
+	wrapped := mocks.TokenSigner{}
+	wrapped.Returns("Sign", []byte("signed"), nil)
+
+	signer := NewInstrumentedTokenSigner(&wrapped, metrics.SigningDuration)
+	if _, err := signer.Sign(jwt.New(), nil); err != nil {
+		t.Fatalf("Expected token to be signed got: %v", err)
+	}
+
+	if count := testutil.CollectAndCount(metrics.SigningDuration); count != 1 {
+		t.Fatalf("Expected the signing histogram to be collected got: %d series", count)
+	}
+
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+		if family.GetName() == "spear_token_signing_duration_seconds" {
+			if count := family.GetMetric()[0].GetHistogram().GetSampleCount(); count != 1 {
+				t.Errorf("Expected the signature to be measured got: %d samples", count)
+			}
+
+			return
+		}
+	}
+
+	t.Error("Expected the signing histogram to be registered")
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"crypto/rsa"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sy-software/minerva-spear-users/internal/core/ports"
+)
+
+// InstrumentedTokenSigner measures the signatures of another ports.TokenSigner
+// Implements ports.TokenSigner interface
+type InstrumentedTokenSigner struct {
+	signer   ports.TokenSigner
+	duration prometheus.Observer
+}
+
+// NewInstrumentedTokenSigner creates an instance of InstrumentedTokenSigner,
+// each signature is observed in seconds by duration
+func NewInstrumentedTokenSigner(signer ports.TokenSigner, duration prometheus.Observer) *InstrumentedTokenSigner {
+	return &InstrumentedTokenSigner{
+		signer:   signer,
+		duration: duration,
+	}
+}
+
+func (instrumented *InstrumentedTokenSigner) Sign(token jwt.Token, key *rsa.PrivateKey) ([]byte, error) {
+	start := time.Now()
+	signed, err := instrumented.signer.Sign(token, key)
+	instrumented.duration.Observe(time.Since(start).Seconds())
+	return signed, err
+}
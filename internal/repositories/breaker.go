@@ -0,0 +1,89 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+// ErrCircuitOpen is returned without calling the server while the circuit breaker is open
+var ErrCircuitOpen = fmt.Errorf("%w: circuit breaker is open", domain.ErrUnavailable)
+
+// circuitBreaker stops calling a server after consecutive outages,
+// once the cooldown passes a single call is allowed to test the server again
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	lock     sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow returns ErrCircuitOpen if the call should not reach the server
+func (breaker *circuitBreaker) allow() error {
+	if breaker.threshold <= 0 {
+		return nil
+	}
+
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	if breaker.failures < breaker.threshold {
+		return nil
+	}
+
+	if breaker.probing || breaker.now().Sub(breaker.openedAt) < breaker.cooldown {
+		return ErrCircuitOpen
+	}
+
+	breaker.probing = true
+	return nil
+}
+
+// record updates the breaker with the result of a call, only outages count as failures
+func (breaker *circuitBreaker) record(err error) {
+	if breaker.threshold <= 0 {
+		return
+	}
+
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	breaker.probing = false
+	if !isOutage(err) {
+		breaker.failures = 0
+		return
+	}
+
+	breaker.failures++
+	if breaker.failures >= breaker.threshold {
+		breaker.openedAt = breaker.now()
+	}
+}
+
+// release lets other calls test the server after a call that didn't finish
+func (breaker *circuitBreaker) release() {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+
+	breaker.probing = false
+}
+
+// isOutage reports if the error means the server can't answer right now
+func isOutage(err error) bool {
+	return errors.Is(err, domain.ErrUnavailable) || errors.Is(err, domain.ErrTimeout)
+}
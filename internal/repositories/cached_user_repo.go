@@ -0,0 +1,286 @@
+package repositories
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"github.com/sy-software/minerva-spear-users/internal/core/ports"
+	"github.com/sy-software/minerva-spear-users/internal/metrics"
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheStats counts the lookups answered by the cache,
+// negative hits are the cached not found results and are not counted as hits
+type CacheStats struct {
+	Hits         uint64
+	NegativeHits uint64
+	Misses       uint64
+}
+
+type cacheEntry struct {
+	key    string
+	user   domain.User
+	err    error
+	expire time.Time
+}
+
+// CachedUserRepo caches user lookups of another ports.UserRepo in a LRU,
+// not found results are cached for a shorter time
+// Implements ports.UserRepo interface
+type CachedUserRepo struct {
+	repo        ports.UserRepo
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	// Changes on each invalidation so lookups started before it are not cached
+	generation uint64
+	group      singleflight.Group
+
+	hits         uint64
+	negativeHits uint64
+	misses       uint64
+	now          func() time.Time
+}
+
+// NewCachedUserRepo creates an instance of CachedUserRepo
+func NewCachedUserRepo(repo ports.UserRepo, config domain.CacheConfig) *CachedUserRepo {
+	return &CachedUserRepo{
+		repo:        repo,
+		size:        config.Size,
+		ttl:         time.Duration(config.TTL) * time.Second,
+		negativeTTL: time.Duration(config.NegativeTTL) * time.Second,
+		entries:     map[string]*list.Element{},
+		order:       list.New(),
+		now:         time.Now,
+	}
+}
+
+func (cache *CachedUserRepo) Create(ctx context.Context, user domain.Register) (domain.User, error) {
+	created, err := cache.repo.Create(ctx, user)
+	// The username may be cached as not found
+	cache.invalidate(created.Id, user.Username, created.Username)
+	return created, err
+}
+
+func (cache *CachedUserRepo) GetById(ctx context.Context, id string) (domain.User, error) {
+	return cache.lookup("id:"+id, func() (domain.User, error) {
+		return cache.repo.GetById(ctx, id)
+	})
+}
+
+func (cache *CachedUserRepo) GetByUsername(ctx context.Context, username string) (domain.User, error) {
+	return cache.lookup("username:"+username, func() (domain.User, error) {
+		return cache.repo.GetByUsername(ctx, username)
+	})
+}
+
+func (cache *CachedUserRepo) List(ctx context.Context, filter domain.UserFilter) (domain.UserPage, error) {
+	return cache.repo.List(ctx, filter)
+}
+
+func (cache *CachedUserRepo) Update(ctx context.Context, id string, update domain.UserUpdate) (domain.User, error) {
+	updated, err := cache.repo.Update(ctx, id, update)
+
+	usernames := []string{updated.Username}
+	if update.Username != nil {
+		usernames = append(usernames, *update.Username)
+	}
+
+	cache.invalidate(id, usernames...)
+	return updated, err
+}
+
+func (cache *CachedUserRepo) UpdateStatus(ctx context.Context, id string, status string) (domain.User, error) {
+	updated, err := cache.repo.UpdateStatus(ctx, id, status)
+	cache.invalidate(id, updated.Username)
+	return updated, err
+}
+
+func (cache *CachedUserRepo) RevokeTokens(ctx context.Context, id string) (domain.User, error) {
+	updated, err := cache.repo.RevokeTokens(ctx, id)
+	cache.invalidate(id, updated.Username)
+	return updated, err
+}
+
+func (cache *CachedUserRepo) Delete(ctx context.Context, id string) error {
+	err := cache.repo.Delete(ctx, id)
+	cache.invalidate(id)
+	return err
+}
+
+// Ping checks the cached repository, it always succeeds when the repository can't be checked
+func (cache *CachedUserRepo) Ping(ctx context.Context) error {
+	if pinger, ok := cache.repo.(ports.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+
+	return nil
+}
+
+// Stats returns the number of cache hits, negative hits and misses
+func (cache *CachedUserRepo) Stats() CacheStats {
+	return CacheStats{
+		Hits:         atomic.LoadUint64(&cache.hits),
+		NegativeHits: atomic.LoadUint64(&cache.negativeHits),
+		Misses:       atomic.LoadUint64(&cache.misses),
+	}
+}
+
+// Collector exports Stats as the spear_user_cache_lookups_total counter by result
+func (cache *CachedUserRepo) Collector() prometheus.Collector {
+	return &cacheCollector{
+		cache: cache,
+		lookups: prometheus.NewDesc(
+			prometheus.BuildFQName(metrics.NAMESPACE, "user_cache", "lookups_total"),
+			"User cache lookups by result: hit, negative_hit or miss.",
+			[]string{"result"},
+			nil,
+		),
+	}
+}
+
+// lookup returns the cached result or loads it, concurrent loads of the same key share one call
+// made with the context of the first caller
+func (cache *CachedUserRepo) lookup(key string, load func() (domain.User, error)) (domain.User, error) {
+	if entry, ok := cache.get(key); ok {
+		if entry.err != nil {
+			atomic.AddUint64(&cache.negativeHits, 1)
+		} else {
+			atomic.AddUint64(&cache.hits, 1)
+		}
+
+		return entry.user, entry.err
+	}
+
+	atomic.AddUint64(&cache.misses, 1)
+
+	result, err, _ := cache.group.Do(key, func() (interface{}, error) {
+		cache.lock.Lock()
+		generation := cache.generation
+		cache.lock.Unlock()
+
+		user, err := load()
+		cache.set(key, user, err, generation)
+		return user, err
+	})
+
+	return result.(domain.User), err
+}
+
+func (cache *CachedUserRepo) get(key string) (*cacheEntry, bool) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	element, ok := cache.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if !cache.now().Before(entry.expire) {
+		cache.remove(element)
+		return nil, false
+	}
+
+	cache.order.MoveToFront(element)
+	return entry, true
+}
+
+func (cache *CachedUserRepo) set(key string, user domain.User, err error, generation uint64) {
+	ttl := cache.ttl
+	if err != nil {
+		// Only not found results are cached, other errors may be temporary
+		if !errors.Is(err, domain.ErrNotFound) {
+			return
+		}
+
+		ttl = cache.negativeTTL
+	}
+
+	if cache.size <= 0 || ttl <= 0 {
+		return
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	// The user changed while it was loading
+	if generation != cache.generation {
+		return
+	}
+
+	if element, ok := cache.entries[key]; ok {
+		cache.remove(element)
+	}
+
+	entry := &cacheEntry{key: key, user: user, err: err, expire: cache.now().Add(ttl)}
+	cache.entries[key] = cache.order.PushFront(entry)
+
+	for cache.order.Len() > cache.size {
+		cache.remove(cache.order.Back())
+	}
+}
+
+// invalidate removes every entry of the user and the given usernames
+func (cache *CachedUserRepo) invalidate(id string, usernames ...string) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	cache.generation++
+	keys := []string{"id:" + id}
+	for _, username := range usernames {
+		keys = append(keys, "username:"+username)
+	}
+
+	for _, key := range keys {
+		if element, ok := cache.entries[key]; ok {
+			cache.remove(element)
+		}
+	}
+
+	// The user may be cached by an old username
+	if id == "" {
+		return
+	}
+
+	for element := cache.order.Front(); element != nil; {
+		next := element.Next()
+		if element.Value.(*cacheEntry).user.Id == id {
+			cache.remove(element)
+		}
+
+		element = next
+	}
+}
+
+func (cache *CachedUserRepo) remove(element *list.Element) {
+	cache.order.Remove(element)
+	delete(cache.entries, element.Value.(*cacheEntry).key)
+}
+
+// cacheCollector reads the counters of a CachedUserRepo when the metrics are scraped
+type cacheCollector struct {
+	cache   *CachedUserRepo
+	lookups *prometheus.Desc
+}
+
+func (collector *cacheCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- collector.lookups
+}
+
+func (collector *cacheCollector) Collect(values chan<- prometheus.Metric) {
+	stats := collector.cache.Stats()
+	values <- prometheus.MustNewConstMetric(collector.lookups, prometheus.CounterValue, float64(stats.Hits), "hit")
+	values <- prometheus.MustNewConstMetric(collector.lookups, prometheus.CounterValue, float64(stats.NegativeHits), "negative_hit")
+	values <- prometheus.MustNewConstMetric(collector.lookups, prometheus.CounterValue, float64(stats.Misses), "miss")
+}
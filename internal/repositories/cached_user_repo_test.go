@@ -0,0 +1,230 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"github.com/sy-software/minerva-spear-users/mocks"
+)
+
+func TestCachedUserRepo(t *testing.T) {
+	var calls int32
+	users := map[string]domain.User{
+		"newid": {Id: "newid", Username: "ironman", Status: domain.UserActive},
+	}
+
+	repo := mocks.UserRepo{
+		GetByIdInterceptor: func(id string) (domain.User, error) {
+			atomic.AddInt32(&calls, 1)
+			if user, ok := users[id]; ok {
+				return user, nil
+			}
+
+			return domain.User{}, domain.ErrNotFound
+		},
+		GetByUsernameInterceptor: func(username string) (domain.User, error) {
+			atomic.AddInt32(&calls, 1)
+			for _, user := range users {
+				if user.Username == username {
+					return user, nil
+				}
+			}
+
+			return domain.User{}, domain.ErrNotFound
+		},
+		CreateInterceptor: func(user domain.Register) (domain.User, error) {
+			created := domain.User{Id: "otherid", Username: user.Username}
+			users[created.Id] = created
+			return created, nil
+		},
+		UpdateInterceptor: func(id string, update domain.UserUpdate) (domain.User, error) {
+			user := users[id]
+			user.Username = *update.Username
+			users[id] = user
+			return user, nil
+		},
+		UpdateStatusInterceptor: func(id string, status string) (domain.User, error) {
+			user := users[id]
+			user.Status = status
+			users[id] = user
+			return user, nil
+		},
+	}
+
+	config := domain.DefaultConfig().UserRepo.Cache
+	cache := NewCachedUserRepo(&repo, config)
+	now := time.Now()
+	cache.now = func() time.Time {
+		return now
+	}
+
+	ctx := context.Background()
+
+	t.Run("Test cache hit", func(t *testing.T) {
+		cache.GetById(ctx, "newid")
+		user, err := cache.GetById(ctx, "newid")
+
+		if err != nil || user.Username != "ironman" {
+			t.Errorf("Expected cached user got: %+v %v", user, err)
+		}
+
+		if calls != 1 {
+			t.Errorf("Expected %d repo calls got: %d", 1, calls)
+		}
+
+		if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+			t.Errorf("Expected 1 hit and 1 miss got: %+v", stats)
+		}
+	})
+
+	t.Run("Test cache expires", func(t *testing.T) {
+		now = now.Add(time.Duration(config.TTL) * time.Second)
+		cache.GetById(ctx, "newid")
+
+		if calls != 2 {
+			t.Errorf("Expected %d repo calls got: %d", 2, calls)
+		}
+	})
+
+	t.Run("Test negative cache", func(t *testing.T) {
+		calls = 0
+		cache.GetByUsername(ctx, "hulk")
+		_, err := cache.GetByUsername(ctx, "hulk")
+
+		if !errors.Is(err, domain.ErrNotFound) || calls != 1 {
+			t.Errorf("Expected cached not found got: %v after %d calls", err, calls)
+		}
+
+		now = now.Add(time.Duration(config.NegativeTTL) * time.Second)
+		cache.GetByUsername(ctx, "hulk")
+
+		if calls != 2 {
+			t.Errorf("Expected not found to expire got %d calls", calls)
+		}
+
+		if stats := cache.Stats(); stats.NegativeHits != 1 || stats.Hits != 1 {
+			t.Errorf("Expected 1 negative hit and 1 hit got: %+v", stats)
+		}
+	})
+
+	t.Run("Test collector", func(t *testing.T) {
+		expected := `
+		# HELP spear_user_cache_lookups_total User cache lookups by result: hit, negative_hit or miss.
+		# TYPE spear_user_cache_lookups_total counter
+		spear_user_cache_lookups_total{result="hit"} 1
+		spear_user_cache_lookups_total{result="miss"} 4
+		spear_user_cache_lookups_total{result="negative_hit"} 1
+		`
+
+		if err := testutil.CollectAndCompare(cache.Collector(), strings.NewReader(expected)); err != nil {
+			t.Errorf("Expected cache counters got: %v", err)
+		}
+	})
+
+	t.Run("Test create invalidates not found", func(t *testing.T) {
+		cache.Create(ctx, domain.Register{Username: "hulk"})
+		user, err := cache.GetByUsername(ctx, "hulk")
+
+		if err != nil || user.Id != "otherid" {
+			t.Errorf("Expected created user got: %+v %v", user, err)
+		}
+	})
+
+	t.Run("Test update invalidates every key", func(t *testing.T) {
+		cache.GetByUsername(ctx, "ironman")
+		cache.GetById(ctx, "newid")
+
+		username := "tonystark"
+		cache.Update(ctx, "newid", domain.UserUpdate{Username: &username})
+
+		if _, err := cache.GetByUsername(ctx, "ironman"); !errors.Is(err, domain.ErrNotFound) {
+			t.Errorf("Expected old username to not be found got: %v", err)
+		}
+
+		if user, _ := cache.GetById(ctx, "newid"); user.Username != "tonystark" {
+			t.Errorf("Expected updated user got: %+v", user)
+		}
+	})
+
+	t.Run("Test status change invalidates", func(t *testing.T) {
+		cache.GetByUsername(ctx, "tonystark")
+		cache.UpdateStatus(ctx, "newid", domain.UserSuspended)
+
+		if user, _ := cache.GetByUsername(ctx, "tonystark"); user.Status != domain.UserSuspended {
+			t.Errorf("Expected suspended user got: %+v", user)
+		}
+	})
+}
+
+func TestCachedUserRepoEviction(t *testing.T) {
+	var calls int32
+	repo := mocks.UserRepo{
+		GetByIdInterceptor: func(id string) (domain.User, error) {
+			atomic.AddInt32(&calls, 1)
+			return domain.User{Id: id}, nil
+		},
+	}
+
+	cache := NewCachedUserRepo(&repo, domain.CacheConfig{Size: 2, TTL: 60})
+	ctx := context.Background()
+
+	cache.GetById(ctx, "a")
+	cache.GetById(ctx, "b")
+	// "a" becomes the most recently used, "b" is evicted
+	cache.GetById(ctx, "a")
+	cache.GetById(ctx, "c")
+	cache.GetById(ctx, "a")
+
+	if calls != 3 {
+		t.Errorf("Expected %d repo calls got: %d", 3, calls)
+	}
+
+	cache.GetById(ctx, "b")
+
+	if calls != 4 {
+		t.Errorf("Expected evicted user to be loaded again got %d calls", calls)
+	}
+}
+
+func TestCachedUserRepoSingleflight(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	repo := mocks.UserRepo{
+		GetByIdInterceptor: func(id string) (domain.User, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return domain.User{Id: id}, nil
+		},
+	}
+
+	cache := NewCachedUserRepo(&repo, domain.CacheConfig{Size: 10, TTL: 60})
+
+	var wait sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			user, err := cache.GetById(context.Background(), "newid")
+
+			if err != nil || user.Id != "newid" {
+				t.Errorf("Expected user without error got: %+v %v", user, err)
+			}
+		}()
+	}
+
+	// Let the goroutines reach the cache before the first lookup finishes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wait.Wait()
+
+	if calls != 1 {
+		t.Errorf("Expected concurrent lookups to share %d call got: %d", 1, calls)
+	}
+}
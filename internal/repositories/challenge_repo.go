@@ -0,0 +1,51 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shurcooL/graphql"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+// ChallengeRepo records the used challenges in minerva owl GraphQL server,
+// it rejects a challenge used before its expiration with a duplicated value error
+// Implements ports.ChallengeRepo interface
+type ChallengeRepo struct {
+	config *domain.Config
+	client *graphClient
+}
+
+// NewChallengeRepo creates an instance of ChallengeRepo
+func NewChallengeRepo(config *domain.Config) (*ChallengeRepo, error) {
+	client, err := newGraphClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChallengeRepo{
+		config: config,
+		client: client,
+	}, nil
+}
+
+func (repo *ChallengeRepo) Use(ctx context.Context, challenge string, expire time.Time) error {
+	var m struct {
+		UseChallenge struct {
+			Challenge graphql.String
+		} `graphql:"useChallenge(challenge: $challenge, expiresAt: $expiresAt)"`
+	}
+
+	vars := map[string]interface{}{
+		"challenge": graphql.String(challenge),
+		"expiresAt": graphql.String(expire.UTC().Format(time.RFC3339)),
+	}
+
+	err := repo.client.mutate(ctx, &m, vars)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo Use Error")
+	}
+
+	return err
+}
@@ -0,0 +1,147 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"github.com/sy-software/minerva-spear-users/internal/core/ports"
+)
+
+func TestChallengeRepoConformance(t *testing.T) {
+	backends := map[string]func(t *testing.T) ports.ChallengeRepo{
+		"graphql": func(t *testing.T) ports.ChallengeRepo {
+			server := httptest.NewServer(newChallengeGraphStub())
+			t.Cleanup(server.Close)
+
+			config := domain.DefaultConfig()
+			config.UserRepo.Url = server.URL
+			return openTestChallengeRepo(t, &config)
+		},
+		"sqlite": func(t *testing.T) ports.ChallengeRepo {
+			config := domain.DefaultConfig()
+			config.UserRepo.Driver = domain.UserRepoSQLite
+			config.UserRepo.DSN = "file:" + filepath.Join(t.TempDir(), "users.db")
+			return openTestChallengeRepo(t, &config)
+		},
+		"memory": func(t *testing.T) ports.ChallengeRepo {
+			config := domain.DefaultConfig()
+			config.UserRepo.Driver = domain.UserRepoMemory
+			return openTestChallengeRepo(t, &config)
+		},
+		"postgres": func(t *testing.T) ports.ChallengeRepo {
+			dsn := os.Getenv(POSTGRES_DSN_VAR)
+			if dsn == "" {
+				t.Skipf("%s is not set", POSTGRES_DSN_VAR)
+			}
+
+			config := domain.DefaultConfig()
+			config.UserRepo.Driver = domain.UserRepoPostgres
+			config.UserRepo.DSN = dsn
+			repo := openTestChallengeRepo(t, &config)
+
+			if _, err := repo.(*SQLChallengeRepo).db.Exec("DELETE FROM challenges"); err != nil {
+				t.Fatalf("Can't clean challenges table: %v", err)
+			}
+
+			return repo
+		},
+	}
+
+	for name, newRepo := range backends {
+		t.Run(name, func(t *testing.T) {
+			runChallengeRepoConformance(t, newRepo(t))
+		})
+	}
+}
+
+func openTestChallengeRepo(t *testing.T, config *domain.Config) ports.ChallengeRepo {
+	users := openTestRepo(t, config)
+
+	repo, err := OpenChallengeRepo(config, users)
+	if err != nil {
+		t.Fatalf("Expected repo without error got: %v", err)
+	}
+
+	return repo
+}
+
+func runChallengeRepoConformance(t *testing.T, repo ports.ChallengeRepo) {
+	ctx := context.Background()
+	expire := time.Now().Add(time.Minute)
+
+	t.Run("Test use once", func(t *testing.T) {
+		if err := repo.Use(ctx, "challenge", expire); err != nil {
+			t.Fatalf("Expected the first use without error got: %v", err)
+		}
+
+		if err := repo.Use(ctx, "challenge", expire); !errors.Is(err, domain.ErrDuplicate) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrDuplicate, err)
+		}
+
+		if err := repo.Use(ctx, "other", expire); err != nil {
+			t.Errorf("Expected other challenges to be accepted got: %v", err)
+		}
+	})
+
+	t.Run("Test expired challenge", func(t *testing.T) {
+		expired := time.Now().Add(-time.Minute)
+		repo.Use(ctx, "expired", expired)
+
+		if err := repo.Use(ctx, "expired", expire); err != nil {
+			t.Errorf("Expected expired challenges to be forgotten got: %v", err)
+		}
+	})
+}
+
+// challengeGraphStub is a minimal owl GraphQL server that keeps the used challenges in memory
+type challengeGraphStub struct {
+	lock       sync.Mutex
+	challenges map[string]time.Time
+}
+
+func newChallengeGraphStub() *challengeGraphStub {
+	return &challengeGraphStub{challenges: map[string]time.Time{}}
+}
+
+func (stub *challengeGraphStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+
+	json.NewDecoder(r.Body).Decode(&request)
+
+	stub.lock.Lock()
+	defer stub.lock.Unlock()
+
+	vars := request.Variables
+	if !strings.Contains(request.Query, "useChallenge(") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	challenge := vars["challenge"].(string)
+	if expire, ok := stub.challenges[challenge]; ok && time.Now().Before(expire) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data":   nil,
+			"errors": []interface{}{map[string]interface{}{"message": "duplicated_value", "extensions": map[string]interface{}{"code": "DUPLICATED_VALUE"}}},
+		})
+		return
+	}
+
+	expire, _ := time.Parse(time.RFC3339, vars["expiresAt"].(string))
+	stub.challenges[challenge] = expire
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data": map[string]interface{}{"useChallenge": map[string]interface{}{"challenge": challenge}},
+	})
+}
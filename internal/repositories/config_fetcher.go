@@ -0,0 +1,257 @@
+package repositories
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Detached signatures are requested from the document URL with this suffix I.E.: spear-auth.sig
+const SIGNATURE_SUFFIX = ".sig"
+
+// configFetcher downloads the config server documents
+type configFetcher struct {
+	client *http.Client
+	// Optional, remembers the documents by URL so unchanged documents
+	// are not downloaded again when the server sends an ETag
+	documents configDocuments
+	// Optional pinned key, when set every document needs a valid detached signature
+	publicKey crypto.PublicKey
+}
+
+type configDocuments map[string]configDocument
+
+type configDocument struct {
+	etag string
+	body []byte
+}
+
+// newConfigFetcher creates the client with the config server authentication of repo
+func newConfigFetcher(repo *ConfigRepo) (*configFetcher, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if repo.CAFile != "" {
+		pool, err := loadCertPool(repo.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		transport.TLSClientConfig = tlsConfig(transport)
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	if repo.CertFile != "" || repo.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(repo.CertFile, repo.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't load config server client certificate: %w", err)
+		}
+
+		transport.TLSClientConfig = tlsConfig(transport)
+		transport.TLSClientConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	var roundTripper http.RoundTripper = transport
+	if repo.Token != "" || repo.TokenFile != "" {
+		roundTripper = &headerTransport{base: transport, header: "Authorization", value: repo.bearer}
+	}
+
+	fetcher := &configFetcher{
+		client: &http.Client{
+			Timeout:   time.Second * 10,
+			Transport: roundTripper,
+		},
+		documents: configDocuments{},
+	}
+
+	if repo.PublicKeyFile != "" {
+		publicKey, err := loadPublicKey(repo.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		fetcher.publicKey = publicKey
+	}
+
+	return fetcher, nil
+}
+
+// bearer returns the config server token, the file is read on every request so the token can be rotated
+func (repo *ConfigRepo) bearer() (string, error) {
+	if repo.TokenFile == "" {
+		return "Bearer " + repo.Token, nil
+	}
+
+	token, err := ioutil.ReadFile(repo.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("can't read config server token: %w", err)
+	}
+
+	return "Bearer " + strings.TrimSpace(string(token)), nil
+}
+
+// get requests a JSON document and checks the status, content type and signature
+func (fetcher *configFetcher) get(url string, value interface{}) error {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrConfigRejected, err)
+	}
+
+	cached, hasCached := fetcher.documents[url]
+	if hasCached {
+		request.Header.Set("If-None-Match", cached.etag)
+	}
+
+	response, err := fetcher.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrConfigUnavailable, err)
+	}
+
+	defer response.Body.Close()
+
+	// The cached document was verified when it was downloaded
+	if response.StatusCode == http.StatusNotModified && hasCached {
+		return decodeConfigDocument(cached.body, value)
+	}
+
+	if err := checkConfigStatus(url, response); err != nil {
+		return err
+	}
+
+	mediaType, _, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+		return fmt.Errorf("%w: %s content type is %q", ErrConfigInvalid, url, response.Header.Get("Content-Type"))
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrConfigUnavailable, err)
+	}
+
+	if err := fetcher.verify(url, body); err != nil {
+		return err
+	}
+
+	if err := decodeConfigDocument(body, value); err != nil {
+		return err
+	}
+
+	if etag := response.Header.Get("ETag"); etag != "" && fetcher.documents != nil {
+		fetcher.documents[url] = configDocument{etag: etag, body: body}
+	}
+
+	return nil
+}
+
+// verify checks the detached signature of the document in url, it's a base64 signature
+// of the document bytes: RSA PKCS #1 v1.5 or ECDSA with SHA-256, or Ed25519
+func (fetcher *configFetcher) verify(url string, body []byte) error {
+	if fetcher.publicKey == nil {
+		return nil
+	}
+
+	response, err := fetcher.client.Get(url + SIGNATURE_SUFFIX)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrConfigUnavailable, err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s is not signed", ErrConfigUnverified, url)
+	}
+
+	if err := checkConfigStatus(url+SIGNATURE_SUFFIX, response); err != nil {
+		return err
+	}
+
+	encoded, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrConfigUnavailable, err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("%w: %s signature is not base64: %v", ErrConfigUnverified, url, err)
+	}
+
+	if !verifySignature(fetcher.publicKey, body, signature) {
+		return fmt.Errorf("%w: invalid signature for %s", ErrConfigUnverified, url)
+	}
+
+	return nil
+}
+
+func verifySignature(publicKey crypto.PublicKey, body []byte, signature []byte) bool {
+	digest := sha256.Sum256(body)
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, body, signature)
+	}
+
+	return false
+}
+
+// checkConfigStatus maps the response status to the config server errors
+func checkConfigStatus(url string, response *http.Response) error {
+	if response.StatusCode >= http.StatusInternalServerError || response.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %s answered %d", ErrConfigUnavailable, url, response.StatusCode)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s answered %d", ErrConfigRejected, url, response.StatusCode)
+	}
+
+	return nil
+}
+
+func decodeConfigDocument(body []byte, value interface{}) error {
+	if err := json.Unmarshal(body, value); err != nil {
+		return fmt.Errorf("%w: %v", ErrConfigInvalid, err)
+	}
+
+	return nil
+}
+
+// loadPublicKey reads a PEM encoded PKIX public key
+func loadPublicKey(file string) (crypto.PublicKey, error) {
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("can't load config server public key: %w", err)
+	}
+
+	block, _ := pem.Decode(buf)
+	if block == nil {
+		return nil, errors.New("config server public key is not PEM encoded")
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse config server public key: %w", err)
+	}
+
+	switch publicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return publicKey, nil
+	}
+
+	return nil, fmt.Errorf("unsupported config server public key type %T", publicKey)
+}
@@ -0,0 +1,273 @@
+package repositories
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+func TestConfigServerAuth(t *testing.T) {
+	dir := t.TempDir()
+	clientCert := selfSignedCert(t, dir, "spear")
+
+	clients := x509.NewCertPool()
+	clients.AddCert(clientCert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Path != "/"+CONFIG_DOCUMENT {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"port": "9090"}`))
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clients,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+
+	configFile := filepath.Join(dir, "config.json")
+	ioutil.WriteFile(configFile, []byte(`{}`), 0600)
+
+	tokenFile := filepath.Join(dir, "token")
+	ioutil.WriteFile(tokenFile, []byte("secret\n"), 0600)
+
+	newRepo := func() *ConfigRepo {
+		return &ConfigRepo{
+			Server:    server.URL,
+			File:      configFile,
+			CAFile:    caFile,
+			CertFile:  filepath.Join(dir, "spear.pem"),
+			KeyFile:   filepath.Join(dir, "spear-key.pem"),
+			TokenFile: tokenFile,
+		}
+	}
+
+	t.Run("Test bearer token and client certificate", func(t *testing.T) {
+		repo := newRepo()
+		config, err := repo.fetch(domain.DefaultConfig())
+
+		if err != nil || config.Port != "9090" {
+			t.Errorf("Expected config without error got: %q %v", config.Port, err)
+		}
+	})
+
+	t.Run("Test without token", func(t *testing.T) {
+		repo := newRepo()
+		repo.TokenFile = ""
+		_, err := repo.fetch(domain.DefaultConfig())
+
+		if !errors.Is(err, ErrConfigRejected) {
+			t.Errorf("Expected error: %v got: %v", ErrConfigRejected, err)
+		}
+	})
+
+	t.Run("Test without client certificate", func(t *testing.T) {
+		repo := newRepo()
+		repo.CertFile = ""
+		repo.KeyFile = ""
+		_, err := repo.fetch(domain.DefaultConfig())
+
+		if !errors.Is(err, ErrConfigUnavailable) {
+			t.Errorf("Expected error: %v got: %v", ErrConfigUnavailable, err)
+		}
+	})
+
+	t.Run("Test invalid settings are not retried", func(t *testing.T) {
+		repo := newRepo()
+		repo.CAFile = filepath.Join(dir, "missing.pem")
+		repo.CacheFile = filepath.Join(dir, "cache.json")
+		ioutil.WriteFile(repo.CacheFile, []byte(`{"port": "9191"}`), 0600)
+		repo.Retries = 3
+		repo.sleep = func(time.Duration) { t.Error("Expected no retries") }
+
+		_, err := repo.Get()
+
+		if err == nil || errors.Is(err, ErrConfigUnavailable) {
+			t.Errorf("Expected a configuration error got: %v", err)
+		}
+	})
+}
+
+func TestConfigSignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document := []byte(`{"port": "9090"}`)
+	digest := sha256.Sum256(document)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mutex sync.Mutex
+	served := document
+	encodedSignature := base64.StdEncoding.EncodeToString(signature)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch r.URL.Path {
+		case "/" + CONFIG_DOCUMENT:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(served)
+		case "/" + CONFIG_DOCUMENT + SIGNATURE_SUFFIX:
+			if encodedSignature == "" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			w.Write([]byte(encodedSignature + "\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	serve := func(body []byte, signature string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		served = body
+		encodedSignature = signature
+	}
+
+	dir := t.TempDir()
+	publicKeyFile := writePublicKey(t, dir, &key.PublicKey)
+	configFile := filepath.Join(dir, "config.json")
+	ioutil.WriteFile(configFile, []byte(`{}`), 0600)
+
+	newRepo := func() *ConfigRepo {
+		return &ConfigRepo{
+			Server:        server.URL,
+			File:          configFile,
+			CacheFile:     filepath.Join(dir, "cache.json"),
+			PublicKeyFile: publicKeyFile,
+		}
+	}
+
+	t.Run("Test valid signature", func(t *testing.T) {
+		config, err := newRepo().Get()
+
+		if err != nil || config.Port != "9090" {
+			t.Errorf("Expected config without error got: %q %v", config.Port, err)
+		}
+	})
+
+	cases := []struct {
+		name      string
+		body      []byte
+		signature string
+	}{
+		{name: "Test tampered document", body: []byte(`{"port": "6666"}`), signature: encodedSignature},
+		{name: "Test missing signature", body: document, signature: ""},
+		{name: "Test invalid base64", body: document, signature: "not base64!"},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			serve(testCase.body, testCase.signature)
+			defer serve(document, encodedSignature)
+
+			// The last known good configuration is not used
+			_, err := newRepo().Get()
+
+			if !errors.Is(err, ErrConfigUnverified) {
+				t.Errorf("Expected error: %v got: %v", ErrConfigUnverified, err)
+			}
+		})
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	document := []byte(`{"port": "9090"}`)
+	digest := sha256.Sum256(document)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaSignature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name      string
+		publicKey crypto.PublicKey
+		signature []byte
+	}{
+		{name: "Test RSA", publicKey: &rsaKey.PublicKey, signature: rsaSignature},
+		{name: "Test Ed25519", publicKey: edPublic, signature: ed25519.Sign(edKey, document)},
+	}
+
+	dir := t.TempDir()
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			publicKey, err := loadPublicKey(writePublicKey(t, dir, testCase.publicKey))
+			if err != nil {
+				t.Fatalf("Expected public key without error got: %v", err)
+			}
+
+			if !verifySignature(publicKey, document, testCase.signature) {
+				t.Error("Expected a valid signature")
+			}
+
+			if verifySignature(publicKey, []byte(`{"port": "6666"}`), testCase.signature) {
+				t.Error("Expected an invalid signature for a different document")
+			}
+		})
+	}
+}
+
+func writePublicKey(t *testing.T, dir string, publicKey crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := ioutil.TempFile(dir, "public-*.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+	pem.Encode(file, &pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	return file.Name()
+}
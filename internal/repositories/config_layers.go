@@ -0,0 +1,272 @@
+package repositories
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"gopkg.in/yaml.v2"
+)
+
+// Environment variables starting with this prefix override the configuration
+// I.E.: SPEAR_TOKEN_DURATION sets token.duration
+const CONFIG_ENV_PREFIX = "SPEAR_"
+
+// ConfigOverrides are configuration values by JSON path I.E.: {"userRepo.url": "http://owl"}
+type ConfigOverrides map[string]string
+
+// EnvOverrides returns the overrides set with SPEAR_ environment variables,
+// environ has the same format as os.Environ
+func EnvOverrides(environ []string) ConfigOverrides {
+	paths := map[string]string{}
+	for _, path := range configPaths() {
+		paths[CONFIG_ENV_PREFIX+envName(path)] = path
+	}
+
+	overrides := ConfigOverrides{}
+	for _, variable := range environ {
+		name := strings.SplitN(variable, "=", 2)
+		if !strings.HasPrefix(name[0], CONFIG_ENV_PREFIX) || len(name) != 2 {
+			continue
+		}
+
+		path, ok := paths[name[0]]
+		if !ok {
+			log.Warn().Str("variable", name[0]).Msg("Unknown configuration environment variable")
+			continue
+		}
+
+		overrides[path] = name[1]
+	}
+
+	return overrides
+}
+
+// RegisterConfigFlags adds a flag for each configuration value I.E.: --token.duration,
+// the returned overrides are filled when the flags are parsed
+func RegisterConfigFlags(flags *flag.FlagSet) ConfigOverrides {
+	overrides := ConfigOverrides{}
+	for _, path := range configPaths() {
+		path := path
+		usage := fmt.Sprintf("Overrides %s, also set with %s%s", path, CONFIG_ENV_PREFIX, envName(path))
+		flags.Func(path, usage, func(value string) error {
+			// Check the value now so the error is reported with the flag
+			config := domain.DefaultConfig()
+			if err := setConfigValue(&config, path, value); err != nil {
+				return err
+			}
+
+			overrides[path] = value
+			return nil
+		})
+	}
+
+	return overrides
+}
+
+// Apply sets the overrides in the configuration
+func (overrides ConfigOverrides) Apply(config *domain.Config) error {
+	paths := make([]string, 0, len(overrides))
+	for path := range overrides {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := setConfigValue(config, path, overrides[path]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readConfigFile decodes a JSON or YAML file over the configuration,
+// the values missing in the file are kept
+func readConfigFile(file string, config *domain.Config) error {
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("can't open config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		// Converted to JSON to use the same field names in both formats
+		var document interface{}
+		if err := yaml.Unmarshal(buf, &document); err != nil {
+			return fmt.Errorf("can't read config file %s: %w", file, err)
+		}
+
+		buf, err = json.Marshal(yamlToJSON(document))
+		if err != nil {
+			return fmt.Errorf("can't read config file %s: %w", file, err)
+		}
+	}
+
+	if err := json.Unmarshal(buf, config); err != nil {
+		return fmt.Errorf("can't read config file %s: %w", file, err)
+	}
+
+	return nil
+}
+
+// yamlToJSON changes the map[interface{}]interface{} decoded by yaml to map[string]interface{}
+func yamlToJSON(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			converted[fmt.Sprint(key)] = yamlToJSON(item)
+		}
+
+		return converted
+	case []interface{}:
+		for i, item := range typed {
+			typed[i] = yamlToJSON(item)
+		}
+	}
+
+	return value
+}
+
+// configPaths lists the JSON paths of the configuration values that can be overridden
+func configPaths() []string {
+	paths := []string{}
+	walkConfig(reflect.ValueOf(domain.DefaultConfig()), "", func(path string, _ reflect.Value) bool {
+		paths = append(paths, path)
+		return true
+	})
+
+	return paths
+}
+
+// walkConfig calls visit for every string, number, bool and string list field
+// until visit returns false, the fields are named by their JSON path
+func walkConfig(value reflect.Value, prefix string, visit func(path string, field reflect.Value) bool) bool {
+	kind := value.Type()
+	for i := 0; i < kind.NumField(); i++ {
+		field := kind.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.PkgPath != "" || name == "" || name == "-" {
+			continue
+		}
+
+		path := prefix + name
+		fieldValue := value.Field(i)
+
+		switch fieldValue.Kind() {
+		case reflect.Struct:
+			if !walkConfig(fieldValue, path+".", visit) {
+				return false
+			}
+		case reflect.Map:
+			continue
+		case reflect.Slice:
+			if fieldValue.Type().Elem().Kind() == reflect.String && !visit(path, fieldValue) {
+				return false
+			}
+		default:
+			if !visit(path, fieldValue) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// setConfigValue parses the value with the type of the field in path
+func setConfigValue(config *domain.Config, path string, value string) error {
+	var err error
+	found := false
+	walkConfig(reflect.ValueOf(config).Elem(), "", func(fieldPath string, field reflect.Value) bool {
+		if fieldPath != path {
+			return true
+		}
+
+		found = true
+		err = setValue(field, strings.TrimSpace(value))
+		return false
+	})
+
+	if !found {
+		return fmt.Errorf("unknown configuration value: %s", path)
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func setValue(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		field.SetUint(parsed)
+	case reflect.Slice:
+		// Comma separated list I.E.: admin,owner
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+
+	return nil
+}
+
+// envName converts a JSON path to an environment variable name I.E.: userRepo.cache.ttl to USER_REPO_CACHE_TTL
+func envName(path string) string {
+	var name strings.Builder
+	runes := []rune(path)
+	for i, char := range runes {
+		if char == '.' {
+			name.WriteRune('_')
+			continue
+		}
+
+		if unicode.IsUpper(char) && i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])) {
+			name.WriteRune('_')
+		}
+
+		name.WriteRune(unicode.ToUpper(char))
+	}
+
+	return name.String()
+}
@@ -0,0 +1,107 @@
+package repositories
+
+import (
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+func TestConfigLayers(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	ioutil.WriteFile(file, []byte("host: 127.0.0.1\nport: \"9000\"\napiPrefix: /file\nuserRepo:\n  timeout: 100\n  cache:\n    ttl: 10\n"), 0600)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+CONFIG_DOCUMENT {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"port": "9001", "apiPrefix": "/server", "userRepo": {"timeout": 200}}`))
+	}))
+	defer server.Close()
+
+	flags := flag.NewFlagSet("spear", flag.ContinueOnError)
+	overrides := RegisterConfigFlags(flags)
+	if err := flags.Parse([]string{"--apiPrefix", "/flag", "--adminRoles", "admin, owner"}); err != nil {
+		t.Fatalf("Expected flags without error got: %v", err)
+	}
+
+	repo := ConfigRepo{
+		Server:  server.URL,
+		File:    file,
+		Environ: []string{"SPEAR_PORT=9002", "SPEAR_API_PREFIX=/env", "SPEAR_USER_REPO_CACHE_TTL=20", "PORT=1"},
+		Flags:   overrides,
+	}
+
+	config, err := repo.Get()
+
+	if err != nil {
+		t.Fatalf("Expected config without error got: %v", err)
+	}
+
+	expected := domain.DefaultConfig()
+	expected.Host = "127.0.0.1"
+	expected.Port = "9002"
+	expected.APIPrefix = "/flag"
+	expected.AdminRoles = []string{"admin", "owner"}
+	expected.UserRepo.Timeout = 200
+	expected.UserRepo.Cache.TTL = 20
+
+	if diff := cmp.Diff(expected, config, cmpopts.IgnoreUnexported(domain.Token{})); diff != "" {
+		t.Errorf("Expected each layer to override the previous (-want +got):\n%s", diff)
+	}
+}
+
+func TestConfigOverrides(t *testing.T) {
+	t.Run("Test environment names", func(t *testing.T) {
+		names := map[string]string{
+			"token.duration":        "TOKEN_DURATION",
+			"userRepo.cache.ttl":    "USER_REPO_CACHE_TTL",
+			"webAuthn.rpId":         "WEB_AUTHN_RP_ID",
+			"userRepo.auth.apiKey":  "USER_REPO_AUTH_API_KEY",
+			"errors.typeBaseUrl":    "ERRORS_TYPE_BASE_URL",
+			"username.denyListFile": "USERNAME_DENY_LIST_FILE",
+		}
+
+		for path, expected := range names {
+			if name := envName(path); name != expected {
+				t.Errorf("Expected %s name: %s got: %s", path, expected, name)
+			}
+		}
+	})
+
+	t.Run("Test invalid values", func(t *testing.T) {
+		config := domain.DefaultConfig()
+
+		if err := (ConfigOverrides{"token.duration": "week"}).Apply(&config); err == nil {
+			t.Error("Expected invalid number to fail")
+		}
+
+		if err := (ConfigOverrides{"errors.legacy": "maybe"}).Apply(&config); err == nil {
+			t.Error("Expected invalid bool to fail")
+		}
+
+		if err := (ConfigOverrides{"token.unknown": "1"}).Apply(&config); err == nil {
+			t.Error("Expected unknown path to fail")
+		}
+	})
+
+	t.Run("Test invalid flag", func(t *testing.T) {
+		flags := flag.NewFlagSet("spear", flag.ContinueOnError)
+		flags.SetOutput(ioutil.Discard)
+		RegisterConfigFlags(flags)
+
+		if err := flags.Parse([]string{"--userRepo.retries", "many"}); err == nil {
+			t.Error("Expected invalid flag value to fail")
+		}
+	})
+}
@@ -2,10 +2,13 @@ package repositories
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,61 +16,364 @@ import (
 	"github.com/sy-software/minerva-spear-users/internal/core/domain"
 )
 
-type ConfigRepo struct{}
-
 const (
 	DEFAULT_CONFIG_FILE = "./config.json"
 	CONFIG_FILE_VAR     = "CONFIG_FILE"
 	CONFIG_SERVER_VAR   = "CONFIG_SERVER"
+	// Optional file where the last configuration loaded from the config server is kept
+	CONFIG_CACHE_FILE_VAR = "CONFIG_CACHE_FILE"
+	// How many times a failed config server request is retried
+	CONFIG_RETRIES_VAR = "CONFIG_RETRIES"
+	// Bearer token sent to the config server, the _FILE variable is read on every request
+	CONFIG_SERVER_TOKEN_VAR      = "CONFIG_SERVER_TOKEN"
+	CONFIG_SERVER_TOKEN_FILE_VAR = "CONFIG_SERVER_TOKEN_FILE"
+	// PEM client certificate and key to authenticate with the config server using mTLS
+	CONFIG_SERVER_CERT_FILE_VAR = "CONFIG_SERVER_CERT_FILE"
+	CONFIG_SERVER_KEY_FILE_VAR  = "CONFIG_SERVER_KEY_FILE"
+	// PEM bundle used to verify the config server certificate, default: system roots
+	CONFIG_SERVER_CA_FILE_VAR = "CONFIG_SERVER_CA_FILE"
+	// PEM public key, when set the documents must have a valid detached signature
+	CONFIG_SERVER_PUBLIC_KEY_FILE_VAR = "CONFIG_SERVER_PUBLIC_KEY_FILE"
+	// Application name used to request the configuration, default: spear-auth
+	CONFIG_APP_VAR = "CONFIG_APP"
+	// Comma separated Spring Cloud Config profiles I.E.: staging,eu
+	CONFIG_PROFILES_VAR = "CONFIG_PROFILES"
+	// Optional Spring Cloud Config label, usually a branch
+	CONFIG_LABEL_VAR = "CONFIG_LABEL"
+	// Default application name, without profiles it's the config server document with the configuration
+	CONFIG_DOCUMENT = "spear-auth"
+	// Optional config server document with the error catalog I.E.: spear-auth-errors
+	ERRORS_DOCUMENT_SUFFIX = "-errors"
+
+	DEFAULT_CONFIG_RETRIES     = 5
+	DEFAULT_CONFIG_BACKOFF     = 500 * time.Millisecond
+	DEFAULT_CONFIG_MAX_BACKOFF = 10 * time.Second
 )
 
-func (repo *ConfigRepo) Get() domain.Config {
+var (
+	// ErrConfigUnavailable the config server can't be reached or failed to answer
+	ErrConfigUnavailable = errors.New("config server unavailable")
+	// ErrConfigRejected the config server refused the request I.E.: unknown document or forbidden
+	ErrConfigRejected = errors.New("config server rejected the request")
+	// ErrConfigInvalid the configuration is not a JSON document
+	ErrConfigInvalid = errors.New("invalid configuration")
+	// ErrConfigUnverified the document signature is missing or doesn't match the pinned public key
+	ErrConfigUnverified = errors.New("config signature verification failed")
+
+	// The config server authentication settings are invalid
+	errConfigClient = errors.New("can't configure config server client")
+)
+
+// ConfigRepo loads the configuration in layers, each one overrides the values of the previous:
+// defaults, JSON or YAML file, config server, SPEAR_ environment variables and flags
+// Implements ports.ConfigRepository interface
+type ConfigRepo struct {
+	// Config server base URL, not used when empty
+	Server string
+	// Application name, default: spear-auth
+	App string
+	// Without profiles the configuration is the {Server}/{App} JSON document,
+	// with profiles it's the Spring Cloud Config environment {Server}/{App}/{Profiles}/{Label}
+	Profiles []string
+	Label    string
+	// JSON or YAML configuration file, when empty ./config.json is used if it exists
+	File string
+	// Last known good configuration, written after each config server load
+	// and used when the config server fails, disabled when empty
+	CacheFile  string
+	Retries    int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Environment variables in os.Environ format
+	Environ []string
+	// Usually set with RegisterConfigFlags
+	Flags ConfigOverrides
+
+	// Config server authentication and verification, see newConfigFetcher
+	Token         string
+	TokenFile     string
+	CertFile      string
+	KeyFile       string
+	CAFile        string
+	PublicKeyFile string
+
+	fetcher *configFetcher
+	sleep   func(time.Duration)
+}
+
+// NewConfigRepo creates an instance of ConfigRepo configured with environment variables
+func NewConfigRepo() *ConfigRepo {
+	repo := &ConfigRepo{
+		Server:        os.Getenv(CONFIG_SERVER_VAR),
+		App:           os.Getenv(CONFIG_APP_VAR),
+		Profiles:      splitList(os.Getenv(CONFIG_PROFILES_VAR)),
+		Label:         os.Getenv(CONFIG_LABEL_VAR),
+		File:          os.Getenv(CONFIG_FILE_VAR),
+		CacheFile:     os.Getenv(CONFIG_CACHE_FILE_VAR),
+		Retries:       DEFAULT_CONFIG_RETRIES,
+		Backoff:       DEFAULT_CONFIG_BACKOFF,
+		MaxBackoff:    DEFAULT_CONFIG_MAX_BACKOFF,
+		Environ:       os.Environ(),
+		Token:         os.Getenv(CONFIG_SERVER_TOKEN_VAR),
+		TokenFile:     os.Getenv(CONFIG_SERVER_TOKEN_FILE_VAR),
+		CertFile:      os.Getenv(CONFIG_SERVER_CERT_FILE_VAR),
+		KeyFile:       os.Getenv(CONFIG_SERVER_KEY_FILE_VAR),
+		CAFile:        os.Getenv(CONFIG_SERVER_CA_FILE_VAR),
+		PublicKeyFile: os.Getenv(CONFIG_SERVER_PUBLIC_KEY_FILE_VAR),
+	}
+
+	if retries := os.Getenv(CONFIG_RETRIES_VAR); retries != "" {
+		value, err := strconv.Atoi(retries)
+		if err != nil || value < 0 {
+			log.Warn().Str("value", retries).Msgf("Invalid %s, using %d", CONFIG_RETRIES_VAR, DEFAULT_CONFIG_RETRIES)
+		} else {
+			repo.Retries = value
+		}
+	}
+
+	return repo
+}
+
+func (repo *ConfigRepo) Get() (domain.Config, error) {
 	log.Info().Msg("Loading configuration")
+
+	config, err := repo.load(false)
+	if err != nil {
+		return domain.Config{}, err
+	}
+
+	log.Info().Msg("Configuration loaded")
+	return config, nil
+}
+
+// Reload loads the configuration again, used by ConfigWatcher. The config server is requested
+// once without the last known good fallback and unchanged documents are not downloaded
+func (repo *ConfigRepo) Reload() (domain.Config, error) {
+	return repo.load(true)
+}
+
+func (repo *ConfigRepo) load(reload bool) (domain.Config, error) {
 	config := domain.DefaultConfig()
-	configServer := os.Getenv(CONFIG_SERVER_VAR)
+	if err := repo.loadFile(&config, reload); err != nil {
+		return domain.Config{}, err
+	}
 
-	if configServer != "" {
-		log.Info().Msgf("Looking for configuration from: %s", configServer)
-		var netClient = &http.Client{
-			Timeout: time.Second * 10,
+	if repo.Server != "" {
+		var err error
+		if reload {
+			config, err = repo.fetch(config)
+		} else {
+			config, err = repo.loadServer(config)
 		}
 
-		if !strings.HasSuffix(configServer, "/") {
-			configServer = configServer + "/"
+		if err != nil {
+			return domain.Config{}, err
 		}
+	}
+
+	if err := EnvOverrides(repo.Environ).Apply(&config); err != nil {
+		return domain.Config{}, err
+	}
 
-		response, err := netClient.Get(fmt.Sprintf("%s%s", configServer, "spear-auth"))
+	if err := repo.Flags.Apply(&config); err != nil {
+		return domain.Config{}, err
+	}
 
-		if err != nil {
-			log.Error().Err(err).Msg("Can't load config")
-			panic(err)
+	return config, nil
+}
+
+// loadFile reads the configuration file, only the default file is optional
+func (repo *ConfigRepo) loadFile(config *domain.Config, reload bool) error {
+	file := repo.File
+	if file == "" {
+		file = DEFAULT_CONFIG_FILE
+	}
+
+	if !reload {
+		log.Info().Msgf("Looking for configuration from: %s", file)
+	}
+
+	err := readConfigFile(file, config)
+	if errors.Is(err, os.ErrNotExist) && repo.File == "" {
+		if !reload {
+			log.Warn().Err(err).Msg("Can't load config file. Default values will be used instead")
 		}
 
-		buf, err := ioutil.ReadAll(response.Body)
+		return nil
+	}
 
-		if err != nil {
-			log.Error().Err(err).Msg("Can't load config")
-			panic(err)
+	return err
+}
+
+// loadServer reads the config server documents over the base configuration
+func (repo *ConfigRepo) loadServer(base domain.Config) (domain.Config, error) {
+	log.Info().Str("app", repo.app()).Strs("profiles", repo.Profiles).Str("label", repo.Label).Msgf("Looking for configuration from: %s", repo.Server)
+	config, err := repo.fetchWithRetries(base)
+	// A configuration that can't be verified could have been tampered with,
+	// starting with the cached one would hide it
+	if err != nil && !errors.Is(err, ErrConfigUnverified) && !errors.Is(err, errConfigClient) {
+		return repo.lastKnownGood(err)
+	}
+
+	if err != nil {
+		return domain.Config{}, err
+	}
+
+	repo.saveLastKnownGood(config)
+	return config, nil
+}
+
+// fetchWithRetries loads the configuration, outages are retried and client errors are not
+func (repo *ConfigRepo) fetchWithRetries(base domain.Config) (domain.Config, error) {
+	sleep := repo.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	for attempt := 0; ; attempt++ {
+		config, err := repo.fetch(base)
+		if !errors.Is(err, ErrConfigUnavailable) || attempt >= repo.Retries {
+			return config, err
 		}
 
-		err = json.Unmarshal(buf, &config)
+		delay := backoffDelay(repo.Backoff, repo.MaxBackoff, attempt)
+		log.Warn().Err(err).Int("attempt", attempt+1).Dur("delay", delay).Msg("Retrying configuration load")
+		sleep(delay)
+	}
+}
+
+func (repo *ConfigRepo) fetch(config domain.Config) (domain.Config, error) {
+	server := repo.Server
+	if !strings.HasSuffix(server, "/") {
+		server = server + "/"
+	}
 
+	if repo.fetcher == nil {
+		fetcher, err := newConfigFetcher(repo)
 		if err != nil {
-			log.Error().Err(err).Msg("Can't load config")
-			panic(err)
+			return domain.Config{}, fmt.Errorf("%w: %v", errConfigClient, err)
 		}
 
-		log.Info().Msg("Configuration loaded")
-		return config
+		repo.fetcher = fetcher
 	}
 
-	configFile := os.Getenv(CONFIG_FILE_VAR)
-	if configFile == "" {
-		configFile = DEFAULT_CONFIG_FILE
+	app := repo.app()
+	if len(repo.Profiles) == 0 {
+		if err := repo.fetcher.get(server+url.PathEscape(app), &config); err != nil {
+			return domain.Config{}, err
+		}
+	} else {
+		var environment springEnvironment
+		if err := repo.fetcher.get(environmentURL(server, app, repo.Profiles, repo.Label), &environment); err != nil {
+			return domain.Config{}, err
+		}
+
+		if err := environment.apply(&config); err != nil {
+			return domain.Config{}, err
+		}
 	}
 
-	log.Info().Msgf("Looking for configuration from: %s", configFile)
-	config = domain.LoadConfiguration(configFile)
-	log.Info().Msg("Configuration loaded")
-	return config
+	loadErrorCatalog(repo.fetcher, server+url.PathEscape(app+ERRORS_DOCUMENT_SUFFIX), &config)
+	return config, nil
+}
+
+func (repo *ConfigRepo) app() string {
+	if repo.App == "" {
+		return CONFIG_DOCUMENT
+	}
+
+	return repo.App
+}
+
+// splitList splits a comma separated list ignoring empty items
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// lastKnownGood loads the cached configuration after the config server failed with cause
+func (repo *ConfigRepo) lastKnownGood(cause error) (domain.Config, error) {
+	if repo.CacheFile == "" {
+		return domain.Config{}, cause
+	}
+
+	buf, err := ioutil.ReadFile(repo.CacheFile)
+	if err != nil {
+		log.Error().Err(err).Msg("Can't read last known good configuration")
+		return domain.Config{}, cause
+	}
+
+	config := domain.DefaultConfig()
+	if err := json.Unmarshal(buf, &config); err != nil {
+		log.Error().Err(err).Msg("Can't read last known good configuration")
+		return domain.Config{}, cause
+	}
+
+	log.Warn().Err(cause).Str("file", repo.CacheFile).Msg("Config server failed, using last known good configuration")
+	return config, nil
+}
+
+// saveLastKnownGood writes the configuration to the cache file, the file is replaced
+// atomically so a crash never leaves a partial configuration
+func (repo *ConfigRepo) saveLastKnownGood(config domain.Config) {
+	if repo.CacheFile == "" {
+		return
+	}
+
+	buf, err := json.Marshal(config)
+	if err != nil {
+		log.Warn().Err(err).Msg("Can't save last known good configuration")
+		return
+	}
+
+	// TempFile is only readable by the owner, the configuration includes the private key
+	temp, err := ioutil.TempFile(filepath.Dir(repo.CacheFile), filepath.Base(repo.CacheFile)+".*")
+	if err != nil {
+		log.Warn().Err(err).Msg("Can't save last known good configuration")
+		return
+	}
+
+	_, err = temp.Write(buf)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(temp.Name(), repo.CacheFile)
+	}
+
+	if err != nil {
+		os.Remove(temp.Name())
+		log.Warn().Err(err).Msg("Can't save last known good configuration")
+	}
+}
+
+// loadErrorCatalog merges the error catalog document over the one in the configuration,
+// the catalog is optional so failures only keep the current one
+func loadErrorCatalog(fetcher *configFetcher, document string, config *domain.Config) {
+	var catalog map[string]domain.ErrorDefinition
+	err := fetcher.get(document, &catalog)
+	if errors.Is(err, ErrConfigRejected) {
+		log.Info().Err(err).Msg("Error catalog not available")
+		return
+	}
+
+	if err != nil {
+		log.Warn().Err(err).Msg("Can't load error catalog")
+		return
+	}
+
+	if config.Errors.Catalog == nil {
+		config.Errors.Catalog = map[string]domain.ErrorDefinition{}
+	}
+
+	for name, definition := range catalog {
+		config.Errors.Catalog[name] = definition
+	}
 }
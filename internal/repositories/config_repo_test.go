@@ -0,0 +1,178 @@
+package repositories
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+func TestLoadErrorCatalog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+CONFIG_DOCUMENT+ERRORS_DOCUMENT_SUFFIX {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"forbidden": {"messages": {"es": "acción no permitida"}}}`))
+	}))
+	defer server.Close()
+
+	config := domain.DefaultConfig()
+	config.Errors.Catalog = map[string]domain.ErrorDefinition{
+		"user-not-registered": {HTTPStatus: http.StatusUnauthorized},
+	}
+
+	loadErrorCatalog(&configFetcher{client: server.Client()}, server.URL+"/"+CONFIG_DOCUMENT+ERRORS_DOCUMENT_SUFFIX, &config)
+
+	if config.Errors.Catalog["forbidden"].Messages["es"] != "acción no permitida" {
+		t.Errorf("Expected the catalog document to be loaded got: %+v", config.Errors.Catalog)
+	}
+
+	if config.Errors.Catalog["user-not-registered"].HTTPStatus != http.StatusUnauthorized {
+		t.Errorf("Expected the configured entries to be kept got: %+v", config.Errors.Catalog)
+	}
+
+	loadErrorCatalog(&configFetcher{client: server.Client()}, server.URL+"/missing", &config)
+
+	if len(config.Errors.Catalog) != 2 {
+		t.Errorf("Expected a missing document to keep the catalog got: %+v", config.Errors.Catalog)
+	}
+}
+
+func TestConfigRepo(t *testing.T) {
+	var failures int32
+	var status int32 = http.StatusOK
+	contentType := "application/json; charset=utf-8"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+CONFIG_DOCUMENT {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+		w.Write([]byte(`{"port": "9090"}`))
+	}))
+	defer server.Close()
+
+	newRepo := func() *ConfigRepo {
+		return &ConfigRepo{
+			Server:    server.URL,
+			CacheFile: filepath.Join(t.TempDir(), "config.json"),
+			Retries:   2,
+			sleep:     func(time.Duration) {},
+		}
+	}
+
+	t.Run("Test retries outages", func(t *testing.T) {
+		failures = 2
+		config, err := newRepo().Get()
+
+		if err != nil || config.Port != "9090" {
+			t.Errorf("Expected config after retries got: %q %v", config.Port, err)
+		}
+	})
+
+	t.Run("Test gives up after retries", func(t *testing.T) {
+		failures = 3
+		repo := newRepo()
+		repo.CacheFile = ""
+		_, err := repo.Get()
+
+		if !errors.Is(err, ErrConfigUnavailable) {
+			t.Errorf("Expected error: %v got: %v", ErrConfigUnavailable, err)
+		}
+	})
+
+	t.Run("Test client errors are not retried", func(t *testing.T) {
+		failures = 0
+		status = http.StatusForbidden
+		defer func() { status = http.StatusOK }()
+
+		repo := newRepo()
+		repo.CacheFile = ""
+		_, err := repo.Get()
+
+		if !errors.Is(err, ErrConfigRejected) {
+			t.Errorf("Expected error: %v got: %v", ErrConfigRejected, err)
+		}
+	})
+
+	t.Run("Test invalid content type", func(t *testing.T) {
+		failures = 0
+		contentType = "text/html"
+		defer func() { contentType = "application/json" }()
+
+		repo := newRepo()
+		repo.CacheFile = ""
+		_, err := repo.Get()
+
+		if !errors.Is(err, ErrConfigInvalid) {
+			t.Errorf("Expected error: %v got: %v", ErrConfigInvalid, err)
+		}
+	})
+
+	t.Run("Test last known good configuration", func(t *testing.T) {
+		failures = 0
+		repo := newRepo()
+		repo.Get()
+
+		failures = 10
+		config, err := repo.Get()
+
+		if err != nil || config.Port != "9090" {
+			t.Errorf("Expected cached config got: %q %v", config.Port, err)
+		}
+	})
+}
+
+func TestConfigRepoFile(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("Test missing file", func(t *testing.T) {
+		repo := ConfigRepo{File: filepath.Join(dir, "missing.json")}
+		_, err := repo.Get()
+
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected error: %v got: %v", os.ErrNotExist, err)
+		}
+	})
+
+	t.Run("Test invalid JSON", func(t *testing.T) {
+		file := filepath.Join(dir, "invalid.json")
+		ioutil.WriteFile(file, []byte(`{"port": 8080}`), 0600)
+
+		repo := ConfigRepo{File: file}
+		_, err := repo.Get()
+
+		if err == nil {
+			t.Error("Expected a decode error")
+		}
+	})
+
+	t.Run("Test defaults are kept", func(t *testing.T) {
+		file := filepath.Join(dir, "config.json")
+		ioutil.WriteFile(file, []byte(`{"port": "9090"}`), 0600)
+
+		repo := ConfigRepo{File: file}
+		config, err := repo.Get()
+
+		if err != nil || config.Port != "9090" || config.APIPrefix != domain.DefaultConfig().APIPrefix {
+			t.Errorf("Expected file values over the defaults got: %+v %v", config, err)
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package repositories
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+// List items in property sources I.E.: adminRoles[0]
+var listItemPattern = regexp.MustCompile(`^(.+)\[(\d+)\]$`)
+
+// springEnvironment is the Spring Cloud Config response for /{app}/{profiles}/{label}
+type springEnvironment struct {
+	Name     string   `json:"name"`
+	Profiles []string `json:"profiles"`
+	Label    string   `json:"label"`
+	Version  string   `json:"version"`
+	// The first source has the highest priority
+	PropertySources []propertySource `json:"propertySources"`
+}
+
+type propertySource struct {
+	Name   string                 `json:"name"`
+	Source map[string]interface{} `json:"source"`
+}
+
+// environmentURL returns the Spring Cloud Config URL I.E.: {server}/spear-auth/staging,eu/main
+func environmentURL(server string, app string, profiles []string, label string) string {
+	escaped := make([]string, 0, len(profiles))
+	for _, profile := range profiles {
+		escaped = append(escaped, url.PathEscape(profile))
+	}
+
+	location := server + url.PathEscape(app) + "/" + strings.Join(escaped, ",")
+	if label != "" {
+		// Spring Cloud Config replaces slashes in labels with (_) I.E.: release/1.0
+		location += "/" + url.PathEscape(strings.ReplaceAll(label, "/", "(_)"))
+	}
+
+	return location
+}
+
+// apply merges the property sources over the configuration, starting with the lowest priority source.
+// Keys are JSON paths I.E.: token.duration, case, dashes and underscores are ignored so
+// token.refresh-duration is also valid
+func (environment springEnvironment) apply(config *domain.Config) error {
+	paths := map[string]string{}
+	for _, path := range configPaths() {
+		paths[relaxedName(path)] = path
+	}
+
+	for i := len(environment.PropertySources) - 1; i >= 0; i-- {
+		source := environment.PropertySources[i]
+		overrides := ConfigOverrides{}
+
+		for key, value := range source.flatten() {
+			path, ok := paths[relaxedName(key)]
+			if !ok {
+				log.Debug().Str("source", source.Name).Str("key", key).Msg("Unknown configuration property")
+				continue
+			}
+
+			overrides[path] = value
+		}
+
+		if err := overrides.Apply(config); err != nil {
+			return fmt.Errorf("%w: property source %s: %v", ErrConfigInvalid, source.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// flatten returns the values by dotted key, nested objects are joined with dots
+// and lists are comma separated. A list replaces the list of lower priority sources
+func (source propertySource) flatten() map[string]string {
+	values := map[string]string{}
+	lists := map[string]map[int]string{}
+
+	var visit func(key string, value interface{})
+	visit = func(key string, value interface{}) {
+		switch typed := value.(type) {
+		case map[string]interface{}:
+			for name, item := range typed {
+				visit(key+"."+name, item)
+			}
+		case []interface{}:
+			for i, item := range typed {
+				visit(fmt.Sprintf("%s[%d]", key, i), item)
+			}
+		default:
+			if match := listItemPattern.FindStringSubmatch(key); match != nil {
+				index, _ := strconv.Atoi(match[2])
+				if lists[match[1]] == nil {
+					lists[match[1]] = map[int]string{}
+				}
+
+				lists[match[1]][index] = propertyString(value)
+				return
+			}
+
+			values[key] = propertyString(value)
+		}
+	}
+
+	for key, value := range source.Source {
+		visit(key, value)
+	}
+
+	for key, items := range lists {
+		indexes := make([]int, 0, len(items))
+		for index := range items {
+			indexes = append(indexes, index)
+		}
+
+		sort.Ints(indexes)
+		ordered := make([]string, 0, len(indexes))
+		for _, index := range indexes {
+			ordered = append(ordered, items[index])
+		}
+
+		values[key] = strings.Join(ordered, ",")
+	}
+
+	return values
+}
+
+func propertyString(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64)
+	}
+
+	return fmt.Sprint(value)
+}
+
+// relaxedName normalizes a property key I.E.: userRepo.url, user-repo.url and USER_REPO.URL are the same
+func relaxedName(key string) string {
+	key = strings.NewReplacer("-", "", "_", "").Replace(key)
+	return strings.ToLower(key)
+}
@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const springEnvironmentResponse = `{
+	"name": "spear-auth",
+	"profiles": ["staging", "eu"],
+	"label": "release/1.0",
+	"propertySources": [
+		{
+			"name": "spear-auth-eu.yml",
+			"source": {"token.duration": 90, "adminRoles[0]": "root"}
+		},
+		{
+			"name": "spear-auth.yml",
+			"source": {
+				"token.duration": 60,
+				"token.refresh-duration": 7200,
+				"adminRoles[0]": "admin",
+				"adminRoles[1]": "owner",
+				"userRepo": {"url": "http://owl", "cache": {"size": 0}},
+				"webAuthn.origins": ["https://minerva.com", "https://eu.minerva.com"],
+				"spring.application.name": "spear-auth"
+			}
+		}
+	]
+}`
+
+func TestSpringEnvironment(t *testing.T) {
+	requested := map[string]bool{}
+	body := springEnvironmentResponse
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested[r.URL.Path] = true
+		if r.URL.Path != "/spear-auth/staging,eu/release(_)1.0" && r.URL.Path != "/spear-auth-eu" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	file := filepath.Join(t.TempDir(), "config.json")
+	ioutil.WriteFile(file, []byte(`{"port": "9090"}`), 0600)
+
+	t.Run("Test property sources priority", func(t *testing.T) {
+		repo := &ConfigRepo{Server: server.URL, File: file, Profiles: []string{"staging", "eu"}, Label: "release/1.0"}
+		config, err := repo.Get()
+
+		if err != nil {
+			t.Fatalf("Expected config without error got: %v", err)
+		}
+
+		if config.Token.Duration != 90 || config.Token.RefreshDuration != 7200 {
+			t.Errorf("Expected the highest priority values got: %+v", config.Token)
+		}
+
+		if !cmp.Equal(config.AdminRoles, []string{"root"}) {
+			t.Errorf("Expected lists to be replaced got: %v", config.AdminRoles)
+		}
+
+		if !cmp.Equal(config.WebAuthn.Origins, []string{"https://minerva.com", "https://eu.minerva.com"}) {
+			t.Errorf("Expected JSON lists to be loaded got: %v", config.WebAuthn.Origins)
+		}
+
+		if config.UserRepo.Url != "http://owl" || config.UserRepo.Cache.Size != 0 {
+			t.Errorf("Expected nested values to be loaded got: %+v", config.UserRepo)
+		}
+
+		if config.Port != "9090" {
+			t.Errorf("Expected the file values to be kept got: %q", config.Port)
+		}
+	})
+
+	t.Run("Test invalid value", func(t *testing.T) {
+		body = `{"propertySources": [{"name": "broken.yml", "source": {"token.duration": "soon"}}]}`
+		defer func() { body = springEnvironmentResponse }()
+
+		repo := &ConfigRepo{Server: server.URL, File: file, Profiles: []string{"staging", "eu"}, Label: "release/1.0"}
+		_, err := repo.Get()
+
+		if !errors.Is(err, ErrConfigInvalid) {
+			t.Errorf("Expected error: %v got: %v", ErrConfigInvalid, err)
+		}
+	})
+
+	t.Run("Test application name without profiles", func(t *testing.T) {
+		body = `{"port": "9191"}`
+		defer func() { body = springEnvironmentResponse }()
+
+		repo := &ConfigRepo{Server: server.URL, File: file, App: "spear-auth-eu"}
+		config, err := repo.Get()
+
+		if err != nil || config.Port != "9191" || !requested["/spear-auth-eu"] {
+			t.Errorf("Expected the spear-auth-eu document got: %v %q %v", requested, config.Port, err)
+		}
+
+		if !requested["/spear-auth-eu"+ERRORS_DOCUMENT_SUFFIX] {
+			t.Errorf("Expected the spear-auth-eu error catalog to be requested got: %v", requested)
+		}
+	})
+}
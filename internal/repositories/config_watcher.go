@@ -0,0 +1,185 @@
+package repositories
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+const (
+	// Seconds between configuration reloads, 0 disables them
+	CONFIG_RELOAD_INTERVAL_VAR     = "CONFIG_RELOAD_INTERVAL"
+	DEFAULT_CONFIG_RELOAD_INTERVAL = 30 * time.Second
+)
+
+// The server and the repositories are created on startup,
+// changes to these values only take effect after a restart
+var restartConfigPaths = []string{
+	"host", "port", "apiPrefix", "userRepo.", "tls.",
+	"server.readTimeout", "server.readHeaderTimeout", "server.writeTimeout", "server.idleTimeout", "server.maxHeaderBytes",
+}
+
+// ConfigChange is a configuration value changed by a reload, the values of secrets are not kept
+type ConfigChange struct {
+	Path   string
+	Old    interface{}
+	New    interface{}
+	Secret bool
+}
+
+// ConfigWatcher reloads the configuration periodically and replaces the snapshot
+// when the configuration changed and it's valid
+type ConfigWatcher struct {
+	Repo     *ConfigRepo
+	Snapshot *domain.ConfigSnapshot
+	// Time between reloads, reloads are disabled when it's 0
+	Interval time.Duration
+	// Prepare changes each loaded configuration before it's validated I.E.: development mode
+	Prepare func(config *domain.Config) error
+}
+
+// NewConfigWatcher creates an instance of ConfigWatcher configured with environment variables
+func NewConfigWatcher(repo *ConfigRepo, snapshot *domain.ConfigSnapshot) *ConfigWatcher {
+	watcher := &ConfigWatcher{
+		Repo:     repo,
+		Snapshot: snapshot,
+		Interval: DEFAULT_CONFIG_RELOAD_INTERVAL,
+	}
+
+	if interval := os.Getenv(CONFIG_RELOAD_INTERVAL_VAR); interval != "" {
+		value, err := strconv.Atoi(interval)
+		if err != nil || value < 0 {
+			log.Warn().Str("value", interval).Msgf("Invalid %s, using %s", CONFIG_RELOAD_INTERVAL_VAR, DEFAULT_CONFIG_RELOAD_INTERVAL)
+		} else {
+			watcher.Interval = time.Duration(value) * time.Second
+		}
+	}
+
+	return watcher
+}
+
+// Run reloads the configuration every Interval until ctx is done,
+// the current configuration is kept when a reload fails
+func (watcher *ConfigWatcher) Run(ctx context.Context) {
+	if watcher.Interval <= 0 {
+		log.Info().Msg("Configuration reload disabled")
+		return
+	}
+
+	ticker := time.NewTicker(watcher.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := watcher.Reload(); err != nil {
+				log.Error().Err(err).Msg("Can't reload configuration, the current configuration is kept")
+			}
+		}
+	}
+}
+
+// Reload loads and validates the configuration, the snapshot is replaced when the configuration changed.
+// Returns the changes applied
+func (watcher *ConfigWatcher) Reload() ([]ConfigChange, error) {
+	config, err := watcher.Repo.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	if watcher.Prepare != nil {
+		if err := watcher.Prepare(&config); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	changes := ConfigChanges(*watcher.Snapshot.Get(), config)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	watcher.Snapshot.Set(config)
+	logConfigChanges(changes)
+	return changes, nil
+}
+
+// ConfigChanges lists the values that are different in current and next
+func ConfigChanges(current domain.Config, next domain.Config) []ConfigChange {
+	currentValues := configValues(current)
+	nextValues := configValues(next)
+	// Secrets are the values changed by Redacted
+	currentRedacted := configValues(current.Redacted())
+	nextRedacted := configValues(next.Redacted())
+
+	changes := []ConfigChange{}
+	for _, path := range configPaths() {
+		if reflect.DeepEqual(currentValues[path], nextValues[path]) {
+			continue
+		}
+
+		change := ConfigChange{Path: path, Old: currentValues[path], New: nextValues[path]}
+		if !reflect.DeepEqual(currentValues[path], currentRedacted[path]) || !reflect.DeepEqual(nextValues[path], nextRedacted[path]) {
+			change = ConfigChange{Path: path, Secret: true}
+		}
+
+		changes = append(changes, change)
+	}
+
+	// The catalog is not a single value, only the change is reported
+	if !reflect.DeepEqual(current.Errors.Catalog, next.Errors.Catalog) && len(current.Errors.Catalog)+len(next.Errors.Catalog) > 0 {
+		changes = append(changes, ConfigChange{Path: "errors.catalog"})
+	}
+
+	return changes
+}
+
+// configValues returns the configuration values by JSON path
+func configValues(config domain.Config) map[string]interface{} {
+	values := map[string]interface{}{}
+	walkConfig(reflect.ValueOf(config), "", func(path string, field reflect.Value) bool {
+		values[path] = field.Interface()
+		return true
+	})
+
+	return values
+}
+
+func logConfigChanges(changes []ConfigChange) {
+	for _, change := range changes {
+		event := log.Info()
+		if requiresRestart(change.Path) {
+			event = log.Warn().Bool("restartRequired", true)
+		}
+
+		event = event.Str("path", change.Path)
+		if !change.Secret && change.Old != nil {
+			event = event.Interface("old", change.Old).Interface("new", change.New)
+		}
+
+		event.Msg("Configuration value changed")
+	}
+
+	log.Info().Int("changes", len(changes)).Msg("Configuration reloaded")
+}
+
+func requiresRestart(path string) bool {
+	for _, restart := range restartConfigPaths {
+		if path == restart || (strings.HasSuffix(restart, ".") && strings.HasPrefix(path, restart)) {
+			return true
+		}
+	}
+
+	return false
+}
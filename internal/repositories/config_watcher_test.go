@@ -0,0 +1,215 @@
+package repositories
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+func TestConfigWatcher(t *testing.T) {
+	var mutex sync.Mutex
+	etag := `"v1"`
+	body := `{"token": {"duration": 60, "refreshDuration": 120}}`
+	notModified := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if r.URL.Path != "/"+CONFIG_DOCUMENT {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	serve := func(newEtag string, newBody string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		etag = newEtag
+		body = newBody
+	}
+
+	repo := &ConfigRepo{Server: server.URL, File: filepath.Join(t.TempDir(), "config.json")}
+	ioutil.WriteFile(repo.File, []byte(`{"port": "8080"}`), 0600)
+
+	config, err := repo.Get()
+	if err != nil {
+		t.Fatalf("Expected config without error got: %v", err)
+	}
+
+	privateKey, publicKey := testKeyPair(t)
+	prepare := func(config *domain.Config) error {
+		config.Token.PrivateKey = privateKey
+		config.Token.PublicKey = publicKey
+		config.UserRepo.Driver = domain.UserRepoMemory
+		return nil
+	}
+
+	prepare(&config)
+	watcher := &ConfigWatcher{Repo: repo, Snapshot: domain.NewConfigSnapshot(config), Prepare: prepare}
+
+	t.Run("Test unchanged documents are not downloaded", func(t *testing.T) {
+		changes, err := watcher.Reload()
+
+		if err != nil || len(changes) != 0 {
+			t.Errorf("Expected no changes got: %+v %v", changes, err)
+		}
+
+		if notModified != 1 {
+			t.Errorf("Expected If-None-Match to be answered with 304 got: %d", notModified)
+		}
+
+		if watcher.Snapshot.Get().Token.Duration != 60 {
+			t.Errorf("Expected the cached document to be used got: %+v", watcher.Snapshot.Get().Token)
+		}
+	})
+
+	t.Run("Test changed values", func(t *testing.T) {
+		serve(`"v2"`, `{"token": {"duration": 90, "refreshDuration": 120}}`)
+		ioutil.WriteFile(repo.File, []byte(`{"port": "8081"}`), 0600)
+
+		changes, err := watcher.Reload()
+		if err != nil {
+			t.Fatalf("Expected reload without error got: %v", err)
+		}
+
+		expected := []ConfigChange{
+			{Path: "token.duration", Old: int64(60), New: int64(90)},
+			{Path: "port", Old: "8080", New: "8081"},
+		}
+
+		if len(changes) != len(expected) || changes[0] != expected[0] || changes[1] != expected[1] {
+			t.Errorf("Expected changes: %+v got: %+v", expected, changes)
+		}
+
+		current := watcher.Snapshot.Get()
+		if current.Token.Duration != 90 || current.Port != "8081" {
+			t.Errorf("Expected the snapshot to be replaced got: %+v", current)
+		}
+	})
+
+	t.Run("Test invalid configuration is not applied", func(t *testing.T) {
+		serve(`"v3"`, `{"token": {"duration": -1}}`)
+
+		_, err := watcher.Reload()
+
+		if !errors.Is(err, domain.ErrValidation) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrValidation, err)
+		}
+
+		if watcher.Snapshot.Get().Token.Duration != 90 {
+			t.Errorf("Expected the current configuration to be kept got: %+v", watcher.Snapshot.Get().Token)
+		}
+	})
+
+	t.Run("Test config server errors are not retried", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		failing := &ConfigWatcher{
+			Repo:     &ConfigRepo{Server: server.URL, Retries: 5, sleep: func(time.Duration) { t.Error("Expected no retries") }},
+			Snapshot: watcher.Snapshot,
+		}
+
+		_, err := failing.Reload()
+
+		if !errors.Is(err, ErrConfigUnavailable) {
+			t.Errorf("Expected error: %v got: %v", ErrConfigUnavailable, err)
+		}
+	})
+
+	t.Run("Test disabled", func(t *testing.T) {
+		disabled := &ConfigWatcher{Repo: repo, Snapshot: watcher.Snapshot}
+		done := make(chan struct{})
+		go func() {
+			disabled.Run(context.Background())
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Error("Expected Run to return when the interval is 0")
+		}
+	})
+}
+
+func TestConfigChanges(t *testing.T) {
+	current := domain.DefaultConfig()
+	current.Token.PrivateKey = "old key"
+	current.UserRepo.DSN = "postgres://spear:secret@db/users"
+
+	next := current
+	next.Token.PrivateKey = "new key"
+	next.UserRepo.DSN = "postgres://spear:other@db/users"
+	next.AdminRoles = []string{"admin", "owner"}
+	next.Errors.Catalog = map[string]domain.ErrorDefinition{"forbidden": {Code: 4030}}
+
+	changes := ConfigChanges(current, next)
+	byPath := map[string]ConfigChange{}
+	for _, change := range changes {
+		byPath[change.Path] = change
+	}
+
+	for _, path := range []string{"token.privateKey", "userRepo.dsn"} {
+		change, ok := byPath[path]
+		if !ok || !change.Secret || change.Old != nil || change.New != nil {
+			t.Errorf("Expected %s to be reported without values got: %+v", path, change)
+		}
+	}
+
+	if change := byPath["adminRoles"]; change.Secret || len(change.New.([]string)) != 2 {
+		t.Errorf("Expected adminRoles change with values got: %+v", change)
+	}
+
+	if _, ok := byPath["errors.catalog"]; !ok {
+		t.Errorf("Expected errors.catalog change got: %+v", changes)
+	}
+
+	if len(changes) != 4 {
+		t.Errorf("Expected 4 changes got: %+v", changes)
+	}
+
+	if !requiresRestart("userRepo.dsn") || !requiresRestart("port") || requiresRestart("token.duration") {
+		t.Error("Expected only server and repository values to require a restart")
+	}
+}
+
+func testKeyPair(t *testing.T) (string, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}))
+}
@@ -0,0 +1,170 @@
+package repositories
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shurcooL/graphql"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+type graphCredential struct {
+	Id         graphql.String
+	UserID     graphql.String
+	PublicKey  graphql.String
+	SignCount  graphql.Int
+	Transports []graphql.String
+}
+
+// CredentialRepo stores passkeys in minerva owl GraphQL server
+// Implements ports.CredentialRepo interface
+type CredentialRepo struct {
+	config *domain.Config
+	client *graphClient
+}
+
+// NewCredentialRepo creates an instance of CredentialRepo
+func NewCredentialRepo(config *domain.Config) (*CredentialRepo, error) {
+	client, err := newGraphClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CredentialRepo{
+		config: config,
+		client: client,
+	}, nil
+}
+
+func (repo *CredentialRepo) Create(ctx context.Context, credential domain.Credential) (domain.Credential, error) {
+	var m struct {
+		CreateCredential graphCredential `graphql:"createCredential(input:{id: $id, userID: $userID, publicKey: $publicKey, signCount: $signCount, transports: $transports})"`
+	}
+
+	transports := make([]graphql.String, 0, len(credential.Transports))
+	for _, transport := range credential.Transports {
+		transports = append(transports, graphql.String(transport))
+	}
+
+	vars := map[string]interface{}{
+		"id":         graphql.String(credential.Id),
+		"userID":     graphql.String(credential.UserId),
+		"publicKey":  graphql.String(base64.StdEncoding.EncodeToString(credential.PublicKey)),
+		"signCount":  graphql.Int(credential.SignCount),
+		"transports": transports,
+	}
+
+	err := repo.client.mutate(ctx, &m, vars)
+	if err != nil {
+		return domain.Credential{}, err
+	}
+
+	created, err := toCredential(m.CreateCredential)
+	if err != nil {
+		return domain.Credential{}, err
+	}
+
+	created.CreatedAt = credential.CreatedAt
+	return created, nil
+}
+
+func (repo *CredentialRepo) GetById(ctx context.Context, id string) (domain.Credential, error) {
+	var query struct {
+		Credential graphCredential `graphql:"credential(id: $id)"`
+	}
+
+	vars := map[string]interface{}{
+		"id": graphql.String(id),
+	}
+
+	err := repo.client.query(ctx, &query, vars)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo GetById Error")
+		return domain.Credential{}, err
+	}
+
+	return toCredential(query.Credential)
+}
+
+func (repo *CredentialRepo) GetByUser(ctx context.Context, userId string) ([]domain.Credential, error) {
+	var query struct {
+		Credentials []graphCredential `graphql:"credentialsByUser(userID: $userID)"`
+	}
+
+	vars := map[string]interface{}{
+		"userID": graphql.String(userId),
+	}
+
+	err := repo.client.query(ctx, &query, vars)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo GetByUser Error")
+		return nil, err
+	}
+
+	credentials := make([]domain.Credential, 0, len(query.Credentials))
+	for _, item := range query.Credentials {
+		credential, err := toCredential(item)
+		if err != nil {
+			return nil, err
+		}
+
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, nil
+}
+
+func (repo *CredentialRepo) UpdateSignCount(ctx context.Context, id string, signCount uint32) error {
+	var m struct {
+		UpdateCredential struct {
+			Id graphql.String
+		} `graphql:"updateCredential(id: $id, input:{signCount: $signCount})"`
+	}
+
+	vars := map[string]interface{}{
+		"id":        graphql.String(id),
+		"signCount": graphql.Int(signCount),
+	}
+
+	return repo.client.mutate(ctx, &m, vars)
+}
+
+func (repo *CredentialRepo) DeleteByUser(ctx context.Context, userId string) error {
+	var m struct {
+		DeleteCredentials []struct {
+			Id graphql.String
+		} `graphql:"deleteCredentialsByUser(userID: $userID)"`
+	}
+
+	vars := map[string]interface{}{
+		"userID": graphql.String(userId),
+	}
+
+	err := repo.client.mutate(ctx, &m, vars)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo DeleteByUser Error")
+	}
+
+	return err
+}
+
+func toCredential(credential graphCredential) (domain.Credential, error) {
+	publicKey, err := base64.StdEncoding.DecodeString(string(credential.PublicKey))
+	if err != nil {
+		return domain.Credential{}, err
+	}
+
+	transports := make([]string, 0, len(credential.Transports))
+	for _, transport := range credential.Transports {
+		transports = append(transports, string(transport))
+	}
+
+	return domain.Credential{
+		Id:         string(credential.Id),
+		UserId:     string(credential.UserID),
+		PublicKey:  publicKey,
+		SignCount:  uint32(credential.SignCount),
+		Transports: transports,
+	}, nil
+}
@@ -0,0 +1,269 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"github.com/sy-software/minerva-spear-users/internal/core/ports"
+)
+
+func TestCredentialRepoConformance(t *testing.T) {
+	backends := map[string]func(t *testing.T) ports.CredentialRepo{
+		"graphql": func(t *testing.T) ports.CredentialRepo {
+			server := httptest.NewServer(newCredentialGraphStub())
+			t.Cleanup(server.Close)
+
+			config := domain.DefaultConfig()
+			config.UserRepo.Url = server.URL
+			return openTestCredentialRepo(t, &config)
+		},
+		"sqlite": func(t *testing.T) ports.CredentialRepo {
+			config := domain.DefaultConfig()
+			config.UserRepo.Driver = domain.UserRepoSQLite
+			config.UserRepo.DSN = "file:" + filepath.Join(t.TempDir(), "users.db")
+			return openTestCredentialRepo(t, &config)
+		},
+		"memory": func(t *testing.T) ports.CredentialRepo {
+			config := domain.DefaultConfig()
+			config.UserRepo.Driver = domain.UserRepoMemory
+			return openTestCredentialRepo(t, &config)
+		},
+		"postgres": func(t *testing.T) ports.CredentialRepo {
+			dsn := os.Getenv(POSTGRES_DSN_VAR)
+			if dsn == "" {
+				t.Skipf("%s is not set", POSTGRES_DSN_VAR)
+			}
+
+			config := domain.DefaultConfig()
+			config.UserRepo.Driver = domain.UserRepoPostgres
+			config.UserRepo.DSN = dsn
+			repo := openTestCredentialRepo(t, &config)
+
+			if _, err := repo.(*SQLCredentialRepo).db.Exec("DELETE FROM credentials"); err != nil {
+				t.Fatalf("Can't clean credentials table: %v", err)
+			}
+
+			return repo
+		},
+	}
+
+	for name, newRepo := range backends {
+		t.Run(name, func(t *testing.T) {
+			runCredentialRepoConformance(t, newRepo(t))
+		})
+	}
+}
+
+func openTestCredentialRepo(t *testing.T, config *domain.Config) ports.CredentialRepo {
+	users := openTestRepo(t, config)
+
+	repo, err := OpenCredentialRepo(config, users)
+	if err != nil {
+		t.Fatalf("Expected repo without error got: %v", err)
+	}
+
+	return repo
+}
+
+func runCredentialRepoConformance(t *testing.T, repo ports.CredentialRepo) {
+	ctx := context.Background()
+	// The creation time is not returned by every storage
+	ignoreCreatedAt := cmpopts.IgnoreFields(domain.Credential{}, "CreatedAt")
+
+	credential := domain.Credential{
+		Id:         "credential",
+		UserId:     "ironman",
+		PublicKey:  []byte{1, 2, 3, 4},
+		SignCount:  1,
+		Transports: []string{"usb", "internal"},
+	}
+
+	created, err := repo.Create(ctx, credential)
+	if err != nil {
+		t.Fatalf("Expected credential to be created got: %v", err)
+	}
+
+	if diff := cmp.Diff(credential, created, ignoreCreatedAt); diff != "" {
+		t.Errorf("Expected created credential (-want +got):\n%s", diff)
+	}
+
+	t.Run("Test get", func(t *testing.T) {
+		found, err := repo.GetById(ctx, "credential")
+
+		if err != nil {
+			t.Fatalf("Expected credential got: %v", err)
+		}
+
+		if diff := cmp.Diff(credential, found, ignoreCreatedAt); diff != "" {
+			t.Errorf("Expected credential (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("Test not found", func(t *testing.T) {
+		if _, err := repo.GetById(ctx, "unknown"); !errors.Is(err, domain.ErrNotFound) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrNotFound, err)
+		}
+	})
+
+	t.Run("Test duplicated credential", func(t *testing.T) {
+		_, err := repo.Create(ctx, domain.Credential{Id: "credential", UserId: "hulk", PublicKey: []byte{5}})
+
+		if !errors.Is(err, domain.ErrDuplicate) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrDuplicate, err)
+		}
+	})
+
+	repo.Create(ctx, domain.Credential{Id: "phone", UserId: "ironman", PublicKey: []byte{5}, Transports: []string{"hybrid"}})
+	repo.Create(ctx, domain.Credential{Id: "hulk", UserId: "hulk", PublicKey: []byte{6}, Transports: []string{}})
+
+	t.Run("Test get by user", func(t *testing.T) {
+		credentials, err := repo.GetByUser(ctx, "ironman")
+
+		ids := []string{}
+		for _, credential := range credentials {
+			ids = append(ids, credential.Id)
+		}
+
+		sort.Strings(ids)
+		if err != nil || !cmp.Equal(ids, []string{"credential", "phone"}) {
+			t.Errorf("Expected credentials: [credential phone] got: %v %v", ids, err)
+		}
+
+		if credentials, err := repo.GetByUser(ctx, "loki"); err != nil || len(credentials) != 0 {
+			t.Errorf("Expected no credentials got: %+v %v", credentials, err)
+		}
+	})
+
+	t.Run("Test update sign count", func(t *testing.T) {
+		if err := repo.UpdateSignCount(ctx, "credential", 42); err != nil {
+			t.Fatalf("Expected sign count to be updated got: %v", err)
+		}
+
+		if found, _ := repo.GetById(ctx, "credential"); found.SignCount != 42 {
+			t.Errorf("Expected sign count: %d got: %d", 42, found.SignCount)
+		}
+
+		if err := repo.UpdateSignCount(ctx, "unknown", 42); !errors.Is(err, domain.ErrNotFound) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrNotFound, err)
+		}
+	})
+
+	t.Run("Test delete by user", func(t *testing.T) {
+		if err := repo.DeleteByUser(ctx, "ironman"); err != nil {
+			t.Fatalf("Expected credentials to be deleted got: %v", err)
+		}
+
+		if credentials, err := repo.GetByUser(ctx, "ironman"); err != nil || len(credentials) != 0 {
+			t.Errorf("Expected no credentials got: %+v %v", credentials, err)
+		}
+
+		if _, err := repo.GetById(ctx, "hulk"); err != nil {
+			t.Errorf("Expected credentials of other users to be kept got: %v", err)
+		}
+
+		if err := repo.DeleteByUser(ctx, "loki"); err != nil {
+			t.Errorf("Expected users without credentials to be ignored got: %v", err)
+		}
+	})
+}
+
+// credentialGraphStub is a minimal owl GraphQL server that keeps credentials in memory
+type credentialGraphStub struct {
+	lock        sync.Mutex
+	credentials map[string]map[string]interface{}
+}
+
+func newCredentialGraphStub() *credentialGraphStub {
+	return &credentialGraphStub{credentials: map[string]map[string]interface{}{}}
+}
+
+func (stub *credentialGraphStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+
+	json.NewDecoder(r.Body).Decode(&request)
+
+	stub.lock.Lock()
+	defer stub.lock.Unlock()
+
+	vars := request.Variables
+	var data map[string]interface{}
+	var code string
+
+	switch {
+	case strings.Contains(request.Query, "createCredential("):
+		id := vars["id"].(string)
+		if _, ok := stub.credentials[id]; ok {
+			code = "DUPLICATED_VALUE"
+			break
+		}
+
+		credential := map[string]interface{}{}
+		for _, field := range []string{"id", "userID", "publicKey", "signCount", "transports"} {
+			credential[field] = vars[field]
+		}
+
+		stub.credentials[id] = credential
+		data = map[string]interface{}{"createCredential": credential}
+	case strings.Contains(request.Query, "credentialsByUser("):
+		data = map[string]interface{}{"credentialsByUser": stub.byUser(vars["userID"])}
+	case strings.Contains(request.Query, "updateCredential("):
+		credential, ok := stub.credentials[vars["id"].(string)]
+		if !ok {
+			code = "NOT_FOUND"
+			break
+		}
+
+		credential["signCount"] = vars["signCount"]
+		data = map[string]interface{}{"updateCredential": map[string]interface{}{"id": credential["id"]}}
+	case strings.Contains(request.Query, "deleteCredentialsByUser("):
+		deleted := []map[string]interface{}{}
+		for _, credential := range stub.byUser(vars["userID"]) {
+			delete(stub.credentials, credential["id"].(string))
+			deleted = append(deleted, map[string]interface{}{"id": credential["id"]})
+		}
+
+		data = map[string]interface{}{"deleteCredentialsByUser": deleted}
+	case strings.Contains(request.Query, "credential("):
+		if credential, ok := stub.credentials[vars["id"].(string)]; ok {
+			data = map[string]interface{}{"credential": credential}
+		} else {
+			code = "NOT_FOUND"
+		}
+	}
+
+	if code != "" {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data":   nil,
+			"errors": []interface{}{map[string]interface{}{"message": strings.ToLower(code), "extensions": map[string]interface{}{"code": code}}},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func (stub *credentialGraphStub) byUser(userId interface{}) []map[string]interface{} {
+	credentials := []map[string]interface{}{}
+	for _, credential := range stub.credentials {
+		if credential["userID"] == userId {
+			credentials = append(credentials, credential)
+		}
+	}
+
+	return credentials
+}
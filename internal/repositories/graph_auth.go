@@ -0,0 +1,163 @@
+package repositories
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwt"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+// Identity of this service in the service JWT
+const SERVICE_TOKEN_ISSUER = "minerva/spear/auth"
+
+// configureAuth sets up the transport to authenticate with the GraphQL server,
+// it returns the RoundTripper that must be used to send the requests
+func configureAuth(transport *http.Transport, config *domain.Config) (http.RoundTripper, error) {
+	auth := config.UserRepo.Auth
+
+	if auth.CAFile != "" {
+		pool, err := loadCertPool(auth.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		transport.TLSClientConfig = tlsConfig(transport)
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	switch auth.Type {
+	case "", domain.UpstreamAuthNone:
+		return transport, nil
+	case domain.UpstreamAuthAPIKey:
+		if auth.APIKey == "" {
+			return nil, errors.New("userRepo.auth.apiKey is required")
+		}
+
+		header := auth.Header
+		if header == "" {
+			header = "X-API-KEY"
+		}
+
+		return &headerTransport{base: transport, header: header, value: func() (string, error) {
+			return auth.APIKey, nil
+		}}, nil
+	case domain.UpstreamAuthMTLS:
+		certificate, err := tls.LoadX509KeyPair(auth.CertFile, auth.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't load userRepo client certificate: %w", err)
+		}
+
+		transport.TLSClientConfig = tlsConfig(transport)
+		transport.TLSClientConfig.Certificates = []tls.Certificate{certificate}
+		return transport, nil
+	case domain.UpstreamAuthJWT:
+		tokens := &serviceTokens{token: &config.Token, auth: auth, now: time.Now}
+		if _, err := config.Token.KeyPair(); err != nil {
+			return nil, fmt.Errorf("service JWT needs a valid token key pair: %w", err)
+		}
+
+		return &headerTransport{base: transport, header: "Authorization", value: tokens.bearer}, nil
+	}
+
+	return nil, fmt.Errorf("unknown userRepo.auth.type: %q", auth.Type)
+}
+
+func tlsConfig(transport *http.Transport) *tls.Config {
+	if transport.TLSClientConfig != nil {
+		return transport.TLSClientConfig
+	}
+
+	return &tls.Config{MinVersion: tls.VersionTLS12}
+}
+
+// loadCertPool reads a PEM bundle with one or more certificates
+func loadCertPool(file string) (*x509.CertPool, error) {
+	bundle, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("can't load CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("no certificates found in CA bundle: %s", file)
+	}
+
+	return pool, nil
+}
+
+// headerTransport adds an authentication header to every request
+type headerTransport struct {
+	base   http.RoundTripper
+	header string
+	value  func() (string, error)
+}
+
+func (transport *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	value, err := transport.value()
+	if err != nil {
+		return nil, err
+	}
+
+	// A RoundTripper must not modify the caller request
+	req = req.Clone(req.Context())
+	req.Header.Set(transport.header, value)
+	return transport.base.RoundTrip(req)
+}
+
+// serviceTokens mints short lived JWTs identifying this service,
+// a token is reused until a third of its duration is left
+type serviceTokens struct {
+	token *domain.Token
+	auth  domain.UpstreamAuthConfig
+	now   func() time.Time
+
+	lock    sync.Mutex
+	current string
+	expire  time.Time
+}
+
+func (tokens *serviceTokens) bearer() (string, error) {
+	tokens.lock.Lock()
+	defer tokens.lock.Unlock()
+
+	duration := time.Duration(tokens.auth.TokenDuration) * time.Second
+	if duration <= 0 {
+		duration = time.Minute
+	}
+
+	now := tokens.now()
+	if tokens.current != "" && tokens.expire.Sub(now) > duration/3 {
+		return "Bearer " + tokens.current, nil
+	}
+
+	key, err := tokens.token.KeyPair()
+	if err != nil {
+		return "", err
+	}
+
+	expire := now.Add(duration)
+	token := jwt.New()
+	token.Set(jwt.IssuerKey, SERVICE_TOKEN_ISSUER)
+	token.Set(jwt.SubjectKey, SERVICE_TOKEN_ISSUER)
+	token.Set(jwt.AudienceKey, tokens.auth.Audience)
+	token.Set(jwt.IssuedAtKey, now)
+	token.Set(jwt.ExpirationKey, expire)
+	token.Set("use", "service")
+
+	signed, err := jwt.Sign(token, jwa.RS256, key)
+	if err != nil {
+		return "", fmt.Errorf("can't sign service JWT: %w", err)
+	}
+
+	tokens.current = string(signed)
+	tokens.expire = expire
+	return "Bearer " + tokens.current, nil
+}
@@ -0,0 +1,231 @@
+package repositories
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwt"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+const userResponse = `{"data": {"user": {"id": "newid", "username": "ironman"}}}`
+
+func TestUpstreamAPIKey(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("X-OWL-KEY")
+		w.Write([]byte(userResponse))
+	}))
+	defer server.Close()
+
+	config := domain.DefaultConfig()
+	config.UserRepo.Url = server.URL
+	config.UserRepo.Auth.Type = domain.UpstreamAuthAPIKey
+	config.UserRepo.Auth.Header = "X-OWL-KEY"
+	config.UserRepo.Auth.APIKey = "secret"
+
+	repo, err := NewUserRepo(&config)
+
+	if err != nil {
+		t.Fatalf("Expected repo without error got: %v", err)
+	}
+
+	repo.GetById(context.Background(), "newid")
+
+	if received != "secret" {
+		t.Errorf("Expected API key header: %q got: %q", "secret", received)
+	}
+}
+
+func TestUpstreamServiceJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+
+	tokens := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens <- strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		w.Write([]byte(userResponse))
+	}))
+	defer server.Close()
+
+	config := domain.DefaultConfig()
+	config.UserRepo.Url = server.URL
+	config.UserRepo.Auth.Type = domain.UpstreamAuthJWT
+	config.Token.PrivateKey = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	config.Token.PublicKey = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}))
+
+	repo, err := NewUserRepo(&config)
+
+	if err != nil {
+		t.Fatalf("Expected repo without error got: %v", err)
+	}
+
+	repo.GetById(context.Background(), "newid")
+	repo.GetById(context.Background(), "newid")
+
+	first, second := <-tokens, <-tokens
+
+	token, err := jwt.Parse(
+		[]byte(first),
+		jwt.WithVerify(jwa.RS256, key.PublicKey),
+		jwt.WithValidate(true),
+		jwt.WithAudience("minerva/owl"),
+	)
+
+	if err != nil {
+		t.Fatalf("Expected a valid service JWT got: %v", err)
+	}
+
+	if token.Subject() != SERVICE_TOKEN_ISSUER || token.Expiration().Sub(time.Now()) > time.Minute {
+		t.Errorf("Expected short lived service token got subject: %q expiration: %v", token.Subject(), token.Expiration())
+	}
+
+	if first != second {
+		t.Error("Expected the service token to be reused")
+	}
+}
+
+func TestUpstreamMTLS(t *testing.T) {
+	dir := t.TempDir()
+	clientCert := selfSignedCert(t, dir, "spear")
+
+	clients := x509.NewCertPool()
+	clients.AddCert(clientCert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(userResponse))
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clients,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+
+	config := domain.DefaultConfig()
+	config.UserRepo.Url = server.URL
+	config.UserRepo.Retries = 0
+	config.UserRepo.Auth.CAFile = caFile
+
+	t.Run("Test without client certificate", func(t *testing.T) {
+		repo, err := NewUserRepo(&config)
+
+		if err != nil {
+			t.Fatalf("Expected repo without error got: %v", err)
+		}
+
+		_, err = repo.GetById(context.Background(), "newid")
+
+		if err == nil {
+			t.Error("Expected the server to reject the connection")
+		}
+	})
+
+	t.Run("Test with client certificate", func(t *testing.T) {
+		mtlsConfig := config
+		mtlsConfig.UserRepo.Auth.Type = domain.UpstreamAuthMTLS
+		mtlsConfig.UserRepo.Auth.CertFile = filepath.Join(dir, "spear.pem")
+		mtlsConfig.UserRepo.Auth.KeyFile = filepath.Join(dir, "spear-key.pem")
+
+		repo, err := NewUserRepo(&mtlsConfig)
+
+		if err != nil {
+			t.Fatalf("Expected repo without error got: %v", err)
+		}
+
+		user, err := repo.GetById(context.Background(), "newid")
+
+		if err != nil || user.Id != "newid" {
+			t.Errorf("Expected user without error got: %+v %v", user, err)
+		}
+	})
+}
+
+func TestUpstreamAuthErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		auth domain.UpstreamAuthConfig
+	}{
+		{name: "Test unknown type", auth: domain.UpstreamAuthConfig{Type: "magic"}},
+		{name: "Test missing API key", auth: domain.UpstreamAuthConfig{Type: domain.UpstreamAuthAPIKey}},
+		{name: "Test missing certificate", auth: domain.UpstreamAuthConfig{Type: domain.UpstreamAuthMTLS, CertFile: "missing.pem", KeyFile: "missing.pem"}},
+		{name: "Test missing CA bundle", auth: domain.UpstreamAuthConfig{CAFile: "missing.pem"}},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			config := domain.DefaultConfig()
+			config.UserRepo.Auth = testCase.auth
+
+			_, err := NewUserRepo(&config)
+
+			if err == nil {
+				t.Error("Expected a configuration error")
+			}
+		})
+	}
+}
+
+// selfSignedCert writes a certificate and its key to {name}.pem and {name}-key.pem
+func selfSignedCert(t *testing.T, dir string, name string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: raw}), 0600)
+	ioutil.WriteFile(filepath.Join(dir, name+"-key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600)
+
+	certificate, err := x509.ParseCertificate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return certificate
+}
@@ -0,0 +1,186 @@
+package repositories
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shurcooL/graphql"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+// graphClient wraps the GraphQL client with per call timeouts, retries and a circuit breaker
+type graphClient struct {
+	config  *domain.Config
+	client  *graphql.Client
+	breaker *circuitBreaker
+}
+
+func newGraphClient(config *domain.Config) (*graphClient, error) {
+	httpClient, err := newGraphHTTPClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &graphClient{
+		config: config,
+		client: graphql.NewClient(config.UserRepo.Url, httpClient),
+		breaker: newCircuitBreaker(
+			config.UserRepo.BreakerThreshold,
+			time.Duration(config.UserRepo.BreakerCooldown)*time.Millisecond,
+		),
+	}, nil
+}
+
+// query runs a read only operation, it is retried after outages and timeouts
+func (graph *graphClient) query(ctx context.Context, q interface{}, vars map[string]interface{}) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = graph.call(ctx, func(ctx context.Context) error {
+			return graph.client.Query(ctx, q, vars)
+		})
+
+		if !isOutage(err) || err == ErrCircuitOpen || attempt >= graph.config.UserRepo.Retries {
+			return err
+		}
+
+		delay := graph.backoff(attempt)
+		log.Debug().Err(err).Int("attempt", attempt+1).Dur("delay", delay).Msg("Retrying GraphQL query")
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// mutate runs an operation that changes data, it is never retried
+// because the server may have applied it before failing
+func (graph *graphClient) mutate(ctx context.Context, m interface{}, vars map[string]interface{}) error {
+	return graph.call(ctx, func(ctx context.Context) error {
+		return graph.client.Mutate(ctx, m, vars)
+	})
+}
+
+// ping runs the cheapest query any GraphQL server answers, it's not retried
+// so health checks report outages right away
+func (graph *graphClient) ping(ctx context.Context) error {
+	var query struct {
+		Typename graphql.String `graphql:"__typename"`
+	}
+
+	return graph.call(ctx, func(ctx context.Context) error {
+		return graph.client.Query(ctx, &query, nil)
+	})
+}
+
+func (graph *graphClient) call(ctx context.Context, operation func(ctx context.Context) error) error {
+	if err := graph.breaker.allow(); err != nil {
+		return err
+	}
+
+	callCtx, cancel := callContext(ctx, graph.config)
+	defer cancel()
+
+	err := translateError(operation(callCtx))
+	if ctx.Err() != nil {
+		// The caller gave up, it says nothing about the server
+		graph.breaker.release()
+	} else {
+		graph.breaker.record(err)
+	}
+
+	return err
+}
+
+// backoff returns the delay before a retry of a query
+func (graph *graphClient) backoff(attempt int) time.Duration {
+	return backoffDelay(
+		time.Duration(graph.config.UserRepo.RetryBackoff)*time.Millisecond,
+		time.Duration(graph.config.UserRepo.RetryMaxBackoff)*time.Millisecond,
+		attempt,
+	)
+}
+
+// backoffDelay returns the delay before a retry, the delay doubles on each attempt
+// and is randomized so clients don't retry at the same time
+func backoffDelay(delay time.Duration, max time.Duration, attempt int) time.Duration {
+	for i := 0; i < attempt && (max <= 0 || delay < max); i++ {
+		delay *= 2
+	}
+
+	if max > 0 && delay > max {
+		delay = max
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// newGraphHTTPClient creates the http client used to talk to the GraphQL server
+func newGraphHTTPClient(repoConfig *domain.Config) (*http.Client, error) {
+	config := repoConfig.UserRepo.Transport
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	milliseconds := func(value int) time.Duration {
+		return time.Duration(value) * time.Millisecond
+	}
+
+	if config.MaxIdleConns > 0 {
+		transport.MaxIdleConns = config.MaxIdleConns
+	}
+
+	if config.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	}
+
+	if config.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = config.MaxConnsPerHost
+	}
+
+	if config.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = milliseconds(config.IdleConnTimeout)
+	}
+
+	if config.DialTimeout > 0 {
+		dialer := &net.Dialer{
+			Timeout:   milliseconds(config.DialTimeout),
+			KeepAlive: 30 * time.Second,
+		}
+
+		transport.DialContext = dialer.DialContext
+	}
+
+	if config.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = milliseconds(config.TLSHandshakeTimeout)
+	}
+
+	if config.ResponseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = milliseconds(config.ResponseHeaderTimeout)
+	}
+
+	authenticated, err := configureAuth(transport, repoConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Transport: &graphErrorTransport{base: authenticated},
+	}, nil
+}
+
+// callContext limits a single call to the GraphQL server to the configured timeout,
+// the caller deadline is kept when it is shorter
+func callContext(ctx context.Context, config *domain.Config) (context.Context, context.CancelFunc) {
+	if config.UserRepo.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, time.Duration(config.UserRepo.Timeout)*time.Millisecond)
+}
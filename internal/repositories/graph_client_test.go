@@ -0,0 +1,197 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+// flakyServer fails with the given status until the number of failures is reached
+func flakyServer(failures int32, status int, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(calls, 1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+
+		w.Write([]byte(`{"data": {"user": {"id": "newid", "username": "ironman"}}}`))
+	}))
+}
+
+func resilientConfig(url string) domain.Config {
+	config := domain.DefaultConfig()
+	config.UserRepo.Url = url
+	config.UserRepo.RetryBackoff = 1
+	config.UserRepo.RetryMaxBackoff = 5
+	return config
+}
+
+func TestUserRepoRetries(t *testing.T) {
+	t.Run("Test queries are retried", func(t *testing.T) {
+		var calls int32
+		server := flakyServer(2, http.StatusServiceUnavailable, &calls)
+		defer server.Close()
+
+		config := resilientConfig(server.URL)
+		repo, _ := NewUserRepo(&config)
+
+		user, err := repo.GetById(context.Background(), "newid")
+
+		if err != nil || user.Id != "newid" {
+			t.Errorf("Expected user after retries got: %+v %v", user, err)
+		}
+
+		if calls != 3 {
+			t.Errorf("Expected %d calls got: %d", 3, calls)
+		}
+	})
+
+	t.Run("Test retries are limited", func(t *testing.T) {
+		var calls int32
+		server := flakyServer(10, http.StatusServiceUnavailable, &calls)
+		defer server.Close()
+
+		config := resilientConfig(server.URL)
+		config.UserRepo.Retries = 1
+		repo, _ := NewUserRepo(&config)
+
+		_, err := repo.GetById(context.Background(), "newid")
+
+		if !errors.Is(err, domain.ErrUnavailable) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrUnavailable, err)
+		}
+
+		if calls != 2 {
+			t.Errorf("Expected %d calls got: %d", 2, calls)
+		}
+	})
+
+	t.Run("Test mutations are not retried", func(t *testing.T) {
+		var calls int32
+		server := flakyServer(1, http.StatusServiceUnavailable, &calls)
+		defer server.Close()
+
+		config := resilientConfig(server.URL)
+		repo, _ := NewUserRepo(&config)
+
+		_, err := repo.Create(context.Background(), domain.Register{Username: "ironman"})
+
+		if !errors.Is(err, domain.ErrUnavailable) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrUnavailable, err)
+		}
+
+		if calls != 1 {
+			t.Errorf("Expected %d calls got: %d", 1, calls)
+		}
+	})
+
+	t.Run("Test client errors are not retried", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.Write([]byte(`{"data": null, "errors": [{"message": "not_found", "path": ["user"]}]}`))
+		}))
+		defer server.Close()
+
+		config := resilientConfig(server.URL)
+		repo, _ := NewUserRepo(&config)
+
+		_, err := repo.GetById(context.Background(), "newid")
+
+		if !errors.Is(err, domain.ErrNotFound) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrNotFound, err)
+		}
+
+		if calls != 1 {
+			t.Errorf("Expected %d calls got: %d", 1, calls)
+		}
+	})
+}
+
+func TestUserRepoCircuitBreaker(t *testing.T) {
+	var calls int32
+	server := flakyServer(3, http.StatusBadGateway, &calls)
+	defer server.Close()
+
+	config := resilientConfig(server.URL)
+	config.UserRepo.Retries = 0
+	config.UserRepo.BreakerThreshold = 3
+	repo, _ := NewUserRepo(&config)
+
+	now := time.Now()
+	repo.client.breaker.now = func() time.Time {
+		return now
+	}
+
+	for i := 0; i < 3; i++ {
+		repo.GetById(context.Background(), "newid")
+	}
+
+	t.Run("Test open circuit fails fast", func(t *testing.T) {
+		_, err := repo.GetById(context.Background(), "newid")
+
+		if err != ErrCircuitOpen || !errors.Is(err, domain.ErrUnavailable) {
+			t.Errorf("Expected error: %v got: %v", ErrCircuitOpen, err)
+		}
+
+		if calls != 3 {
+			t.Errorf("Expected the server to not be called got %d calls", calls)
+		}
+	})
+
+	t.Run("Test circuit closes after cooldown", func(t *testing.T) {
+		now = now.Add(time.Duration(config.UserRepo.BreakerCooldown) * time.Millisecond)
+
+		_, err := repo.GetById(context.Background(), "newid")
+
+		if err != nil {
+			t.Errorf("Expected user without error got: %v", err)
+		}
+
+		_, err = repo.GetById(context.Background(), "newid")
+
+		if err != nil || calls != 5 {
+			t.Errorf("Expected closed circuit got: %v after %d calls", err, calls)
+		}
+	})
+}
+
+func TestGraphHTTPClient(t *testing.T) {
+	config := domain.DefaultConfig()
+	config.UserRepo.Transport = domain.HTTPTransportConfig{
+		MaxIdleConns:          50,
+		MaxIdleConnsPerHost:   20,
+		MaxConnsPerHost:       30,
+		IdleConnTimeout:       1000,
+		TLSHandshakeTimeout:   2000,
+		ResponseHeaderTimeout: 3000,
+	}
+
+	client, err := newGraphHTTPClient(&config)
+
+	if err != nil {
+		t.Fatalf("Expected client without error got: %v", err)
+	}
+
+	transport := client.Transport.(*graphErrorTransport).base.(*http.Transport)
+
+	if transport.MaxIdleConns != 50 || transport.MaxIdleConnsPerHost != 20 || transport.MaxConnsPerHost != 30 {
+		t.Errorf("Expected connection limits to be set got: %d %d %d",
+			transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.MaxConnsPerHost)
+	}
+
+	if transport.IdleConnTimeout != time.Second || transport.TLSHandshakeTimeout != 2*time.Second || transport.ResponseHeaderTimeout != 3*time.Second {
+		t.Errorf("Expected timeouts to be set got: %v %v %v",
+			transport.IdleConnTimeout, transport.TLSHandshakeTimeout, transport.ResponseHeaderTimeout)
+	}
+
+	if transport == http.DefaultTransport {
+		t.Error("Expected the default transport to not be modified")
+	}
+}
@@ -0,0 +1,152 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+// GraphError is an error reported by the GraphQL server
+type GraphError struct {
+	Message string
+	// Path of the field that failed, list indexes are numbers
+	Path       []interface{}
+	Extensions map[string]interface{}
+}
+
+// Code returns the error code from the extensions, the message is used if the server doesn't send one
+func (e GraphError) Code() string {
+	if code, ok := e.Extensions["code"].(string); ok && code != "" {
+		return code
+	}
+
+	return e.Message
+}
+
+// GraphErrors is the "errors" array of a GraphQL response
+type GraphErrors []GraphError
+
+func (e GraphErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, graphError := range e {
+		path := make([]string, 0, len(graphError.Path))
+		for _, segment := range graphError.Path {
+			path = append(path, fmt.Sprint(segment))
+		}
+
+		messages = append(messages, fmt.Sprintf("%s (path: %s)", graphError.Message, strings.Join(path, ".")))
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// StatusError is returned when the GraphQL server answers with a non 200 status
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("graphQL server returned status %d: %s", e.StatusCode, e.Body)
+}
+
+const REQUEST_ID_HEADER = "X-REQUEST-ID"
+
+// graphErrorTransport decodes the GraphQL errors before the client does,
+// the client only keeps the error message and we need the extensions and paths
+type graphErrorTransport struct {
+	base http.RoundTripper
+}
+
+func (transport *graphErrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if requestId := domain.RequestId(req.Context()); requestId != "" {
+		// A RoundTripper must not modify the caller request
+		req = req.Clone(req.Context())
+		req.Header.Set(REQUEST_ID_HEADER, requestId)
+	}
+
+	resp, err := transport.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var out struct {
+		Errors GraphErrors `json:"errors"`
+	}
+
+	// Malformed responses are left to the GraphQL client
+	if json.Unmarshal(body, &out) == nil && len(out.Errors) > 0 {
+		return nil, out.Errors
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// translateError maps GraphQL and connection errors to domain errors
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var graphErrors GraphErrors
+	if errors.As(err, &graphErrors) {
+		switch strings.ToUpper(graphErrors[0].Code()) {
+		case "NOT_FOUND":
+			return fmt.Errorf("%w: %v", domain.ErrNotFound, graphErrors)
+		case "DUPLICATED_VALUE", "CONFLICT":
+			return fmt.Errorf("%w: %v", domain.ErrDuplicate, graphErrors)
+		case "UNAVAILABLE", "SERVICE_UNAVAILABLE":
+			return fmt.Errorf("%w: %v", domain.ErrUnavailable, graphErrors)
+		case "TIMEOUT":
+			return fmt.Errorf("%w: %v", domain.ErrTimeout, graphErrors)
+		}
+
+		return graphErrors
+	}
+
+	var statusError *StatusError
+	if errors.As(err, &statusError) {
+		switch {
+		case statusError.StatusCode == http.StatusGatewayTimeout:
+			return fmt.Errorf("%w: %v", domain.ErrTimeout, statusError)
+		case statusError.StatusCode >= 500 || statusError.StatusCode == http.StatusTooManyRequests:
+			return fmt.Errorf("%w: %v", domain.ErrUnavailable, statusError)
+		}
+
+		return statusError
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %v", domain.ErrTimeout, err)
+	}
+
+	var netError net.Error
+	if errors.As(err, &netError) {
+		if netError.Timeout() {
+			return fmt.Errorf("%w: %v", domain.ErrTimeout, err)
+		}
+
+		return fmt.Errorf("%w: %v", domain.ErrUnavailable, err)
+	}
+
+	return err
+}
@@ -0,0 +1,96 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"github.com/sy-software/minerva-spear-users/internal/core/ports"
+	"github.com/sy-software/minerva-spear-users/internal/metrics"
+)
+
+// InstrumentedUserRepo measures the calls to another ports.UserRepo
+// Implements ports.UserRepo interface
+type InstrumentedUserRepo struct {
+	repo    ports.UserRepo
+	latency *prometheus.HistogramVec
+}
+
+// NewInstrumentedUserRepo creates an instance of InstrumentedUserRepo,
+// latency is observed with the method and result labels
+func NewInstrumentedUserRepo(repo ports.UserRepo, latency *prometheus.HistogramVec) *InstrumentedUserRepo {
+	return &InstrumentedUserRepo{
+		repo:    repo,
+		latency: latency,
+	}
+}
+
+func (instrumented *InstrumentedUserRepo) Create(ctx context.Context, user domain.Register) (domain.User, error) {
+	start := time.Now()
+	created, err := instrumented.repo.Create(ctx, user)
+	instrumented.observe("Create", start, err)
+	return created, err
+}
+
+func (instrumented *InstrumentedUserRepo) GetById(ctx context.Context, id string) (domain.User, error) {
+	start := time.Now()
+	user, err := instrumented.repo.GetById(ctx, id)
+	instrumented.observe("GetById", start, err)
+	return user, err
+}
+
+func (instrumented *InstrumentedUserRepo) GetByUsername(ctx context.Context, username string) (domain.User, error) {
+	start := time.Now()
+	user, err := instrumented.repo.GetByUsername(ctx, username)
+	instrumented.observe("GetByUsername", start, err)
+	return user, err
+}
+
+func (instrumented *InstrumentedUserRepo) List(ctx context.Context, filter domain.UserFilter) (domain.UserPage, error) {
+	start := time.Now()
+	page, err := instrumented.repo.List(ctx, filter)
+	instrumented.observe("List", start, err)
+	return page, err
+}
+
+func (instrumented *InstrumentedUserRepo) Update(ctx context.Context, id string, update domain.UserUpdate) (domain.User, error) {
+	start := time.Now()
+	updated, err := instrumented.repo.Update(ctx, id, update)
+	instrumented.observe("Update", start, err)
+	return updated, err
+}
+
+func (instrumented *InstrumentedUserRepo) UpdateStatus(ctx context.Context, id string, status string) (domain.User, error) {
+	start := time.Now()
+	updated, err := instrumented.repo.UpdateStatus(ctx, id, status)
+	instrumented.observe("UpdateStatus", start, err)
+	return updated, err
+}
+
+func (instrumented *InstrumentedUserRepo) RevokeTokens(ctx context.Context, id string) (domain.User, error) {
+	start := time.Now()
+	updated, err := instrumented.repo.RevokeTokens(ctx, id)
+	instrumented.observe("RevokeTokens", start, err)
+	return updated, err
+}
+
+func (instrumented *InstrumentedUserRepo) Delete(ctx context.Context, id string) error {
+	start := time.Now()
+	err := instrumented.repo.Delete(ctx, id)
+	instrumented.observe("Delete", start, err)
+	return err
+}
+
+// Ping checks the measured repository, pings are not measured because health checks would skew the latency
+func (instrumented *InstrumentedUserRepo) Ping(ctx context.Context) error {
+	if pinger, ok := instrumented.repo.(ports.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+
+	return nil
+}
+
+func (instrumented *InstrumentedUserRepo) observe(method string, start time.Time, err error) {
+	instrumented.latency.WithLabelValues(method, metrics.Result(err)).Observe(time.Since(start).Seconds())
+}
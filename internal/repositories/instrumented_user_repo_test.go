@@ -0,0 +1,52 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"github.com/sy-software/minerva-spear-users/internal/metrics"
+)
+
+func TestInstrumentedUserRepo(t *testing.T) {
+	latency := metrics.New(domain.NewConfigSnapshot(domain.DefaultConfig())).UserRepoLatency
+	repo := NewInstrumentedUserRepo(NewMemoryUserRepo(), latency)
+	ctx := context.Background()
+
+	user, err := repo.Create(ctx, domain.Register{Username: "ironman", Provider: "StarkIndustries"})
+	if err != nil {
+		t.Fatalf("Expected user without error got: %v", err)
+	}
+
+	repo.GetById(ctx, user.Id)
+	repo.GetById(ctx, "missing")
+
+	if err := repo.Ping(ctx); err != nil {
+		t.Errorf("Expected ping without error got: %v", err)
+	}
+
+	// Pings are not measured
+	if series := testutil.CollectAndCount(latency); series != 3 {
+		t.Errorf("Expected 3 latency series got: %d", series)
+	}
+
+	cases := []struct {
+		name   string
+		method string
+		result string
+	}{
+		{name: "Test create", method: "Create", result: metrics.RESULT_SUCCESS},
+		{name: "Test found", method: "GetById", result: metrics.RESULT_SUCCESS},
+		{name: "Test not found", method: "GetById", result: metrics.RESULT_ERROR},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			// Only observed series exist
+			if !latency.DeleteLabelValues(testCase.method, testCase.result) {
+				t.Errorf("Expected latency of %s %s to be observed", testCase.method, testCase.result)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+// MemoryChallengeRepo keeps the used challenges in memory until they expire,
+// each instance only knows the challenges answered by itself
+// Implements ports.ChallengeRepo interface
+type MemoryChallengeRepo struct {
+	lock       sync.Mutex
+	challenges map[string]time.Time
+	now        func() time.Time
+}
+
+// NewMemoryChallengeRepo creates an empty instance of MemoryChallengeRepo
+func NewMemoryChallengeRepo() *MemoryChallengeRepo {
+	return &MemoryChallengeRepo{
+		challenges: map[string]time.Time{},
+		now:        time.Now,
+	}
+}
+
+func (repo *MemoryChallengeRepo) Use(ctx context.Context, challenge string, expire time.Time) error {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	now := repo.now()
+	for used, usedExpire := range repo.challenges {
+		if !now.Before(usedExpire) {
+			delete(repo.challenges, used)
+		}
+	}
+
+	if _, ok := repo.challenges[challenge]; ok {
+		return fmt.Errorf("%w: challenge", domain.ErrDuplicate)
+	}
+
+	repo.challenges[challenge] = expire
+	return nil
+}
@@ -0,0 +1,30 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+func TestMemoryChallengeRepo(t *testing.T) {
+	repo := NewMemoryChallengeRepo()
+	now := time.Now()
+	repo.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if err := repo.Use(ctx, "challenge", now.Add(time.Minute)); err != nil {
+		t.Fatalf("Expected the first use without error got: %v", err)
+	}
+
+	if err := repo.Use(ctx, "challenge", now.Add(time.Minute)); !errors.Is(err, domain.ErrDuplicate) {
+		t.Errorf("Expected duplicate error got: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := repo.Use(ctx, "challenge", now.Add(time.Minute)); err != nil {
+		t.Errorf("Expected expired challenges to be forgotten got: %v", err)
+	}
+}
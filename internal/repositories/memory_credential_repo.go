@@ -0,0 +1,88 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+// MemoryCredentialRepo keeps passkeys in memory, they are lost when the process stops
+// Implements ports.CredentialRepo interface
+type MemoryCredentialRepo struct {
+	lock        sync.RWMutex
+	credentials map[string]domain.Credential
+}
+
+// NewMemoryCredentialRepo creates an empty instance of MemoryCredentialRepo
+func NewMemoryCredentialRepo() *MemoryCredentialRepo {
+	return &MemoryCredentialRepo{
+		credentials: map[string]domain.Credential{},
+	}
+}
+
+func (repo *MemoryCredentialRepo) Create(ctx context.Context, credential domain.Credential) (domain.Credential, error) {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	if _, ok := repo.credentials[credential.Id]; ok {
+		return domain.Credential{}, fmt.Errorf("%w: credential", domain.ErrDuplicate)
+	}
+
+	repo.credentials[credential.Id] = credential
+	return credential, nil
+}
+
+func (repo *MemoryCredentialRepo) GetById(ctx context.Context, id string) (domain.Credential, error) {
+	repo.lock.RLock()
+	defer repo.lock.RUnlock()
+
+	credential, ok := repo.credentials[id]
+	if !ok {
+		return domain.Credential{}, fmt.Errorf("%w: credential", domain.ErrNotFound)
+	}
+
+	return credential, nil
+}
+
+func (repo *MemoryCredentialRepo) GetByUser(ctx context.Context, userId string) ([]domain.Credential, error) {
+	repo.lock.RLock()
+	defer repo.lock.RUnlock()
+
+	credentials := []domain.Credential{}
+	for _, credential := range repo.credentials {
+		if credential.UserId == userId {
+			credentials = append(credentials, credential)
+		}
+	}
+
+	return credentials, nil
+}
+
+func (repo *MemoryCredentialRepo) UpdateSignCount(ctx context.Context, id string, signCount uint32) error {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	credential, ok := repo.credentials[id]
+	if !ok {
+		return fmt.Errorf("%w: credential", domain.ErrNotFound)
+	}
+
+	credential.SignCount = signCount
+	repo.credentials[id] = credential
+	return nil
+}
+
+func (repo *MemoryCredentialRepo) DeleteByUser(ctx context.Context, userId string) error {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	for id, credential := range repo.credentials {
+		if credential.UserId == userId {
+			delete(repo.credentials, id)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+// MemoryUserRepo keeps users in memory, they are lost when the process stops
+// Implements ports.UserRepo interface
+type MemoryUserRepo struct {
+	lock  sync.RWMutex
+	users map[string]domain.User
+	// User IDs in creation order, used to list users
+	order []string
+}
+
+// NewMemoryUserRepo creates an empty instance of MemoryUserRepo
+func NewMemoryUserRepo() *MemoryUserRepo {
+	return &MemoryUserRepo{
+		users: map[string]domain.User{},
+	}
+}
+
+// Ping always succeeds, the users are in the process memory
+func (repo *MemoryUserRepo) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (repo *MemoryUserRepo) Create(ctx context.Context, user domain.Register) (domain.User, error) {
+	id, err := newId()
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	if _, ok := repo.findUsername(user.Username); ok {
+		return domain.User{}, fmt.Errorf("%w: username", domain.ErrDuplicate)
+	}
+
+	created := domain.User{
+		Id:       id,
+		Username: user.Username,
+		Name:     user.Name,
+		Picture:  user.Picture,
+		Role:     user.Role,
+		Provider: user.Provider,
+		Status:   domain.UserActive,
+	}
+
+	repo.users[id] = created
+	repo.order = append(repo.order, id)
+	return created, nil
+}
+
+func (repo *MemoryUserRepo) GetById(ctx context.Context, id string) (domain.User, error) {
+	repo.lock.RLock()
+	defer repo.lock.RUnlock()
+
+	user, ok := repo.users[id]
+	if !ok {
+		return domain.User{}, fmt.Errorf("%w: user", domain.ErrNotFound)
+	}
+
+	return user, nil
+}
+
+func (repo *MemoryUserRepo) GetByUsername(ctx context.Context, username string) (domain.User, error) {
+	repo.lock.RLock()
+	defer repo.lock.RUnlock()
+
+	user, ok := repo.findUsername(username)
+	if !ok {
+		return domain.User{}, fmt.Errorf("%w: user", domain.ErrNotFound)
+	}
+
+	return user, nil
+}
+
+func (repo *MemoryUserRepo) List(ctx context.Context, filter domain.UserFilter) (domain.UserPage, error) {
+	repo.lock.RLock()
+	defer repo.lock.RUnlock()
+
+	matches := []domain.User{}
+	for _, id := range repo.order {
+		user := repo.users[id]
+		if filter.Provider != "" && user.Provider != filter.Provider ||
+			filter.Status != "" && user.Status != filter.Status ||
+			filter.Role != "" && user.Role != filter.Role {
+			continue
+		}
+
+		matches = append(matches, user)
+	}
+
+	start := (filter.Page - 1) * filter.PageSize
+	if start < 0 {
+		start = 0
+	}
+
+	if start > len(matches) {
+		start = len(matches)
+	}
+
+	end := start + filter.PageSize
+	if end > len(matches) {
+		end = len(matches)
+	}
+
+	return domain.UserPage{
+		Items:    matches[start:end],
+		Page:     filter.Page,
+		PageSize: filter.PageSize,
+		Total:    len(matches),
+	}, nil
+}
+
+func (repo *MemoryUserRepo) Update(ctx context.Context, id string, update domain.UserUpdate) (domain.User, error) {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	user, ok := repo.users[id]
+	if !ok {
+		return domain.User{}, fmt.Errorf("%w: user", domain.ErrNotFound)
+	}
+
+	if update.Username != nil {
+		if owner, ok := repo.findUsername(*update.Username); ok && owner.Id != id {
+			return domain.User{}, fmt.Errorf("%w: username", domain.ErrDuplicate)
+		}
+
+		user.Username = *update.Username
+	}
+
+	if update.Name != nil {
+		user.Name = *update.Name
+	}
+
+	if update.Picture != nil {
+		user.Picture = *update.Picture
+	}
+
+	if update.Role != nil {
+		user.Role = *update.Role
+	}
+
+	repo.users[id] = user
+	return user, nil
+}
+
+func (repo *MemoryUserRepo) UpdateStatus(ctx context.Context, id string, status string) (domain.User, error) {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	user, ok := repo.users[id]
+	if !ok {
+		return domain.User{}, fmt.Errorf("%w: user", domain.ErrNotFound)
+	}
+
+	user.Status = status
+	repo.users[id] = user
+	return user, nil
+}
+
+func (repo *MemoryUserRepo) RevokeTokens(ctx context.Context, id string) (domain.User, error) {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	user, ok := repo.users[id]
+	if !ok {
+		return domain.User{}, fmt.Errorf("%w: user", domain.ErrNotFound)
+	}
+
+	user.TokenVersion++
+	repo.users[id] = user
+	return user, nil
+}
+
+func (repo *MemoryUserRepo) Delete(ctx context.Context, id string) error {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	if _, ok := repo.users[id]; !ok {
+		return fmt.Errorf("%w: user", domain.ErrNotFound)
+	}
+
+	delete(repo.users, id)
+	for i, userId := range repo.order {
+		if userId == id {
+			repo.order = append(repo.order[:i], repo.order[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+// findUsername must be called holding the lock
+func (repo *MemoryUserRepo) findUsername(username string) (domain.User, bool) {
+	for _, user := range repo.users {
+		if user.Username == username {
+			return user, true
+		}
+	}
+
+	return domain.User{}, false
+}
@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+func TestMemoryUserRepoConcurrentCreate(t *testing.T) {
+	repo := NewMemoryUserRepo()
+
+	var lock sync.Mutex
+	created, duplicated := 0, 0
+
+	var wait sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			_, err := repo.Create(context.Background(), domain.Register{Username: "ironman"})
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err == nil {
+				created++
+			} else if errors.Is(err, domain.ErrDuplicate) {
+				duplicated++
+			}
+		}()
+	}
+
+	wait.Wait()
+
+	if created != 1 || duplicated != 19 {
+		t.Errorf("Expected 1 user and 19 duplicates got: %d users and %d duplicates", created, duplicated)
+	}
+}
+
+func TestMemoryCredentialRepo(t *testing.T) {
+	repo := NewMemoryCredentialRepo()
+	ctx := context.Background()
+
+	repo.Create(ctx, domain.Credential{Id: "credential", UserId: "newid", SignCount: 1})
+
+	t.Run("Test duplicated credential", func(t *testing.T) {
+		_, err := repo.Create(ctx, domain.Credential{Id: "credential", UserId: "otherid"})
+
+		if !errors.Is(err, domain.ErrDuplicate) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrDuplicate, err)
+		}
+	})
+
+	t.Run("Test update sign count", func(t *testing.T) {
+		repo.UpdateSignCount(ctx, "credential", 5)
+		credentials, err := repo.GetByUser(ctx, "newid")
+
+		if err != nil || len(credentials) != 1 || credentials[0].SignCount != 5 {
+			t.Errorf("Expected updated credential got: %+v %v", credentials, err)
+		}
+	})
+
+	t.Run("Test not found", func(t *testing.T) {
+		if _, err := repo.GetById(ctx, "unknown"); !errors.Is(err, domain.ErrNotFound) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrNotFound, err)
+		}
+
+		if err := repo.UpdateSignCount(ctx, "unknown", 1); !errors.Is(err, domain.ErrNotFound) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrNotFound, err)
+		}
+	})
+
+	t.Run("Test delete by user", func(t *testing.T) {
+		repo.Create(ctx, domain.Credential{Id: "other", UserId: "otherid"})
+
+		if err := repo.DeleteByUser(ctx, "newid"); err != nil {
+			t.Errorf("Expected delete without error got: %v", err)
+		}
+
+		if credentials, _ := repo.GetByUser(ctx, "newid"); len(credentials) != 0 {
+			t.Errorf("Expected no credentials got: %+v", credentials)
+		}
+
+		if _, err := repo.GetById(ctx, "other"); err != nil {
+			t.Errorf("Expected credentials of other users to be kept got: %v", err)
+		}
+	})
+}
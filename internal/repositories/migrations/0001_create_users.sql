@@ -0,0 +1,14 @@
+CREATE TABLE users (
+    id TEXT PRIMARY KEY,
+    username TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL DEFAULT '',
+    picture TEXT NOT NULL DEFAULT '',
+    role TEXT NOT NULL DEFAULT '',
+    provider TEXT NOT NULL DEFAULT '',
+    token_id TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'active',
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX users_provider ON users (provider);
+CREATE INDEX users_status ON users (status);
@@ -0,0 +1,6 @@
+CREATE TABLE challenges (
+    challenge TEXT PRIMARY KEY,
+    expires_at BIGINT NOT NULL
+);
+
+CREATE INDEX challenges_expires_at ON challenges (expires_at);
@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+// SQLChallengeRepo keeps the used challenges in the database of a SQLUserRepo until they expire,
+// every instance sharing the database rejects them. The challenges table is created by its migrations
+// Implements ports.ChallengeRepo interface
+type SQLChallengeRepo struct {
+	config *domain.Config
+	db     *sql.DB
+	driver string
+	now    func() time.Time
+}
+
+// NewSQLChallengeRepo creates an instance of SQLChallengeRepo sharing the connections of users
+func NewSQLChallengeRepo(users *SQLUserRepo) *SQLChallengeRepo {
+	return &SQLChallengeRepo{
+		config: users.config,
+		db:     users.db,
+		driver: users.driver,
+		now:    time.Now,
+	}
+}
+
+func (repo *SQLChallengeRepo) Use(ctx context.Context, challenge string, expire time.Time) error {
+	ctx, cancel := callContext(ctx, repo.config)
+	defer cancel()
+
+	// Expiration times are stored as unix seconds, they compare the same way in every database
+	_, err := repo.db.ExecContext(ctx, rebind(repo.driver, "DELETE FROM challenges WHERE expires_at <= ?"), repo.now().Unix())
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo Use Error")
+		return translateSQLError(err)
+	}
+
+	_, err = repo.db.ExecContext(ctx, rebind(repo.driver, "INSERT INTO challenges (challenge, expires_at) VALUES (?, ?)"), challenge, expire.Unix())
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo Use Error")
+		err = translateSQLError(err)
+	}
+
+	if errors.Is(err, domain.ErrDuplicate) {
+		return fmt.Errorf("%w: challenge", domain.ErrDuplicate)
+	}
+
+	return err
+}
@@ -0,0 +1,158 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+const credentialColumns = "id, user_id, public_key, sign_count, transports, created_at"
+
+// SQLCredentialRepo stores passkeys in the database of a SQLUserRepo,
+// the credentials table is created by its migrations
+// Implements ports.CredentialRepo interface
+type SQLCredentialRepo struct {
+	config *domain.Config
+	db     *sql.DB
+	driver string
+}
+
+// NewSQLCredentialRepo creates an instance of SQLCredentialRepo sharing the connections of users
+func NewSQLCredentialRepo(users *SQLUserRepo) *SQLCredentialRepo {
+	return &SQLCredentialRepo{
+		config: users.config,
+		db:     users.db,
+		driver: users.driver,
+	}
+}
+
+func (repo *SQLCredentialRepo) Create(ctx context.Context, credential domain.Credential) (domain.Credential, error) {
+	ctx, cancel := callContext(ctx, repo.config)
+	defer cancel()
+
+	if credential.CreatedAt.IsZero() {
+		credential.CreatedAt = time.Now()
+	}
+
+	credential.CreatedAt = credential.CreatedAt.UTC()
+	_, err := repo.db.ExecContext(ctx, rebind(repo.driver,
+		"INSERT INTO credentials ("+credentialColumns+") VALUES (?, ?, ?, ?, ?, ?)"),
+		credential.Id,
+		credential.UserId,
+		base64.StdEncoding.EncodeToString(credential.PublicKey),
+		int64(credential.SignCount),
+		// Transports are tokens like usb or internal, they don't have commas
+		strings.Join(credential.Transports, ","),
+		credential.CreatedAt,
+	)
+
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo Create Error")
+		return domain.Credential{}, translateSQLError(err)
+	}
+
+	return credential, nil
+}
+
+func (repo *SQLCredentialRepo) GetById(ctx context.Context, id string) (domain.Credential, error) {
+	ctx, cancel := callContext(ctx, repo.config)
+	defer cancel()
+
+	row := repo.db.QueryRowContext(ctx, rebind(repo.driver, "SELECT "+credentialColumns+" FROM credentials WHERE id = ?"), id)
+	credential, err := scanCredential(row)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo GetById Error")
+		return domain.Credential{}, translateSQLError(err)
+	}
+
+	return credential, nil
+}
+
+func (repo *SQLCredentialRepo) GetByUser(ctx context.Context, userId string) ([]domain.Credential, error) {
+	ctx, cancel := callContext(ctx, repo.config)
+	defer cancel()
+
+	rows, err := repo.db.QueryContext(
+		ctx,
+		rebind(repo.driver, "SELECT "+credentialColumns+" FROM credentials WHERE user_id = ? ORDER BY created_at, id"),
+		userId,
+	)
+
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo GetByUser Error")
+		return nil, translateSQLError(err)
+	}
+
+	defer rows.Close()
+
+	credentials := []domain.Credential{}
+	for rows.Next() {
+		credential, err := scanCredential(rows)
+		if err != nil {
+			return nil, translateSQLError(err)
+		}
+
+		credentials = append(credentials, credential)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, translateSQLError(err)
+	}
+
+	return credentials, nil
+}
+
+func (repo *SQLCredentialRepo) UpdateSignCount(ctx context.Context, id string, signCount uint32) error {
+	ctx, cancel := callContext(ctx, repo.config)
+	defer cancel()
+
+	result, err := repo.db.ExecContext(ctx, rebind(repo.driver, "UPDATE credentials SET sign_count = ? WHERE id = ?"), int64(signCount), id)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo UpdateSignCount Error")
+		return translateSQLError(err)
+	}
+
+	return notFoundIfNone(result, "credential")
+}
+
+func (repo *SQLCredentialRepo) DeleteByUser(ctx context.Context, userId string) error {
+	ctx, cancel := callContext(ctx, repo.config)
+	defer cancel()
+
+	_, err := repo.db.ExecContext(ctx, rebind(repo.driver, "DELETE FROM credentials WHERE user_id = ?"), userId)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo DeleteByUser Error")
+		return translateSQLError(err)
+	}
+
+	return nil
+}
+
+func scanCredential(row scanner) (domain.Credential, error) {
+	var credential domain.Credential
+	var publicKey, transports string
+	var signCount int64
+
+	err := row.Scan(&credential.Id, &credential.UserId, &publicKey, &signCount, &transports, &credential.CreatedAt)
+	if err != nil {
+		return domain.Credential{}, err
+	}
+
+	credential.PublicKey, err = base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return domain.Credential{}, err
+	}
+
+	credential.SignCount = uint32(signCount)
+	credential.Transports = []string{}
+	if transports != "" {
+		credential.Transports = strings.Split(transports, ",")
+	}
+
+	return credential, nil
+}
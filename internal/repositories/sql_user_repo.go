@@ -0,0 +1,479 @@
+package repositories
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"modernc.org/sqlite"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+const userColumns = "id, username, name, picture, role, provider, status, token_version"
+
+// Postgres advisory lock held while the migrations are applied
+const MIGRATIONS_LOCK_ID = 5372656172
+
+// SQLUserRepo stores users in a SQL database, SQLite and Postgres are supported
+// Implements ports.UserRepo interface
+type SQLUserRepo struct {
+	config *domain.Config
+	db     *sql.DB
+	driver string
+}
+
+// NewSQLUserRepo opens the database configured in UserRepo.DSN and applies the pending migrations
+func NewSQLUserRepo(config *domain.Config) (*SQLUserRepo, error) {
+	driver := config.UserRepo.Driver
+	if driver != domain.UserRepoSQLite && driver != domain.UserRepoPostgres {
+		return nil, fmt.Errorf("unsupported sql driver: %q", driver)
+	}
+
+	db, err := sql.Open(driver, config.UserRepo.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	if driver == domain.UserRepoSQLite {
+		// SQLite allows a single writer, sharing one connection avoids "database is locked" errors
+		db.SetMaxOpenConns(1)
+	}
+
+	repo := &SQLUserRepo{
+		config: config,
+		db:     db,
+		driver: driver,
+	}
+
+	if err := repo.migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// Ping checks the database connection
+func (repo *SQLUserRepo) Ping(ctx context.Context) error {
+	return repo.db.PingContext(ctx)
+}
+
+// Close releases the database connections
+func (repo *SQLUserRepo) Close() error {
+	return repo.db.Close()
+}
+
+func (repo *SQLUserRepo) Create(ctx context.Context, user domain.Register) (domain.User, error) {
+	ctx, cancel := callContext(ctx, repo.config)
+	defer cancel()
+
+	id, err := newId()
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	_, err = repo.db.ExecContext(ctx, rebind(repo.driver,
+		"INSERT INTO users (id, username, name, picture, role, provider, token_id, status, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+		id, user.Username, user.Name, user.Picture, user.Role, user.Provider, user.TokenID, domain.UserActive, time.Now().UTC(),
+	)
+
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo Create Error")
+		return domain.User{}, translateSQLError(err)
+	}
+
+	return domain.User{
+		Id:       id,
+		Username: user.Username,
+		Name:     user.Name,
+		Picture:  user.Picture,
+		Role:     user.Role,
+		Provider: user.Provider,
+		Status:   domain.UserActive,
+	}, nil
+}
+
+func (repo *SQLUserRepo) GetById(ctx context.Context, id string) (domain.User, error) {
+	return repo.getBy(ctx, "id", id)
+}
+
+func (repo *SQLUserRepo) GetByUsername(ctx context.Context, username string) (domain.User, error) {
+	return repo.getBy(ctx, "username", username)
+}
+
+func (repo *SQLUserRepo) List(ctx context.Context, filter domain.UserFilter) (domain.UserPage, error) {
+	ctx, cancel := callContext(ctx, repo.config)
+	defer cancel()
+
+	conditions := []string{}
+	args := []interface{}{}
+	where := func(column string, value string) {
+		if value != "" {
+			conditions = append(conditions, column+" = ?")
+			args = append(args, value)
+		}
+	}
+
+	where("provider", filter.Provider)
+	where("status", filter.Status)
+	where("role", filter.Role)
+
+	clause := ""
+	if len(conditions) > 0 {
+		clause = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	err := repo.db.QueryRowContext(ctx, rebind(repo.driver, "SELECT COUNT(*) FROM users"+clause), args...).Scan(&total)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo List Error")
+		return domain.UserPage{}, translateSQLError(err)
+	}
+
+	offset := (filter.Page - 1) * filter.PageSize
+	if offset < 0 {
+		offset = 0
+	}
+
+	rows, err := repo.db.QueryContext(
+		ctx,
+		rebind(repo.driver, "SELECT "+userColumns+" FROM users"+clause+" ORDER BY created_at, id LIMIT ? OFFSET ?"),
+		append(args, filter.PageSize, offset)...,
+	)
+
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo List Error")
+		return domain.UserPage{}, translateSQLError(err)
+	}
+
+	defer rows.Close()
+
+	users := []domain.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return domain.UserPage{}, translateSQLError(err)
+		}
+
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return domain.UserPage{}, translateSQLError(err)
+	}
+
+	return domain.UserPage{
+		Items:    users,
+		Page:     filter.Page,
+		PageSize: filter.PageSize,
+		Total:    total,
+	}, nil
+}
+
+func (repo *SQLUserRepo) Update(ctx context.Context, id string, update domain.UserUpdate) (domain.User, error) {
+	columns := map[string]*string{
+		"username": update.Username,
+		"name":     update.Name,
+		"picture":  update.Picture,
+		"role":     update.Role,
+	}
+
+	return repo.update(ctx, id, columns)
+}
+
+func (repo *SQLUserRepo) UpdateStatus(ctx context.Context, id string, status string) (domain.User, error) {
+	return repo.update(ctx, id, map[string]*string{"status": &status})
+}
+
+func (repo *SQLUserRepo) RevokeTokens(ctx context.Context, id string) (domain.User, error) {
+	ctx, cancel := callContext(ctx, repo.config)
+	defer cancel()
+
+	result, err := repo.db.ExecContext(ctx, rebind(repo.driver, "UPDATE users SET token_version = token_version + 1 WHERE id = ?"), id)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo RevokeTokens Error")
+		return domain.User{}, translateSQLError(err)
+	}
+
+	if err := notFoundIfNone(result, "user"); err != nil {
+		return domain.User{}, err
+	}
+
+	return repo.GetById(ctx, id)
+}
+
+func (repo *SQLUserRepo) Delete(ctx context.Context, id string) error {
+	ctx, cancel := callContext(ctx, repo.config)
+	defer cancel()
+
+	result, err := repo.db.ExecContext(ctx, rebind(repo.driver, "DELETE FROM users WHERE id = ?"), id)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo Delete Error")
+		return translateSQLError(err)
+	}
+
+	return notFoundIfNone(result, "user")
+}
+
+func (repo *SQLUserRepo) getBy(ctx context.Context, column string, value string) (domain.User, error) {
+	ctx, cancel := callContext(ctx, repo.config)
+	defer cancel()
+
+	row := repo.db.QueryRowContext(ctx, rebind(repo.driver, "SELECT "+userColumns+" FROM users WHERE "+column+" = ?"), value)
+	user, err := scanUser(row)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo GetBy %s Error", column)
+		return domain.User{}, translateSQLError(err)
+	}
+
+	return user, nil
+}
+
+// update changes the columns with a value and returns the updated user
+func (repo *SQLUserRepo) update(ctx context.Context, id string, columns map[string]*string) (domain.User, error) {
+	names := make([]string, 0, len(columns))
+	for name, value := range columns {
+		if value != nil {
+			names = append(names, name)
+		}
+	}
+
+	// Stable statements are easier to read in the database logs
+	sort.Strings(names)
+
+	if len(names) > 0 {
+		assignments := make([]string, 0, len(names))
+		args := make([]interface{}, 0, len(names)+1)
+		for _, name := range names {
+			assignments = append(assignments, name+" = ?")
+			args = append(args, *columns[name])
+		}
+
+		callCtx, cancel := callContext(ctx, repo.config)
+		defer cancel()
+
+		result, err := repo.db.ExecContext(
+			callCtx,
+			rebind(repo.driver, "UPDATE users SET "+strings.Join(assignments, ", ")+" WHERE id = ?"),
+			append(args, id)...,
+		)
+
+		if err != nil {
+			log.Debug().Err(err).Msgf("Repo Update Error")
+			return domain.User{}, translateSQLError(err)
+		}
+
+		if err := notFoundIfNone(result, "user"); err != nil {
+			return domain.User{}, err
+		}
+	}
+
+	return repo.GetById(ctx, id)
+}
+
+// migrate applies the embedded migrations that are not recorded in schema_migrations
+func (repo *SQLUserRepo) migrate(ctx context.Context) error {
+	if repo.driver == domain.UserRepoPostgres {
+		unlock, err := repo.lockMigrations(ctx)
+		if err != nil {
+			return err
+		}
+
+		defer unlock()
+	}
+
+	_, err := repo.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version TEXT PRIMARY KEY)")
+	if err != nil {
+		return fmt.Errorf("can't create migrations table: %w", err)
+	}
+
+	files, err := migrations.ReadDir("migrations")
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		version := strings.TrimSuffix(file.Name(), ".sql")
+
+		var applied int
+		err := repo.db.QueryRowContext(ctx, rebind(repo.driver, "SELECT COUNT(*) FROM schema_migrations WHERE version = ?"), version).Scan(&applied)
+		if err != nil {
+			return fmt.Errorf("can't read migrations: %w", err)
+		}
+
+		if applied > 0 {
+			continue
+		}
+
+		script, err := migrations.ReadFile("migrations/" + file.Name())
+		if err != nil {
+			return err
+		}
+
+		tx, err := repo.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		for _, statement := range strings.Split(string(script), ";") {
+			if strings.TrimSpace(statement) == "" {
+				continue
+			}
+
+			if _, err := tx.ExecContext(ctx, statement); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %s failed: %w", version, err)
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, rebind(repo.driver, "INSERT INTO schema_migrations (version) VALUES (?)"), version); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		log.Info().Str("version", version).Msg("Migration applied")
+	}
+
+	return nil
+}
+
+// lockMigrations takes the Postgres advisory lock MIGRATIONS_LOCK_ID so instances starting at
+// the same time apply the migrations one at a time, the returned function releases it
+func (repo *SQLUserRepo) lockMigrations(ctx context.Context) (func(), error) {
+	// Advisory locks belong to the session, the same connection must release it
+	conn, err := repo.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can't lock migrations: %w", err)
+	}
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", MIGRATIONS_LOCK_ID); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("can't lock migrations: %w", err)
+	}
+
+	return func() {
+		_, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", MIGRATIONS_LOCK_ID)
+		if err != nil {
+			log.Warn().Err(err).Msg("Migrations lock can't be released, closing its connection")
+			// Discarding the connection ends the session and releases the lock
+			conn.Raw(func(driverConn interface{}) error { return driver.ErrBadConn })
+		}
+
+		conn.Close()
+	}, nil
+}
+
+// rebind changes the ? placeholders to $N for postgres
+func rebind(driver string, query string) string {
+	if driver != domain.UserRepoPostgres {
+		return query
+	}
+
+	var rebound strings.Builder
+	position := 0
+	for _, char := range query {
+		if char == '?' {
+			position++
+			rebound.WriteString("$" + strconv.Itoa(position))
+			continue
+		}
+
+		rebound.WriteRune(char)
+	}
+
+	return rebound.String()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row scanner) (domain.User, error) {
+	var user domain.User
+	err := row.Scan(&user.Id, &user.Username, &user.Name, &user.Picture, &user.Role, &user.Provider, &user.Status, &user.TokenVersion)
+	return user, err
+}
+
+// notFoundIfNone returns domain.ErrNotFound when a statement didn't change any row of entity
+func notFoundIfNone(result sql.Result, entity string) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("%w: %s", domain.ErrNotFound, entity)
+	}
+
+	return nil
+}
+
+// newId creates a random ID, 128 bits hex encoded
+func newId() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+// translateSQLError maps database errors to domain errors
+func translateSQLError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %v", domain.ErrNotFound, err)
+	}
+
+	var pqError *pq.Error
+	if errors.As(err, &pqError) && pqError.Code == "23505" {
+		return fmt.Errorf("%w: %v", domain.ErrDuplicate, err)
+	}
+
+	var sqliteError *sqlite.Error
+	if errors.As(err, &sqliteError) && strings.Contains(sqliteError.Error(), "UNIQUE constraint failed") {
+		return fmt.Errorf("%w: %v", domain.ErrDuplicate, err)
+	}
+
+	// Connection exceptions and server shutdowns
+	if errors.As(err, &pqError) && (pqError.Code.Class() == "08" || strings.HasPrefix(string(pqError.Code), "57P")) {
+		return fmt.Errorf("%w: %v", domain.ErrUnavailable, err)
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %v", domain.ErrTimeout, err)
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return fmt.Errorf("%w: %v", domain.ErrUnavailable, err)
+	}
+
+	var netError net.Error
+	if errors.As(err, &netError) {
+		if netError.Timeout() {
+			return fmt.Errorf("%w: %v", domain.ErrTimeout, err)
+		}
+
+		return fmt.Errorf("%w: %v", domain.ErrUnavailable, err)
+	}
+
+	return err
+}
@@ -0,0 +1,139 @@
+package repositories
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+func TestTranslateSQLError(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{name: "Test no rows", err: sql.ErrNoRows, expected: domain.ErrNotFound},
+		{name: "Test unique violation", err: &pq.Error{Code: "23505"}, expected: domain.ErrDuplicate},
+		{name: "Test bad connection", err: driver.ErrBadConn, expected: domain.ErrUnavailable},
+		{name: "Test connection done", err: sql.ErrConnDone, expected: domain.ErrUnavailable},
+		{name: "Test connection refused", err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, expected: domain.ErrUnavailable},
+		{name: "Test connection exception", err: &pq.Error{Code: "08006"}, expected: domain.ErrUnavailable},
+		{name: "Test server shutdown", err: &pq.Error{Code: "57P01"}, expected: domain.ErrUnavailable},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if err := translateSQLError(testCase.err); !errors.Is(err, testCase.expected) {
+				t.Errorf("Expected error: %v got: %v", testCase.expected, err)
+			}
+		})
+	}
+
+	t.Run("Test other errors", func(t *testing.T) {
+		original := &pq.Error{Code: "42601"}
+		if err := translateSQLError(original); err != original {
+			t.Errorf("Expected the original error got: %v", err)
+		}
+	})
+}
+
+func TestRebind(t *testing.T) {
+	query := "UPDATE users SET name = ?, role = ? WHERE id = ?"
+
+	cases := []struct {
+		name     string
+		driver   string
+		expected string
+	}{
+		{name: "Test postgres", driver: domain.UserRepoPostgres, expected: "UPDATE users SET name = $1, role = $2 WHERE id = $3"},
+		{name: "Test sqlite", driver: domain.UserRepoSQLite, expected: query},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if rebound := rebind(testCase.driver, query); rebound != testCase.expected {
+				t.Errorf("Expected query: %q got: %q", testCase.expected, rebound)
+			}
+		})
+	}
+
+	t.Run("Test without placeholders", func(t *testing.T) {
+		if rebound := rebind(domain.UserRepoPostgres, "SELECT COUNT(*) FROM users"); rebound != "SELECT COUNT(*) FROM users" {
+			t.Errorf("Expected query to be unchanged got: %q", rebound)
+		}
+	})
+}
+
+func TestPostgresConcurrentMigrate(t *testing.T) {
+	dsn := os.Getenv(POSTGRES_DSN_VAR)
+	if dsn == "" {
+		t.Skipf("%s is not set", POSTGRES_DSN_VAR)
+	}
+
+	db, err := sql.Open(domain.UserRepoPostgres, dsn)
+	if err != nil {
+		t.Fatalf("Can't open database: %v", err)
+	}
+
+	defer db.Close()
+	// Advisory locks belong to the session, the lock check must use a single connection
+	db.SetMaxOpenConns(1)
+
+	// Every instance starts from an empty database
+	for _, table := range []string{"challenges", "credentials", "users", "schema_migrations"} {
+		if _, err := db.Exec("DROP TABLE IF EXISTS " + table); err != nil {
+			t.Fatalf("Can't drop table %s: %v", table, err)
+		}
+	}
+
+	config := domain.DefaultConfig()
+	config.UserRepo.Driver = domain.UserRepoPostgres
+	config.UserRepo.DSN = dsn
+
+	const instances = 4
+	var wait sync.WaitGroup
+	errs := make(chan error, instances)
+	for i := 0; i < instances; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+
+			repo, err := NewSQLUserRepo(&config)
+			if err == nil {
+				repo.Close()
+			}
+
+			errs <- err
+		}()
+	}
+
+	wait.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Expected migrations without error got: %v", err)
+		}
+	}
+
+	files, _ := migrations.ReadDir("migrations")
+	var applied int
+	if err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&applied); err != nil || applied != len(files) {
+		t.Errorf("Expected %d migrations to be applied once got: %d %v", len(files), applied, err)
+	}
+
+	var locked bool
+	if err := db.QueryRow("SELECT pg_try_advisory_lock($1)", MIGRATIONS_LOCK_ID).Scan(&locked); err != nil || !locked {
+		t.Errorf("Expected migrations lock to be released got: %v %v", locked, err)
+	}
+
+	db.Exec("SELECT pg_advisory_unlock($1)", MIGRATIONS_LOCK_ID)
+}
@@ -8,37 +8,45 @@ import (
 	"github.com/sy-software/minerva-spear-users/internal/core/domain"
 )
 
-type GraphError struct {
-	Message string
-	Path    []string
+type graphUser struct {
+	Id           graphql.String
+	Name         graphql.String
+	Username     graphql.String
+	Picture      graphql.String
+	Role         graphql.String
+	Provider     graphql.String
+	Status       graphql.String
+	TokenVersion graphql.Int
 }
 
 // UserRepo connects to minerva owl GraphQL server to manage users
 // Implements ports.UserRepo interface
 type UserRepo struct {
 	config *domain.Config
-	client *graphql.Client
+	client *graphClient
 }
 
 // NewUserRepo creates an instance of UserRepo
-func NewUserRepo(config *domain.Config) *UserRepo {
-	client := graphql.NewClient(config.UserRepo.Url, nil)
+func NewUserRepo(config *domain.Config) (*UserRepo, error) {
+	client, err := newGraphClient(config)
+	if err != nil {
+		return nil, err
+	}
+
 	return &UserRepo{
 		config: config,
 		client: client,
-	}
+	}, nil
 }
 
-// TODO: Handle repository connection errors, currently they will generate internal server error
+// Ping checks the GraphQL server answers queries
+func (repo *UserRepo) Ping(ctx context.Context) error {
+	return repo.client.ping(ctx)
+}
 
-func (repo *UserRepo) Create(user domain.Register) (domain.User, error) {
+func (repo *UserRepo) Create(ctx context.Context, user domain.Register) (domain.User, error) {
 	var m struct {
-		CreateUser struct {
-			Id       graphql.String
-			Name     graphql.String
-			Username graphql.String
-			Picture  graphql.String
-		} `graphql:"createUser(input:{name: $name, username: $username, role: $role, tokenID: $tokenID, provider: $provider, picture: $picture, status: \"active\"})"`
+		CreateUser graphUser `graphql:"createUser(input:{name: $name, username: $username, role: $role, tokenID: $tokenID, provider: $provider, picture: $picture, status: \"active\"})"`
 	}
 
 	vars := map[string]interface{}{
@@ -50,71 +58,181 @@ func (repo *UserRepo) Create(user domain.Register) (domain.User, error) {
 		"tokenID":  graphql.String(user.TokenID),
 	}
 
-	err := repo.client.Mutate(context.Background(), &m, vars)
+	err := repo.client.mutate(ctx, &m, vars)
 	if err != nil {
 		return domain.User{}, err
 	}
 
-	return domain.User{
-		Id:       string(m.CreateUser.Id),
-		Name:     string(m.CreateUser.Name),
-		Username: string(m.CreateUser.Username),
-		Picture:  string(m.CreateUser.Picture),
-	}, nil
+	return toUser(m.CreateUser), nil
 }
 
-func (repo *UserRepo) GetById(id string) (domain.User, error) {
+func (repo *UserRepo) GetById(ctx context.Context, id string) (domain.User, error) {
 	var query struct {
-		User struct {
-			Id       graphql.String
-			Name     graphql.String
-			Username graphql.String
-			Picture  graphql.String
-		} `graphql:"user(id: $id)"`
+		User graphUser `graphql:"user(id: $id)"`
 	}
 
 	vars := map[string]interface{}{
 		"id": id,
 	}
 
-	err := repo.client.Query(context.Background(), &query, vars)
+	err := repo.client.query(ctx, &query, vars)
 	if err != nil {
 		log.Debug().Err(err).Msgf("Repo GetById Error")
 		return domain.User{}, err
 	}
 
-	return domain.User{
-		Id:       string(query.User.Id),
-		Name:     string(query.User.Name),
-		Username: string(query.User.Username),
-		Picture:  string(query.User.Picture),
-	}, nil
+	return toUser(query.User), nil
 }
 
-func (repo *UserRepo) GetByUsername(username string) (domain.User, error) {
+func (repo *UserRepo) GetByUsername(ctx context.Context, username string) (domain.User, error) {
 	var query struct {
-		User struct {
-			Id       graphql.String
-			Name     graphql.String
-			Username graphql.String
-			Picture  graphql.String
-		} `graphql:"userByUsername(username: $username)"`
+		User graphUser `graphql:"userByUsername(username: $username)"`
 	}
 
 	vars := map[string]interface{}{
 		"username": graphql.String(username),
 	}
 
-	err := repo.client.Query(context.Background(), &query, vars)
+	err := repo.client.query(ctx, &query, vars)
 	if err != nil {
 		log.Debug().Err(err).Msgf("Repo GetById Error")
 		return domain.User{}, err
 	}
 
-	return domain.User{
-		Id:       string(query.User.Id),
-		Name:     string(query.User.Name),
-		Username: string(query.User.Username),
-		Picture:  string(query.User.Picture),
+	return toUser(query.User), nil
+}
+
+func (repo *UserRepo) List(ctx context.Context, filter domain.UserFilter) (domain.UserPage, error) {
+	var query struct {
+		Users struct {
+			Items []graphUser
+			Total graphql.Int
+		} `graphql:"users(filter:{provider: $provider, status: $status, role: $role}, page: $page, pageSize: $pageSize)"`
+	}
+
+	vars := map[string]interface{}{
+		"provider": optionalString(filter.Provider),
+		"status":   optionalString(filter.Status),
+		"role":     optionalString(filter.Role),
+		"page":     graphql.Int(filter.Page),
+		"pageSize": graphql.Int(filter.PageSize),
+	}
+
+	err := repo.client.query(ctx, &query, vars)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo List Error")
+		return domain.UserPage{}, err
+	}
+
+	users := make([]domain.User, 0, len(query.Users.Items))
+	for _, user := range query.Users.Items {
+		users = append(users, toUser(user))
+	}
+
+	return domain.UserPage{
+		Items:    users,
+		Page:     filter.Page,
+		PageSize: filter.PageSize,
+		Total:    int(query.Users.Total),
 	}, nil
 }
+
+func (repo *UserRepo) Update(ctx context.Context, id string, update domain.UserUpdate) (domain.User, error) {
+	var m struct {
+		UpdateUser graphUser `graphql:"updateUser(id: $id, input:{username: $username, name: $name, picture: $picture, role: $role})"`
+	}
+
+	vars := map[string]interface{}{
+		"id":       id,
+		"username": (*graphql.String)(update.Username),
+		"name":     (*graphql.String)(update.Name),
+		"picture":  (*graphql.String)(update.Picture),
+		"role":     (*graphql.String)(update.Role),
+	}
+
+	err := repo.client.mutate(ctx, &m, vars)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo Update Error")
+		return domain.User{}, err
+	}
+
+	return toUser(m.UpdateUser), nil
+}
+
+func (repo *UserRepo) UpdateStatus(ctx context.Context, id string, status string) (domain.User, error) {
+	var m struct {
+		UpdateUser graphUser `graphql:"updateUser(id: $id, input:{status: $status})"`
+	}
+
+	vars := map[string]interface{}{
+		"id":     id,
+		"status": graphql.String(status),
+	}
+
+	err := repo.client.mutate(ctx, &m, vars)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo UpdateStatus Error")
+		return domain.User{}, err
+	}
+
+	return toUser(m.UpdateUser), nil
+}
+
+func (repo *UserRepo) RevokeTokens(ctx context.Context, id string) (domain.User, error) {
+	var m struct {
+		RevokeUserTokens graphUser `graphql:"revokeUserTokens(id: $id)"`
+	}
+
+	vars := map[string]interface{}{
+		"id": id,
+	}
+
+	err := repo.client.mutate(ctx, &m, vars)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo RevokeTokens Error")
+		return domain.User{}, err
+	}
+
+	return toUser(m.RevokeUserTokens), nil
+}
+
+func (repo *UserRepo) Delete(ctx context.Context, id string) error {
+	var m struct {
+		DeleteUser struct {
+			Id graphql.String
+		} `graphql:"deleteUser(id: $id)"`
+	}
+
+	vars := map[string]interface{}{
+		"id": id,
+	}
+
+	err := repo.client.mutate(ctx, &m, vars)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Repo Delete Error")
+	}
+
+	return err
+}
+
+func toUser(user graphUser) domain.User {
+	return domain.User{
+		Id:           string(user.Id),
+		Name:         string(user.Name),
+		Username:     string(user.Username),
+		Picture:      string(user.Picture),
+		Role:         string(user.Role),
+		Provider:     string(user.Provider),
+		Status:       string(user.Status),
+		TokenVersion: int(user.TokenVersion),
+	}
+}
+
+// optionalString sends empty strings as null so they are ignored by the server
+func optionalString(value string) *graphql.String {
+	if value == "" {
+		return nil
+	}
+
+	return graphql.NewString(graphql.String(value))
+}
@@ -0,0 +1,392 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"github.com/sy-software/minerva-spear-users/internal/core/ports"
+)
+
+// Postgres backend tests only run when a database is available
+const POSTGRES_DSN_VAR = "SPEAR_TEST_POSTGRES_DSN"
+
+func TestUserRepoConformance(t *testing.T) {
+	backends := map[string]func(t *testing.T) ports.UserRepo{
+		"graphql": func(t *testing.T) ports.UserRepo {
+			server := httptest.NewServer(newGraphStub())
+			t.Cleanup(server.Close)
+
+			config := domain.DefaultConfig()
+			config.UserRepo.Url = server.URL
+			return openTestRepo(t, &config)
+		},
+		"sqlite": func(t *testing.T) ports.UserRepo {
+			config := domain.DefaultConfig()
+			config.UserRepo.Driver = domain.UserRepoSQLite
+			config.UserRepo.DSN = "file:" + filepath.Join(t.TempDir(), "users.db")
+			return openTestRepo(t, &config)
+		},
+		"memory": func(t *testing.T) ports.UserRepo {
+			config := domain.DefaultConfig()
+			config.UserRepo.Driver = domain.UserRepoMemory
+			return openTestRepo(t, &config)
+		},
+		"postgres": func(t *testing.T) ports.UserRepo {
+			dsn := os.Getenv(POSTGRES_DSN_VAR)
+			if dsn == "" {
+				t.Skipf("%s is not set", POSTGRES_DSN_VAR)
+			}
+
+			config := domain.DefaultConfig()
+			config.UserRepo.Driver = domain.UserRepoPostgres
+			config.UserRepo.DSN = dsn
+			repo := openTestRepo(t, &config)
+
+			if _, err := repo.(*SQLUserRepo).db.Exec("DELETE FROM users"); err != nil {
+				t.Fatalf("Can't clean users table: %v", err)
+			}
+
+			return repo
+		},
+	}
+
+	for name, newRepo := range backends {
+		t.Run(name, func(t *testing.T) {
+			runUserRepoConformance(t, newRepo(t))
+		})
+	}
+}
+
+func openTestRepo(t *testing.T, config *domain.Config) ports.UserRepo {
+	repo, err := OpenUserRepo(config)
+	if err != nil {
+		t.Fatalf("Expected repo without error got: %v", err)
+	}
+
+	if closer, ok := repo.(*SQLUserRepo); ok {
+		t.Cleanup(func() { closer.Close() })
+	}
+
+	return repo
+}
+
+// runUserRepoConformance checks the behavior every ports.UserRepo must have
+func runUserRepoConformance(t *testing.T, repo ports.UserRepo) {
+	ctx := context.Background()
+
+	created, err := repo.Create(ctx, domain.Register{
+		Username: "ironman",
+		Name:     "Tony Stark",
+		Picture:  "https://avatar.test/ironman.png",
+		Role:     "hero",
+		Provider: "StarkIndustries",
+		TokenID:  "token",
+	})
+
+	if err != nil {
+		t.Fatalf("Expected user to be created got: %v", err)
+	}
+
+	if created.Id == "" || created.Username != "ironman" || created.Status != domain.UserActive {
+		t.Errorf("Expected active user with ID got: %+v", created)
+	}
+
+	t.Run("Test get", func(t *testing.T) {
+		byId, err := repo.GetById(ctx, created.Id)
+
+		if err != nil || byId != created {
+			t.Errorf("Expected user: %+v got: %+v %v", created, byId, err)
+		}
+
+		byUsername, err := repo.GetByUsername(ctx, "ironman")
+
+		if err != nil || byUsername != created {
+			t.Errorf("Expected user: %+v got: %+v %v", created, byUsername, err)
+		}
+	})
+
+	t.Run("Test not found", func(t *testing.T) {
+		if _, err := repo.GetById(ctx, "unknown"); !errors.Is(err, domain.ErrNotFound) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrNotFound, err)
+		}
+
+		if _, err := repo.GetByUsername(ctx, "hulk"); !errors.Is(err, domain.ErrNotFound) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrNotFound, err)
+		}
+	})
+
+	t.Run("Test duplicated username", func(t *testing.T) {
+		_, err := repo.Create(ctx, domain.Register{Username: "ironman", Provider: "StarkIndustries"})
+
+		if !errors.Is(err, domain.ErrDuplicate) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrDuplicate, err)
+		}
+	})
+
+	other, _ := repo.Create(ctx, domain.Register{Username: "hulk", Name: "Bruce Banner", Role: "hero", Provider: "Avengers"})
+	repo.Create(ctx, domain.Register{Username: "loki", Name: "Loki", Role: "villain", Provider: "Asgard"})
+
+	t.Run("Test partial update", func(t *testing.T) {
+		name := "Anthony Stark"
+		username := "tonystark"
+		updated, err := repo.Update(ctx, created.Id, domain.UserUpdate{Name: &name, Username: &username})
+
+		expected := created
+		expected.Name = name
+		expected.Username = username
+
+		if err != nil || updated != expected {
+			t.Errorf("Expected user: %+v got: %+v %v", expected, updated, err)
+		}
+
+		if stored, _ := repo.GetByUsername(ctx, username); stored != expected {
+			t.Errorf("Expected stored user: %+v got: %+v", expected, stored)
+		}
+	})
+
+	t.Run("Test update to taken username", func(t *testing.T) {
+		username := "hulk"
+		_, err := repo.Update(ctx, created.Id, domain.UserUpdate{Username: &username})
+
+		if !errors.Is(err, domain.ErrDuplicate) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrDuplicate, err)
+		}
+	})
+
+	t.Run("Test update unknown user", func(t *testing.T) {
+		name := "Nobody"
+		_, err := repo.Update(ctx, "unknown", domain.UserUpdate{Name: &name})
+
+		if !errors.Is(err, domain.ErrNotFound) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrNotFound, err)
+		}
+	})
+
+	t.Run("Test update status", func(t *testing.T) {
+		updated, err := repo.UpdateStatus(ctx, other.Id, domain.UserSuspended)
+
+		if err != nil || updated.Status != domain.UserSuspended || updated.Username != "hulk" {
+			t.Errorf("Expected suspended user got: %+v %v", updated, err)
+		}
+	})
+
+	t.Run("Test revoke tokens", func(t *testing.T) {
+		revoked, err := repo.RevokeTokens(ctx, other.Id)
+
+		if err != nil || revoked.TokenVersion != other.TokenVersion+1 || revoked.Status != domain.UserSuspended {
+			t.Errorf("Expected suspended user with the next token version got: %+v %v", revoked, err)
+		}
+
+		if stored, _ := repo.GetById(ctx, other.Id); stored.TokenVersion != revoked.TokenVersion {
+			t.Errorf("Expected stored token version: %d got: %d", revoked.TokenVersion, stored.TokenVersion)
+		}
+
+		if _, err := repo.RevokeTokens(ctx, "unknown"); !errors.Is(err, domain.ErrNotFound) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrNotFound, err)
+		}
+	})
+
+	t.Run("Test list", func(t *testing.T) {
+		page, err := repo.List(ctx, domain.UserFilter{Role: "hero", Page: 1, PageSize: 1})
+
+		if err != nil {
+			t.Fatalf("Expected page without error got: %v", err)
+		}
+
+		if page.Total != 2 || len(page.Items) != 1 || page.Items[0].Id != created.Id {
+			t.Errorf("Expected first of 2 heroes got: %+v", page)
+		}
+
+		page, _ = repo.List(ctx, domain.UserFilter{Role: "hero", Page: 2, PageSize: 1})
+
+		if len(page.Items) != 1 || page.Items[0].Id != other.Id {
+			t.Errorf("Expected second hero got: %+v", page)
+		}
+
+		page, _ = repo.List(ctx, domain.UserFilter{Status: domain.UserSuspended, Page: 1, PageSize: 10})
+
+		if page.Total != 1 || len(page.Items) != 1 || page.Items[0].Username != "hulk" {
+			t.Errorf("Expected suspended users got: %+v", page)
+		}
+	})
+
+	t.Run("Test delete", func(t *testing.T) {
+		if err := repo.Delete(ctx, other.Id); err != nil {
+			t.Fatalf("Expected user to be deleted got: %v", err)
+		}
+
+		if _, err := repo.GetById(ctx, other.Id); !errors.Is(err, domain.ErrNotFound) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrNotFound, err)
+		}
+
+		if err := repo.Delete(ctx, other.Id); !errors.Is(err, domain.ErrNotFound) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrNotFound, err)
+		}
+	})
+}
+
+// graphStub is a minimal owl GraphQL server that keeps users in memory
+type graphStub struct {
+	lock  sync.Mutex
+	users map[string]map[string]interface{}
+	order []string
+	next  int
+}
+
+func newGraphStub() *graphStub {
+	return &graphStub{users: map[string]map[string]interface{}{}}
+}
+
+func (stub *graphStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+
+	json.NewDecoder(r.Body).Decode(&request)
+
+	stub.lock.Lock()
+	defer stub.lock.Unlock()
+
+	vars := request.Variables
+	var data map[string]interface{}
+	var code string
+
+	switch {
+	case strings.Contains(request.Query, "createUser("):
+		if stub.findUsername(vars["username"]) != nil {
+			code = "DUPLICATED_VALUE"
+			break
+		}
+
+		stub.next++
+		id := "user" + strings.Repeat("0", stub.next)
+		user := map[string]interface{}{"id": id, "status": domain.UserActive, "tokenVersion": 0}
+		for _, field := range []string{"username", "name", "picture", "role", "provider"} {
+			user[field] = vars[field]
+		}
+
+		stub.users[id] = user
+		stub.order = append(stub.order, id)
+		data = map[string]interface{}{"createUser": user}
+	case strings.Contains(request.Query, "userByUsername("):
+		if user := stub.findUsername(vars["username"]); user != nil {
+			data = map[string]interface{}{"userByUsername": user}
+		} else {
+			code = "NOT_FOUND"
+		}
+	case strings.Contains(request.Query, "users("):
+		data = map[string]interface{}{"users": stub.list(vars)}
+	case strings.Contains(request.Query, "updateUser("):
+		user, ok := stub.users[vars["id"].(string)]
+		if !ok {
+			code = "NOT_FOUND"
+			break
+		}
+
+		if owner := stub.findUsername(vars["username"]); owner != nil && owner["id"] != user["id"] {
+			code = "DUPLICATED_VALUE"
+			break
+		}
+
+		for _, field := range []string{"username", "name", "picture", "role", "status"} {
+			if value, ok := vars[field]; ok && value != nil {
+				user[field] = value
+			}
+		}
+
+		data = map[string]interface{}{"updateUser": user}
+	case strings.Contains(request.Query, "revokeUserTokens("):
+		user, ok := stub.users[vars["id"].(string)]
+		if !ok {
+			code = "NOT_FOUND"
+			break
+		}
+
+		user["tokenVersion"] = user["tokenVersion"].(int) + 1
+		data = map[string]interface{}{"revokeUserTokens": user}
+	case strings.Contains(request.Query, "deleteUser("):
+		id := vars["id"].(string)
+		if _, ok := stub.users[id]; !ok {
+			code = "NOT_FOUND"
+			break
+		}
+
+		delete(stub.users, id)
+		data = map[string]interface{}{"deleteUser": map[string]interface{}{"id": id}}
+	case strings.Contains(request.Query, "user("):
+		if user, ok := stub.users[vars["id"].(string)]; ok {
+			data = map[string]interface{}{"user": user}
+		} else {
+			code = "NOT_FOUND"
+		}
+	}
+
+	if code != "" {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data":   nil,
+			"errors": []interface{}{map[string]interface{}{"message": strings.ToLower(code), "extensions": map[string]interface{}{"code": code}}},
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func (stub *graphStub) findUsername(username interface{}) map[string]interface{} {
+	if username == nil {
+		return nil
+	}
+
+	for _, user := range stub.users {
+		if user["username"] == username {
+			return user
+		}
+	}
+
+	return nil
+}
+
+func (stub *graphStub) list(vars map[string]interface{}) map[string]interface{} {
+	matches := []interface{}{}
+	for _, id := range stub.order {
+		user, ok := stub.users[id]
+		if !ok {
+			continue
+		}
+
+		match := true
+		for _, field := range []string{"provider", "status", "role"} {
+			if value := vars[field]; value != nil && user[field] != value {
+				match = false
+			}
+		}
+
+		if match {
+			matches = append(matches, user)
+		}
+	}
+
+	page := int(vars["page"].(float64))
+	pageSize := int(vars["pageSize"].(float64))
+	start := (page - 1) * pageSize
+	end := start + pageSize
+	if start > len(matches) {
+		start = len(matches)
+	}
+
+	if end > len(matches) {
+		end = len(matches)
+	}
+
+	return map[string]interface{}{"items": matches[start:end], "total": len(matches)}
+}
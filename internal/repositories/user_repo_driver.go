@@ -0,0 +1,62 @@
+package repositories
+
+import (
+	"fmt"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+	"github.com/sy-software/minerva-spear-users/internal/core/ports"
+)
+
+// OpenUserRepo creates the UserRepo for the storage selected in UserRepo.Driver
+func OpenUserRepo(config *domain.Config) (ports.UserRepo, error) {
+	switch config.UserRepo.Driver {
+	case "", domain.UserRepoGraphQL:
+		return NewUserRepo(config)
+	case domain.UserRepoSQLite, domain.UserRepoPostgres:
+		return NewSQLUserRepo(config)
+	case domain.UserRepoMemory:
+		return NewMemoryUserRepo(), nil
+	}
+
+	return nil, fmt.Errorf("unknown userRepo.driver: %q", config.UserRepo.Driver)
+}
+
+// OpenCredentialRepo creates the CredentialRepo for the storage selected in UserRepo.Driver,
+// SQL credentials are stored in the database of users, the repository returned by OpenUserRepo
+func OpenCredentialRepo(config *domain.Config, users ports.UserRepo) (ports.CredentialRepo, error) {
+	switch config.UserRepo.Driver {
+	case "", domain.UserRepoGraphQL:
+		return NewCredentialRepo(config)
+	case domain.UserRepoSQLite, domain.UserRepoPostgres:
+		sqlUsers, ok := users.(*SQLUserRepo)
+		if !ok {
+			return nil, fmt.Errorf("sql credentials need the sql user repository, got: %T", users)
+		}
+
+		return NewSQLCredentialRepo(sqlUsers), nil
+	case domain.UserRepoMemory:
+		return NewMemoryCredentialRepo(), nil
+	}
+
+	return nil, fmt.Errorf("unknown userRepo.driver: %q", config.UserRepo.Driver)
+}
+
+// OpenChallengeRepo creates the ChallengeRepo for the storage selected in UserRepo.Driver,
+// SQL challenges are stored in the database of users, the repository returned by OpenUserRepo
+func OpenChallengeRepo(config *domain.Config, users ports.UserRepo) (ports.ChallengeRepo, error) {
+	switch config.UserRepo.Driver {
+	case "", domain.UserRepoGraphQL:
+		return NewChallengeRepo(config)
+	case domain.UserRepoSQLite, domain.UserRepoPostgres:
+		sqlUsers, ok := users.(*SQLUserRepo)
+		if !ok {
+			return nil, fmt.Errorf("sql challenges need the sql user repository, got: %T", users)
+		}
+
+		return NewSQLChallengeRepo(sqlUsers), nil
+	case domain.UserRepoMemory:
+		return NewMemoryChallengeRepo(), nil
+	}
+
+	return nil, fmt.Errorf("unknown userRepo.driver: %q", config.UserRepo.Driver)
+}
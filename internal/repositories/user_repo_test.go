@@ -0,0 +1,230 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+func TestUserRepoErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		status   int
+		response string
+		expected error
+	}{
+		{
+			name:     "Test not found extension",
+			status:   http.StatusOK,
+			response: `{"data": null, "errors": [{"message": "user not found", "path": ["user"], "extensions": {"code": "NOT_FOUND"}}]}`,
+			expected: domain.ErrNotFound,
+		},
+		{
+			name:     "Test not found message",
+			status:   http.StatusOK,
+			response: `{"data": null, "errors": [{"message": "not_found", "path": ["user"]}]}`,
+			expected: domain.ErrNotFound,
+		},
+		{
+			name:     "Test duplicated value",
+			status:   http.StatusOK,
+			response: `{"data": null, "errors": [{"message": "duplicated_value", "path": ["createUser"]}]}`,
+			expected: domain.ErrDuplicate,
+		},
+		{
+			name:     "Test server outage",
+			status:   http.StatusBadGateway,
+			response: `bad gateway`,
+			expected: domain.ErrUnavailable,
+		},
+		{
+			name:     "Test server timeout",
+			status:   http.StatusGatewayTimeout,
+			response: `timeout`,
+			expected: domain.ErrTimeout,
+		},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(testCase.status)
+				w.Write([]byte(testCase.response))
+			}))
+			defer server.Close()
+
+			config := domain.DefaultConfig()
+			config.UserRepo.Url = server.URL
+			repo, _ := NewUserRepo(&config)
+
+			_, err := repo.GetById(context.Background(), "newid")
+
+			if !errors.Is(err, testCase.expected) {
+				t.Errorf("Expected error: %v got: %v", testCase.expected, err)
+			}
+		})
+	}
+
+	t.Run("Test unreachable server", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+
+		config := domain.DefaultConfig()
+		config.UserRepo.Url = server.URL
+		repo, _ := NewUserRepo(&config)
+
+		_, err := repo.GetByUsername(context.Background(), "ironman")
+
+		if !errors.Is(err, domain.ErrUnavailable) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrUnavailable, err)
+		}
+	})
+
+	t.Run("Test unknown error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"errors": [{"message": "boom", "path": ["users", 0, "name"]}]}`))
+		}))
+		defer server.Close()
+
+		config := domain.DefaultConfig()
+		config.UserRepo.Url = server.URL
+		repo, _ := NewUserRepo(&config)
+
+		_, err := repo.GetById(context.Background(), "newid")
+
+		var graphErrors GraphErrors
+		if !errors.As(err, &graphErrors) || graphErrors[0].Message != "boom" || len(graphErrors[0].Path) != 3 {
+			t.Errorf("Expected GraphErrors with message and path got: %v", err)
+		}
+	})
+}
+
+func TestUserRepoGetById(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": {"user": {"id": "newid", "name": "Tony Stark", "username": "ironman", "status": "active"}}}`))
+	}))
+	defer server.Close()
+
+	config := domain.DefaultConfig()
+	config.UserRepo.Url = server.URL
+	repo, _ := NewUserRepo(&config)
+
+	user, err := repo.GetById(context.Background(), "newid")
+
+	if err != nil {
+		t.Fatalf("Expected user without error, got: %v", err)
+	}
+
+	if user.Id != "newid" || user.Username != "ironman" || user.Status != domain.UserActive {
+		t.Errorf("Expected user newid got: %+v", user)
+	}
+}
+
+func TestUserRepoPing(t *testing.T) {
+	calls := 0
+	available := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte(`{"data": {"__typename": "Query"}}`))
+	}))
+	defer server.Close()
+
+	config := domain.DefaultConfig()
+	config.UserRepo.Url = server.URL
+	config.UserRepo.Retries = 3
+	repo, _ := NewUserRepo(&config)
+
+	if err := repo.Ping(context.Background()); err == nil {
+		t.Error("Expected an error when the server is unavailable")
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected ping without retries got: %d calls", calls)
+	}
+
+	available = true
+
+	if err := repo.Ping(context.Background()); err != nil {
+		t.Errorf("Expected ping without error got: %v", err)
+	}
+}
+
+func TestUserRepoContext(t *testing.T) {
+	release := make(chan struct{})
+	var requestId string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("slow") != "" {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		} else {
+			requestId = r.Header.Get(REQUEST_ID_HEADER)
+		}
+
+		w.Write([]byte(`{"data": {"user": {"id": "newid", "username": "ironman"}}}`))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	config := domain.DefaultConfig()
+	config.UserRepo.Url = server.URL
+
+	t.Run("Test request ID is forwarded", func(t *testing.T) {
+		repo, _ := NewUserRepo(&config)
+		ctx := domain.WithRequestId(context.Background(), "request-1")
+
+		_, err := repo.GetById(ctx, "newid")
+
+		if err != nil {
+			t.Fatalf("Expected user without error, got: %v", err)
+		}
+
+		if requestId != "request-1" {
+			t.Errorf("Expected request ID header: %q got: %q", "request-1", requestId)
+		}
+	})
+
+	t.Run("Test per call timeout", func(t *testing.T) {
+		slowConfig := config
+		slowConfig.UserRepo.Url = server.URL + "?slow=true"
+		slowConfig.UserRepo.Timeout = 50
+		repo, _ := NewUserRepo(&slowConfig)
+
+		start := time.Now()
+		_, err := repo.GetById(context.Background(), "newid")
+
+		if !errors.Is(err, domain.ErrTimeout) {
+			t.Errorf("Expected error: %v got: %v", domain.ErrTimeout, err)
+		}
+
+		if time.Since(start) > time.Second {
+			t.Errorf("Expected the call to be aborted after the timeout took: %v", time.Since(start))
+		}
+	})
+
+	t.Run("Test caller cancellation", func(t *testing.T) {
+		slowConfig := config
+		slowConfig.UserRepo.Url = server.URL + "?slow=true"
+		repo, _ := NewUserRepo(&slowConfig)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := repo.GetById(ctx, "newid")
+
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected error: %v got: %v", context.Canceled, err)
+		}
+	})
+}
@@ -0,0 +1,222 @@
+// Code generated by mocks/gen from internal/core/ports. DO NOT EDIT.
+
+package mocks
+
+import (
+	"context"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+// AuthService is a call recording fake of ports.AuthService
+type AuthService struct {
+	Recorder
+
+	LoginInterceptor             func(request domain.Login) (domain.UserToken, error)
+	RegisterInterceptor          func(request domain.Register) (domain.UserToken, error)
+	RefreshInterceptor           func(refreshToken string) (domain.UserToken, error)
+	MeInterceptor                func(userId string) (domain.User, error)
+	UpdateMeInterceptor          func(userId string, update domain.UserUpdate) (domain.UserToken, error)
+	ListUsersInterceptor         func(filter domain.UserFilter) (domain.UserPage, error)
+	GetUserInterceptor           func(userId string) (domain.User, error)
+	GetUserByUsernameInterceptor func(username string) (domain.User, error)
+	UpdateUserInterceptor        func(userId string, update domain.UserUpdate) (domain.User, error)
+	SuspendInterceptor           func(userId string) (domain.User, error)
+	ReactivateInterceptor        func(userId string) (domain.User, error)
+	DeleteInterceptor            func(userId string) (domain.User, error)
+	EraseInterceptor             func(userId string) error
+}
+
+func (mock *AuthService) Login(ctx context.Context, request domain.Login) (r0 domain.UserToken, r1 error) {
+	if results, ok := mock.record("Login", 2, ctx, request); ok {
+		r0, _ = results[0].(domain.UserToken)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.LoginInterceptor != nil {
+		return mock.LoginInterceptor(request)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
+}
+
+func (mock *AuthService) Register(ctx context.Context, request domain.Register) (r0 domain.UserToken, r1 error) {
+	if results, ok := mock.record("Register", 2, ctx, request); ok {
+		r0, _ = results[0].(domain.UserToken)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.RegisterInterceptor != nil {
+		return mock.RegisterInterceptor(request)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
+}
+
+func (mock *AuthService) Refresh(ctx context.Context, refreshToken string) (r0 domain.UserToken, r1 error) {
+	if results, ok := mock.record("Refresh", 2, ctx, refreshToken); ok {
+		r0, _ = results[0].(domain.UserToken)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.RefreshInterceptor != nil {
+		return mock.RefreshInterceptor(refreshToken)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
+}
+
+func (mock *AuthService) Me(ctx context.Context, userId string) (r0 domain.User, r1 error) {
+	if results, ok := mock.record("Me", 2, ctx, userId); ok {
+		r0, _ = results[0].(domain.User)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.MeInterceptor != nil {
+		return mock.MeInterceptor(userId)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
+}
+
+func (mock *AuthService) UpdateMe(ctx context.Context, userId string, update domain.UserUpdate) (r0 domain.UserToken, r1 error) {
+	if results, ok := mock.record("UpdateMe", 2, ctx, userId, update); ok {
+		r0, _ = results[0].(domain.UserToken)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.UpdateMeInterceptor != nil {
+		return mock.UpdateMeInterceptor(userId, update)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
+}
+
+func (mock *AuthService) ListUsers(ctx context.Context, filter domain.UserFilter) (r0 domain.UserPage, r1 error) {
+	if results, ok := mock.record("ListUsers", 2, ctx, filter); ok {
+		r0, _ = results[0].(domain.UserPage)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.ListUsersInterceptor != nil {
+		return mock.ListUsersInterceptor(filter)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
+}
+
+func (mock *AuthService) GetUser(ctx context.Context, userId string) (r0 domain.User, r1 error) {
+	if results, ok := mock.record("GetUser", 2, ctx, userId); ok {
+		r0, _ = results[0].(domain.User)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.GetUserInterceptor != nil {
+		return mock.GetUserInterceptor(userId)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
+}
+
+func (mock *AuthService) GetUserByUsername(ctx context.Context, username string) (r0 domain.User, r1 error) {
+	if results, ok := mock.record("GetUserByUsername", 2, ctx, username); ok {
+		r0, _ = results[0].(domain.User)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.GetUserByUsernameInterceptor != nil {
+		return mock.GetUserByUsernameInterceptor(username)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
+}
+
+func (mock *AuthService) UpdateUser(ctx context.Context, userId string, update domain.UserUpdate) (r0 domain.User, r1 error) {
+	if results, ok := mock.record("UpdateUser", 2, ctx, userId, update); ok {
+		r0, _ = results[0].(domain.User)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.UpdateUserInterceptor != nil {
+		return mock.UpdateUserInterceptor(userId, update)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
+}
+
+func (mock *AuthService) Suspend(ctx context.Context, userId string) (r0 domain.User, r1 error) {
+	if results, ok := mock.record("Suspend", 2, ctx, userId); ok {
+		r0, _ = results[0].(domain.User)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.SuspendInterceptor != nil {
+		return mock.SuspendInterceptor(userId)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
+}
+
+func (mock *AuthService) Reactivate(ctx context.Context, userId string) (r0 domain.User, r1 error) {
+	if results, ok := mock.record("Reactivate", 2, ctx, userId); ok {
+		r0, _ = results[0].(domain.User)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.ReactivateInterceptor != nil {
+		return mock.ReactivateInterceptor(userId)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
+}
+
+func (mock *AuthService) Delete(ctx context.Context, userId string) (r0 domain.User, r1 error) {
+	if results, ok := mock.record("Delete", 2, ctx, userId); ok {
+		r0, _ = results[0].(domain.User)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.DeleteInterceptor != nil {
+		return mock.DeleteInterceptor(userId)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
+}
+
+func (mock *AuthService) Erase(ctx context.Context, userId string) (r0 error) {
+	if results, ok := mock.record("Erase", 1, ctx, userId); ok {
+		r0, _ = results[0].(error)
+		return
+	}
+
+	if mock.EraseInterceptor != nil {
+		return mock.EraseInterceptor(userId)
+	}
+
+	r0 = ErrUnexpectedCall
+	return
+}
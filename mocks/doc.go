@@ -0,0 +1,9 @@
+// Package mocks contains call recording fakes for every interface in internal/core/ports.
+//
+// Each method records its arguments and returns, in order of precedence:
+// a response queued with Returns, the result of its interceptor or ErrUnexpectedCall.
+//
+// Mocks are generated from the ports, run go generate after changing an interface.
+package mocks
+
+//go:generate go run ./gen -ports ../internal/core/ports -out .
@@ -0,0 +1,317 @@
+// Command gen writes a call recording mock for each interface of the ports package
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const header = "// Code generated by mocks/gen from internal/core/ports. DO NOT EDIT.\n\n"
+
+type param struct {
+	name string
+	kind string
+}
+
+type method struct {
+	name    string
+	params  []param
+	results []string
+	// The first parameter is a context.Context, it's not passed to the interceptor
+	hasContext bool
+}
+
+type mock struct {
+	name    string
+	methods []method
+	// Package names used by the method signatures
+	packages map[string]bool
+	imports  map[string]string
+}
+
+func main() {
+	portsDir := flag.String("ports", "../internal/core/ports", "Directory of the ports package")
+	outDir := flag.String("out", ".", "Directory where the mocks are written")
+	flag.Parse()
+
+	files := token.NewFileSet()
+	packages, err := parser.ParseDir(files, *portsDir, nil, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, pkg := range packages {
+		for _, file := range pkg.Files {
+			for _, mock := range parseMocks(file) {
+				source, err := mock.generate(pkg.Name)
+				if err != nil {
+					log.Fatalf("can't generate %s: %v", mock.name, err)
+				}
+
+				path := filepath.Join(*outDir, snakeCase(mock.name)+".go")
+				if err := ioutil.WriteFile(path, source, 0644); err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
+	}
+}
+
+// parseMocks finds the interfaces declared in a file
+func parseMocks(file *ast.File) []mock {
+	imports := map[string]string{}
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := filepath.Base(path)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+
+		imports[name] = path
+	}
+
+	mocks := []mock{}
+	ast.Inspect(file, func(node ast.Node) bool {
+		spec, ok := node.(*ast.TypeSpec)
+		if !ok {
+			return true
+		}
+
+		iface, ok := spec.Type.(*ast.InterfaceType)
+		if !ok {
+			return false
+		}
+
+		current := mock{name: spec.Name.Name, packages: map[string]bool{}, imports: imports}
+		for _, field := range iface.Methods.List {
+			signature, ok := field.Type.(*ast.FuncType)
+			if !ok || len(field.Names) == 0 {
+				continue
+			}
+
+			current.methods = append(current.methods, current.parseMethod(field.Names[0].Name, signature))
+		}
+
+		mocks = append(mocks, current)
+		return false
+	})
+
+	return mocks
+}
+
+func (mock *mock) parseMethod(name string, signature *ast.FuncType) method {
+	parsed := method{name: name}
+
+	for _, field := range signature.Params.List {
+		kind := mock.typeString(field.Type)
+		if len(field.Names) == 0 {
+			parsed.params = append(parsed.params, param{name: fmt.Sprintf("arg%d", len(parsed.params)), kind: kind})
+			continue
+		}
+
+		for _, ident := range field.Names {
+			parsed.params = append(parsed.params, param{name: ident.Name, kind: kind})
+		}
+	}
+
+	if signature.Results != nil {
+		for _, field := range signature.Results.List {
+			count := len(field.Names)
+			if count == 0 {
+				count = 1
+			}
+
+			for i := 0; i < count; i++ {
+				parsed.results = append(parsed.results, mock.typeString(field.Type))
+			}
+		}
+	}
+
+	parsed.hasContext = len(parsed.params) > 0 && parsed.params[0].kind == "context.Context"
+	return parsed
+}
+
+// typeString renders a type and remembers the packages it uses
+func (mock *mock) typeString(expr ast.Expr) string {
+	ast.Inspect(expr, func(node ast.Node) bool {
+		if selector, ok := node.(*ast.SelectorExpr); ok {
+			if ident, ok := selector.X.(*ast.Ident); ok {
+				mock.packages[ident.Name] = true
+			}
+		}
+
+		return true
+	})
+
+	return types.ExprString(expr)
+}
+
+func (mock *mock) generate(portsPackage string) ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteString(header)
+	out.WriteString("package mocks\n\n")
+	mock.writeImports(&out)
+
+	fmt.Fprintf(&out, "// %s is a call recording fake of %s.%s\n", mock.name, portsPackage, mock.name)
+	fmt.Fprintf(&out, "type %s struct {\n\tRecorder\n\n", mock.name)
+	for _, method := range mock.methods {
+		fmt.Fprintf(&out, "\t%sInterceptor func(%s) %s\n", method.name, method.interceptorParams(), method.resultList(false))
+	}
+	out.WriteString("}\n")
+
+	for _, method := range mock.methods {
+		method.write(&out, mock.name)
+	}
+
+	return format.Source(out.Bytes())
+}
+
+func (mock *mock) writeImports(out *bytes.Buffer) {
+	standard := []string{}
+	external := []string{}
+	for name := range mock.packages {
+		path, ok := mock.imports[name]
+		if !ok {
+			continue
+		}
+
+		if strings.Contains(strings.Split(path, "/")[0], ".") {
+			external = append(external, path)
+		} else {
+			standard = append(standard, path)
+		}
+	}
+
+	if len(standard)+len(external) == 0 {
+		return
+	}
+
+	sort.Strings(standard)
+	sort.Strings(external)
+
+	out.WriteString("import (\n")
+	for _, path := range standard {
+		fmt.Fprintf(out, "\t%q\n", path)
+	}
+
+	if len(standard) > 0 && len(external) > 0 {
+		out.WriteString("\n")
+	}
+
+	for _, path := range external {
+		fmt.Fprintf(out, "\t%q\n", path)
+	}
+	out.WriteString(")\n\n")
+}
+
+func (method method) write(out *bytes.Buffer, receiver string) {
+	params := make([]string, 0, len(method.params))
+	for _, param := range method.params {
+		params = append(params, param.name+" "+param.kind)
+	}
+
+	ctx := "nil"
+	if method.hasContext {
+		ctx = method.params[0].name
+	}
+
+	fmt.Fprintf(out, "\nfunc (mock *%s) %s(%s) %s {\n", receiver, method.name, strings.Join(params, ", "), method.resultList(true))
+	recordArgs := append([]string{strconv.Quote(method.name), strconv.Itoa(len(method.results)), ctx}, method.interceptorArgs()...)
+
+	if len(method.results) == 0 {
+		fmt.Fprintf(out, "\tif _, ok := mock.record(%s); ok {\n\t\treturn\n\t}\n\n", strings.Join(recordArgs, ", "))
+		fmt.Fprintf(out, "\tif mock.%sInterceptor != nil {\n\t\tmock.%sInterceptor(%s)\n\t}\n}\n", method.name, method.name, strings.Join(method.interceptorArgs(), ", "))
+		return
+	}
+
+	fmt.Fprintf(out, "\tif results, ok := mock.record(%s); ok {\n", strings.Join(recordArgs, ", "))
+	for i, result := range method.results {
+		fmt.Fprintf(out, "\t\tr%d, _ = results[%d].(%s)\n", i, i, result)
+	}
+	out.WriteString("\t\treturn\n\t}\n\n")
+
+	fmt.Fprintf(out, "\tif mock.%sInterceptor != nil {\n\t\treturn mock.%sInterceptor(%s)\n\t}\n\n", method.name, method.name, strings.Join(method.interceptorArgs(), ", "))
+
+	last := len(method.results) - 1
+	if method.results[last] == "error" {
+		fmt.Fprintf(out, "\tr%d = ErrUnexpectedCall\n", last)
+	}
+	out.WriteString("\treturn\n}\n")
+}
+
+// interceptorArgs are the parameter names without the context
+func (method method) interceptorArgs() []string {
+	args := []string{}
+	for i, param := range method.params {
+		if i == 0 && method.hasContext {
+			continue
+		}
+
+		args = append(args, param.name)
+	}
+
+	return args
+}
+
+func (method method) interceptorParams() string {
+	params := []string{}
+	for i, param := range method.params {
+		if i == 0 && method.hasContext {
+			continue
+		}
+
+		params = append(params, param.name+" "+param.kind)
+	}
+
+	return strings.Join(params, ", ")
+}
+
+// resultList renders the results, named results let the mock return zero values
+func (method method) resultList(named bool) string {
+	if len(method.results) == 0 {
+		return ""
+	}
+
+	results := make([]string, 0, len(method.results))
+	for i, result := range method.results {
+		if named {
+			result = fmt.Sprintf("r%d %s", i, result)
+		}
+
+		results = append(results, result)
+	}
+
+	if len(results) == 1 && !named {
+		return results[0]
+	}
+
+	return "(" + strings.Join(results, ", ") + ")"
+}
+
+// snakeCase converts a type name to a file name I.E.: WebAuthnService to web_authn_service
+func snakeCase(name string) string {
+	var out strings.Builder
+	runes := []rune(name)
+	for i, char := range runes {
+		if unicode.IsUpper(char) && i > 0 && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			out.WriteRune('_')
+		}
+
+		out.WriteRune(unicode.ToLower(char))
+	}
+
+	return out.String()
+}
@@ -0,0 +1,104 @@
+package mocks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrUnexpectedCall is returned by methods without a queued response or an interceptor
+var ErrUnexpectedCall = errors.New("unexpected mock call")
+
+// Call is a method call received by a mock
+type Call struct {
+	// The context received by the method, nil if the method has no context
+	Context context.Context
+	// Method arguments without the context
+	Args []interface{}
+}
+
+// Recorder keeps the calls received by a mock and the responses queued for its methods,
+// the zero value is ready to use and it's safe for concurrent calls
+type Recorder struct {
+	lock      sync.Mutex
+	calls     map[string][]Call
+	responses map[string][][]interface{}
+}
+
+// Calls returns the calls received by a method in order
+func (recorder *Recorder) Calls(method string) []Call {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	return append([]Call{}, recorder.calls[method]...)
+}
+
+// CallCount returns how many times a method was called
+func (recorder *Recorder) CallCount(method string) int {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	return len(recorder.calls[method])
+}
+
+// LastCall returns the most recent call to a method
+func (recorder *Recorder) LastCall(method string) (Call, bool) {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	calls := recorder.calls[method]
+	if len(calls) == 0 {
+		return Call{}, false
+	}
+
+	return calls[len(calls)-1], true
+}
+
+// Returns queues the results of the next call to a method, each call consumes one response,
+// when the queue is empty the method interceptor is used
+func (recorder *Recorder) Returns(method string, results ...interface{}) {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	if recorder.responses == nil {
+		recorder.responses = map[string][][]interface{}{}
+	}
+
+	recorder.responses[method] = append(recorder.responses[method], results)
+}
+
+// Reset removes the recorded calls and the queued responses
+func (recorder *Recorder) Reset() {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	recorder.calls = nil
+	recorder.responses = nil
+}
+
+// record saves a call and returns the next queued response if any
+func (recorder *Recorder) record(method string, results int, ctx context.Context, args ...interface{}) ([]interface{}, bool) {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	if recorder.calls == nil {
+		recorder.calls = map[string][]Call{}
+	}
+
+	recorder.calls[method] = append(recorder.calls[method], Call{Context: ctx, Args: args})
+
+	queue := recorder.responses[method]
+	if len(queue) == 0 {
+		return nil, false
+	}
+
+	response := queue[0]
+	recorder.responses[method] = queue[1:]
+
+	if len(response) != results {
+		panic(fmt.Sprintf("mocks: %s response has %d values, expected %d", method, len(response), results))
+	}
+
+	return response, true
+}
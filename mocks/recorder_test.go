@@ -0,0 +1,57 @@
+package mocks
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+func TestRecorder(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Test safe default", func(t *testing.T) {
+		repo := UserRepo{}
+		user, err := repo.GetById(ctx, "newid")
+
+		if !errors.Is(err, ErrUnexpectedCall) || user != (domain.User{}) {
+			t.Errorf("Expected zero value and error: %v got: %+v %v", ErrUnexpectedCall, user, err)
+		}
+	})
+
+	t.Run("Test sequenced responses", func(t *testing.T) {
+		repo := UserRepo{
+			GetByIdInterceptor: func(id string) (domain.User, error) {
+				return domain.User{Id: id, Username: "interceptor"}, nil
+			},
+		}
+
+		repo.Returns("GetById", domain.User{Username: "first"}, nil)
+		repo.Returns("GetById", nil, domain.ErrNotFound)
+
+		first, _ := repo.GetById(ctx, "a")
+		_, err := repo.GetById(ctx, "b")
+		third, _ := repo.GetById(ctx, "c")
+
+		if first.Username != "first" || !errors.Is(err, domain.ErrNotFound) || third.Username != "interceptor" {
+			t.Errorf("Expected queued responses before the interceptor got: %+v %v %+v", first, err, third)
+		}
+
+		calls := repo.Calls("GetById")
+		if len(calls) != 3 || calls[1].Args[0] != "b" || calls[1].Context != ctx {
+			t.Errorf("Expected 3 recorded calls got: %+v", calls)
+		}
+	})
+
+	t.Run("Test reset", func(t *testing.T) {
+		repo := CredentialRepo{}
+		repo.Returns("UpdateSignCount", nil)
+		repo.UpdateSignCount(ctx, "credential", 1)
+		repo.Reset()
+
+		if _, ok := repo.LastCall("UpdateSignCount"); ok || repo.CallCount("UpdateSignCount") != 0 {
+			t.Error("Expected calls to be removed")
+		}
+	})
+}
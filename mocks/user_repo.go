@@ -1,21 +1,142 @@
+// Code generated by mocks/gen from internal/core/ports. DO NOT EDIT.
+
 package mocks
 
-import "github.com/sy-software/minerva-spear-users/internal/core/domain"
+import (
+	"context"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
 
+// UserRepo is a call recording fake of ports.UserRepo
 type UserRepo struct {
+	Recorder
+
 	CreateInterceptor        func(user domain.Register) (domain.User, error)
 	GetByIdInterceptor       func(id string) (domain.User, error)
 	GetByUsernameInterceptor func(username string) (domain.User, error)
+	ListInterceptor          func(filter domain.UserFilter) (domain.UserPage, error)
+	UpdateInterceptor        func(id string, update domain.UserUpdate) (domain.User, error)
+	UpdateStatusInterceptor  func(id string, status string) (domain.User, error)
+	RevokeTokensInterceptor  func(id string) (domain.User, error)
+	DeleteInterceptor        func(id string) error
 }
 
-func (repo *UserRepo) Create(user domain.Register) (domain.User, error) {
-	return repo.CreateInterceptor(user)
+func (mock *UserRepo) Create(ctx context.Context, user domain.Register) (r0 domain.User, r1 error) {
+	if results, ok := mock.record("Create", 2, ctx, user); ok {
+		r0, _ = results[0].(domain.User)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.CreateInterceptor != nil {
+		return mock.CreateInterceptor(user)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
 }
 
-func (repo *UserRepo) GetById(id string) (domain.User, error) {
-	return repo.GetByIdInterceptor(id)
+func (mock *UserRepo) GetById(ctx context.Context, id string) (r0 domain.User, r1 error) {
+	if results, ok := mock.record("GetById", 2, ctx, id); ok {
+		r0, _ = results[0].(domain.User)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.GetByIdInterceptor != nil {
+		return mock.GetByIdInterceptor(id)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
+}
+
+func (mock *UserRepo) GetByUsername(ctx context.Context, username string) (r0 domain.User, r1 error) {
+	if results, ok := mock.record("GetByUsername", 2, ctx, username); ok {
+		r0, _ = results[0].(domain.User)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.GetByUsernameInterceptor != nil {
+		return mock.GetByUsernameInterceptor(username)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
+}
+
+func (mock *UserRepo) List(ctx context.Context, filter domain.UserFilter) (r0 domain.UserPage, r1 error) {
+	if results, ok := mock.record("List", 2, ctx, filter); ok {
+		r0, _ = results[0].(domain.UserPage)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.ListInterceptor != nil {
+		return mock.ListInterceptor(filter)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
 }
 
-func (repo *UserRepo) GetByUsername(username string) (domain.User, error) {
-	return repo.GetByUsernameInterceptor(username)
+func (mock *UserRepo) Update(ctx context.Context, id string, update domain.UserUpdate) (r0 domain.User, r1 error) {
+	if results, ok := mock.record("Update", 2, ctx, id, update); ok {
+		r0, _ = results[0].(domain.User)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.UpdateInterceptor != nil {
+		return mock.UpdateInterceptor(id, update)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
+}
+
+func (mock *UserRepo) UpdateStatus(ctx context.Context, id string, status string) (r0 domain.User, r1 error) {
+	if results, ok := mock.record("UpdateStatus", 2, ctx, id, status); ok {
+		r0, _ = results[0].(domain.User)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.UpdateStatusInterceptor != nil {
+		return mock.UpdateStatusInterceptor(id, status)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
+}
+
+func (mock *UserRepo) RevokeTokens(ctx context.Context, id string) (r0 domain.User, r1 error) {
+	if results, ok := mock.record("RevokeTokens", 2, ctx, id); ok {
+		r0, _ = results[0].(domain.User)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.RevokeTokensInterceptor != nil {
+		return mock.RevokeTokensInterceptor(id)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
+}
+
+func (mock *UserRepo) Delete(ctx context.Context, id string) (r0 error) {
+	if results, ok := mock.record("Delete", 1, ctx, id); ok {
+		r0, _ = results[0].(error)
+		return
+	}
+
+	if mock.DeleteInterceptor != nil {
+		return mock.DeleteInterceptor(id)
+	}
+
+	r0 = ErrUnexpectedCall
+	return
 }
@@ -0,0 +1,79 @@
+// Code generated by mocks/gen from internal/core/ports. DO NOT EDIT.
+
+package mocks
+
+import (
+	"context"
+
+	"github.com/sy-software/minerva-spear-users/internal/core/domain"
+)
+
+// WebAuthnService is a call recording fake of ports.WebAuthnService
+type WebAuthnService struct {
+	Recorder
+
+	BeginRegistrationInterceptor  func(userId string) (domain.CredentialCreation, error)
+	FinishRegistrationInterceptor func(userId string, credential domain.RegistrationCredential) (domain.Credential, error)
+	BeginLoginInterceptor         func(username string) (domain.CredentialAssertion, error)
+	FinishLoginInterceptor        func(credential domain.LoginCredential) (domain.UserToken, error)
+}
+
+func (mock *WebAuthnService) BeginRegistration(ctx context.Context, userId string) (r0 domain.CredentialCreation, r1 error) {
+	if results, ok := mock.record("BeginRegistration", 2, ctx, userId); ok {
+		r0, _ = results[0].(domain.CredentialCreation)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.BeginRegistrationInterceptor != nil {
+		return mock.BeginRegistrationInterceptor(userId)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
+}
+
+func (mock *WebAuthnService) FinishRegistration(ctx context.Context, userId string, credential domain.RegistrationCredential) (r0 domain.Credential, r1 error) {
+	if results, ok := mock.record("FinishRegistration", 2, ctx, userId, credential); ok {
+		r0, _ = results[0].(domain.Credential)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.FinishRegistrationInterceptor != nil {
+		return mock.FinishRegistrationInterceptor(userId, credential)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
+}
+
+func (mock *WebAuthnService) BeginLogin(ctx context.Context, username string) (r0 domain.CredentialAssertion, r1 error) {
+	if results, ok := mock.record("BeginLogin", 2, ctx, username); ok {
+		r0, _ = results[0].(domain.CredentialAssertion)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.BeginLoginInterceptor != nil {
+		return mock.BeginLoginInterceptor(username)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
+}
+
+func (mock *WebAuthnService) FinishLogin(ctx context.Context, credential domain.LoginCredential) (r0 domain.UserToken, r1 error) {
+	if results, ok := mock.record("FinishLogin", 2, ctx, credential); ok {
+		r0, _ = results[0].(domain.UserToken)
+		r1, _ = results[1].(error)
+		return
+	}
+
+	if mock.FinishLoginInterceptor != nil {
+		return mock.FinishLoginInterceptor(credential)
+	}
+
+	r1 = ErrUnexpectedCall
+	return
+}